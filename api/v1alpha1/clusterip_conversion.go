@@ -0,0 +1,161 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/hicompute/histack/api/v1beta1"
+)
+
+// clusterIPConversionData holds the v1beta1 ClusterIP fields missing in v1alpha1.
+// Phase describes the binding in BindingRef and is only restored while the
+// v1alpha1 binding fields still match it.
+// +kubebuilder:object:generate=false
+type clusterIPConversionData struct {
+	BindingRef *v1beta1.ClusterIPBindingRef `json:"bindingRef,omitempty"`
+	Phase      v1beta1.ClusterIPPhase       `json:"phase,omitempty"`
+}
+
+// ConvertTo converts this ClusterIP (v1alpha1) to the Hub version (v1beta1).
+func (src *ClusterIP) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ClusterIP)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1 ClusterIP but got %T", dstRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1beta1.ClusterIPSpec{
+		ClusterIPPool: src.Spec.ClusterIPPool,
+		Address:       src.Spec.Address,
+		Family:        src.Spec.Family,
+		Retention:     v1beta1.ClusterIPRetention(src.Spec.Retention),
+		ReleasePolicy: v1beta1.ReleasePolicy(src.Spec.ReleasePolicy),
+		RetainFor:     src.Spec.RetainFor.DeepCopy(),
+	}
+	if src.Spec.Resource != "" || src.Spec.Mac != "" || src.Spec.Interface != "" ||
+		src.Spec.ResourceKind != "" || src.Spec.ResourceUID != "" {
+		namespace, name, found := strings.Cut(src.Spec.Resource, "/")
+		if !found {
+			namespace, name = "", src.Spec.Resource
+		}
+		dst.Spec.BindingRef = &v1beta1.ClusterIPBindingRef{
+			Kind:      src.Spec.ResourceKind,
+			Namespace: namespace,
+			Name:      name,
+			UID:       src.Spec.ResourceUID,
+			Interface: src.Spec.Interface,
+			Mac:       src.Spec.Mac,
+		}
+	}
+
+	dst.Status = v1beta1.ClusterIPStatus{
+		Phase:         derivedPhase(dst.Spec.BindingRef),
+		RetainedUntil: src.Status.RetainedUntil.DeepCopy(),
+	}
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]metav1.Condition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			src.Status.Conditions[i].DeepCopyInto(&dst.Status.Conditions[i])
+		}
+	}
+	for _, h := range src.Status.History {
+		dst.Status.History = append(dst.Status.History, v1beta1.ClusterIPHistory{
+			Mac:         h.Mac,
+			Interface:   h.Interface,
+			Resource:    h.Resource,
+			AllocatedAt: *h.AllocatedAt.DeepCopy(),
+			ReleasedAt:  *h.ReleasedAt.DeepCopy(),
+		})
+	}
+
+	var data clusterIPConversionData
+	if _, err := unmarshalConversionData(dst, &data); err != nil {
+		return err
+	}
+	if data.Phase != "" && equality.Semantic.DeepEqual(data.BindingRef, dst.Spec.BindingRef) {
+		dst.Status.Phase = data.Phase
+	}
+	return nil
+}
+
+// ConvertFrom converts the Hub version (v1beta1) to this ClusterIP (v1alpha1).
+func (dst *ClusterIP) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ClusterIP)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1 ClusterIP but got %T", srcRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = ClusterIPSpec{
+		ClusterIPPool: src.Spec.ClusterIPPool,
+		Address:       src.Spec.Address,
+		Family:        src.Spec.Family,
+		Retention:     ClusterIPRetention(src.Spec.Retention),
+		ReleasePolicy: ReleasePolicy(src.Spec.ReleasePolicy),
+		RetainFor:     src.Spec.RetainFor.DeepCopy(),
+	}
+	if ref := src.Spec.BindingRef; ref != nil {
+		dst.Spec.ResourceKind = ref.Kind
+		dst.Spec.ResourceUID = ref.UID
+		dst.Spec.Interface = ref.Interface
+		dst.Spec.Mac = ref.Mac
+		dst.Spec.Resource = ref.Name
+		if ref.Namespace != "" {
+			dst.Spec.Resource = ref.Namespace + "/" + ref.Name
+		}
+	}
+
+	dst.Status = ClusterIPStatus{RetainedUntil: src.Status.RetainedUntil.DeepCopy()}
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]metav1.Condition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			src.Status.Conditions[i].DeepCopyInto(&dst.Status.Conditions[i])
+		}
+	}
+	for _, h := range src.Status.History {
+		dst.Status.History = append(dst.Status.History, ClusterIPHistory{
+			Mac:         h.Mac,
+			Interface:   h.Interface,
+			Resource:    h.Resource,
+			AllocatedAt: *h.AllocatedAt.DeepCopy(),
+			ReleasedAt:  *h.ReleasedAt.DeepCopy(),
+		})
+	}
+
+	if src.Status.Phase == "" || src.Status.Phase == derivedPhase(src.Spec.BindingRef) {
+		return nil
+	}
+	return marshalConversionData(dst, clusterIPConversionData{
+		BindingRef: src.Spec.BindingRef.DeepCopy(),
+		Phase:      src.Status.Phase,
+	})
+}
+
+// derivedPhase is the phase a v1alpha1 binding converts to. v1alpha1 marks
+// released addresses by clearing their mac.
+func derivedPhase(ref *v1beta1.ClusterIPBindingRef) v1beta1.ClusterIPPhase {
+	if ref == nil || ref.Mac == "" {
+		return v1beta1.ClusterIPPhaseReleased
+	}
+	return v1beta1.ClusterIPPhaseBound
+}
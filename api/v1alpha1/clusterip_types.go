@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -32,8 +33,49 @@ type ClusterIPSpec struct {
 	// +kubebuilder:validation:Enum=v4;v6
 	Family   string `json:"family"`
 	Resource string `json:"resource"`
+	// resourceKind is the kind of the bound workload, VirtualMachine or Pod.
+	// +optional
+	ResourceKind string `json:"resourceKind,omitempty"`
+	// resourceUID is the uid of the bound workload instance.
+	// +optional
+	ResourceUID types.UID `json:"resourceUID,omitempty"`
+	// retention decides whether the binding follows the workload name or its instance.
+	// +optional
+	Retention ClusterIPRetention `json:"retention,omitempty"`
+	// releasePolicy overrides the release policy of the pool for this address.
+	// +optional
+	ReleasePolicy ReleasePolicy `json:"releasePolicy,omitempty"`
+	// retainFor overrides the retainFor of the pool for this address.
+	// +optional
+	RetainFor *metav1.Duration `json:"retainFor,omitempty"`
 }
 
+// ClusterIPRetention decides which workload a ClusterIP stays bound to.
+// +kubebuilder:validation:Enum=Sticky;Ephemeral
+type ClusterIPRetention string
+
+const (
+	// ClusterIPRetentionSticky keeps the address for any workload recreated with the same name.
+	ClusterIPRetentionSticky ClusterIPRetention = "Sticky"
+	// ClusterIPRetentionEphemeral releases the address when a workload with a different uid takes the name.
+	ClusterIPRetentionEphemeral ClusterIPRetention = "Ephemeral"
+)
+
+// RetentionAnnotation on a Pod or VirtualMachine selects the retention of its ClusterIPs.
+const RetentionAnnotation = "ipam.histack.ir/retention"
+
+// AddressesAnnotation on a VirtualMachine publishes the addresses allocated to
+// its networks, as a JSON object of network name to address.
+const AddressesAnnotation = "ipam.histack.ir/addresses"
+
+// AddressLabel on a VirtualMachine is the IPv4 address of its default network,
+// so `kubectl get vm -L ipam.histack.ir/address` lists it.
+const AddressLabel = "ipam.histack.ir/address"
+
+// VirtualMachineFinalizer holds a VirtualMachine until its credentials are
+// deleted and its ClusterIPs released.
+const VirtualMachineFinalizer = "ipam.histack.ir/virtualmachine-protection"
+
 type ClusterIPHistory struct {
 	Mac         string      `json:"mac"`
 	Interface   string      `json:"interface,omitempty"`
@@ -64,6 +106,10 @@ type ClusterIPStatus struct {
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 	History    []ClusterIPHistory `json:"history,omitempty"`
+	// retainedUntil is when a retained address goes back to its pool unless
+	// a workload with the same name claims it first.
+	// +optional
+	RetainedUntil *metav1.Time `json:"retainedUntil,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -76,6 +122,7 @@ type ClusterIPStatus struct {
 // +kubebuilder:selectablefield:JSONPath=.spec.containerInterface
 // +kubebuilder:selectablefield:JSONPath=.spec.family
 // +kubebuilder:selectablefield:JSONPath=.spec.mac
+// +kubebuilder:selectablefield:JSONPath=.spec.clusterIPPool
 type ClusterIP struct {
 	metav1.TypeMeta `json:",inline"`
 
@@ -0,0 +1,140 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/hicompute/histack/api/v1beta1"
+)
+
+// clusterIPPoolConversionData holds the v1beta1 ClusterIPPool fields missing in v1alpha1.
+// +kubebuilder:object:generate=false
+type clusterIPPoolConversionData struct {
+	// ReleasedAddresses maps released ClusterIP names to their address.
+	ReleasedAddresses map[string]string `json:"releasedAddresses,omitempty"`
+}
+
+// ConvertTo converts this ClusterIPPool (v1alpha1) to the Hub version (v1beta1).
+func (src *ClusterIPPool) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ClusterIPPool)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1 ClusterIPPool but got %T", dstRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1beta1.ClusterIPPoolSpec{
+		IPFamily:                 src.Spec.IPFamily,
+		CIDR:                     src.Spec.CIDR,
+		Gateway:                  src.Spec.Gateway,
+		DeletionPolicy:           v1beta1.ClusterIPPoolDeletionPolicy(src.Spec.DeletionPolicy),
+		ReleasePolicy:            v1beta1.ReleasePolicy(src.Spec.ReleasePolicy),
+		RetainFor:                src.Spec.RetainFor.DeepCopy(),
+		NearlyExhaustedThreshold: src.Spec.NearlyExhaustedThreshold,
+		Public:                   src.Spec.Public,
+	}
+
+	var err error
+	dst.Status = v1beta1.ClusterIPPoolStatus{}
+	if src.Status.DeletionBlockers != nil {
+		dst.Status.DeletionBlockers = append([]string(nil), src.Status.DeletionBlockers...)
+	}
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]metav1.Condition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			src.Status.Conditions[i].DeepCopyInto(&dst.Status.Conditions[i])
+		}
+	}
+	if dst.Status.TotalIPs, err = stringToQuantity(src.Status.TotalIPs); err != nil {
+		return fmt.Errorf("status.totalIPs: %w", err)
+	}
+	if dst.Status.AllocatedIPs, err = stringToQuantity(src.Status.AllocatedIPs); err != nil {
+		return fmt.Errorf("status.allocatedIPs: %w", err)
+	}
+	if dst.Status.FreeIPs, err = stringToQuantity(src.Status.FreeIPs); err != nil {
+		return fmt.Errorf("status.freeIPs: %w", err)
+	}
+	if dst.Status.NextIndex, err = stringToQuantity(src.Status.NextIndex); err != nil {
+		return fmt.Errorf("status.nextIndex: %w", err)
+	}
+
+	var data clusterIPPoolConversionData
+	if _, err := unmarshalConversionData(dst, &data); err != nil {
+		return err
+	}
+	for _, name := range src.Status.ReleasedClusterIPs {
+		dst.Status.ReleasedClusterIPs = append(dst.Status.ReleasedClusterIPs, v1beta1.ReleasedClusterIP{
+			Name:    name,
+			Address: data.ReleasedAddresses[name],
+		})
+	}
+	return nil
+}
+
+// ConvertFrom converts the Hub version (v1beta1) to this ClusterIPPool (v1alpha1).
+func (dst *ClusterIPPool) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ClusterIPPool)
+	if !ok {
+		return fmt.Errorf("expected a v1beta1 ClusterIPPool but got %T", srcRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = ClusterIPPoolSpec{
+		IPFamily:                 src.Spec.IPFamily,
+		CIDR:                     src.Spec.CIDR,
+		Gateway:                  src.Spec.Gateway,
+		DeletionPolicy:           ClusterIPPoolDeletionPolicy(src.Spec.DeletionPolicy),
+		ReleasePolicy:            ReleasePolicy(src.Spec.ReleasePolicy),
+		RetainFor:                src.Spec.RetainFor.DeepCopy(),
+		NearlyExhaustedThreshold: src.Spec.NearlyExhaustedThreshold,
+		Public:                   src.Spec.Public,
+	}
+
+	dst.Status = ClusterIPPoolStatus{
+		TotalIPs:     quantityToString(src.Status.TotalIPs),
+		AllocatedIPs: quantityToString(src.Status.AllocatedIPs),
+		FreeIPs:      quantityToString(src.Status.FreeIPs),
+		NextIndex:    quantityToString(src.Status.NextIndex),
+	}
+	if src.Status.DeletionBlockers != nil {
+		dst.Status.DeletionBlockers = append([]string(nil), src.Status.DeletionBlockers...)
+	}
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]metav1.Condition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			src.Status.Conditions[i].DeepCopyInto(&dst.Status.Conditions[i])
+		}
+	}
+
+	data := clusterIPPoolConversionData{}
+	for _, released := range src.Status.ReleasedClusterIPs {
+		dst.Status.ReleasedClusterIPs = append(dst.Status.ReleasedClusterIPs, released.Name)
+		if released.Address != "" {
+			if data.ReleasedAddresses == nil {
+				data.ReleasedAddresses = map[string]string{}
+			}
+			data.ReleasedAddresses[released.Name] = released.Address
+		}
+	}
+	if data.ReleasedAddresses != nil {
+		return marshalConversionData(dst, data)
+	}
+	return nil
+}
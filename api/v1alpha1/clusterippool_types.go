@@ -6,12 +6,86 @@ import (
 
 // ClusterIPPoolSpec defines the desired state of ClusterIPPool
 type ClusterIPPoolSpec struct {
+	// ipFamily is inferred from the cidr when omitted.
 	// +kubebuilder:validation:Enum=v4;v6
-	IPFamily string `json:"ipFamily"`
+	// +optional
+	IPFamily string `json:"ipFamily,omitempty"`
 	CIDR     string `json:"cidr"`
 	Gateway  string `json:"gateway,omitempty"`
+	// deletionPolicy decides what happens to bound ClusterIPs when the pool is deleted.
+	// +kubebuilder:default=Block
+	// +optional
+	DeletionPolicy ClusterIPPoolDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// releasePolicy decides what happens to an address when its workload is deleted.
+	// Pods and VirtualMachines override it with the ReleasePolicyAnnotation.
+	// +kubebuilder:default=Delete
+	// +optional
+	ReleasePolicy ReleasePolicy `json:"releasePolicy,omitempty"`
+	// retainFor is how long the RetainFor release policy keeps an address.
+	// +optional
+	RetainFor *metav1.Duration `json:"retainFor,omitempty"`
+	// nearlyExhaustedThreshold is the percentage of addresses in use at which
+	// the pool reports NearlyExhausted.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default=90
+	// +optional
+	NearlyExhaustedThreshold int32 `json:"nearlyExhaustedThreshold,omitempty"`
+	// public pools hold the addresses of FloatingIPs and only theirs, pods
+	// and VirtualMachines never take an address from them.
+	// +optional
+	Public bool `json:"public,omitempty"`
+}
+
+// ReleasePolicy describes what happens to an address when its workload is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;RetainFor
+type ReleasePolicy string
+
+const (
+	// ReleasePolicyDelete returns the address to its pool as soon as the workload is deleted.
+	ReleasePolicyDelete ReleasePolicy = "Delete"
+	// ReleasePolicyRetain keeps the address for a workload recreated with the same name
+	// until an admin clears the resource of its ClusterIP.
+	ReleasePolicyRetain ReleasePolicy = "Retain"
+	// ReleasePolicyRetainFor keeps the address for the same name during retainFor.
+	ReleasePolicyRetainFor ReleasePolicy = "RetainFor"
+)
+
+const (
+	// ReleasePolicyAnnotation on a Pod or VirtualMachine overrides the release policy of its pool.
+	ReleasePolicyAnnotation = "ipam.histack.ir/release-policy"
+	// RetainForAnnotation on a Pod or VirtualMachine overrides the retainFor of its pool.
+	RetainForAnnotation = "ipam.histack.ir/retain-for"
+	// NetworkPoolsAnnotation on a VirtualMachine maps the names of its networks
+	// to the NetworkPool their interfaces take addresses from, as a JSON object.
+	// Networks it does not name take addresses from any pool of the family.
+	NetworkPoolsAnnotation = "ipam.histack.ir/network-pools"
+)
+
+// NetworkPool selects the pools the interface of a network takes addresses from.
+type NetworkPool struct {
+	// clusterIPPool is the pool to allocate from.
+	// +optional
+	ClusterIPPool string `json:"clusterIPPool,omitempty"`
+	// poolSelector selects the pools to allocate from by label.
+	// +optional
+	PoolSelector *metav1.LabelSelector `json:"poolSelector,omitempty"`
 }
 
+// ClusterIPPoolDeletionPolicy describes how a ClusterIPPool is deleted.
+// +kubebuilder:validation:Enum=Block;Cascade
+type ClusterIPPoolDeletionPolicy string
+
+const (
+	// ClusterIPPoolDeletionBlock keeps the pool until none of its ClusterIPs is bound.
+	ClusterIPPoolDeletionBlock ClusterIPPoolDeletionPolicy = "Block"
+	// ClusterIPPoolDeletionCascade releases and deletes the ClusterIPs of the pool.
+	ClusterIPPoolDeletionCascade ClusterIPPoolDeletionPolicy = "Cascade"
+)
+
+// ClusterIPPoolFinalizer holds a ClusterIPPool until its ClusterIPs are gone.
+const ClusterIPPoolFinalizer = "ipam.histack.ir/clusterippool-protection"
+
 // ClusterIPPoolStatus defines the observed state of ClusterIPPool.
 type ClusterIPPoolStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -38,6 +112,9 @@ type ClusterIPPoolStatus struct {
 	FreeIPs            string             `json:"freeIPs"`
 	NextIndex          string             `json:"nextIndex"`
 	ReleasedClusterIPs []string           `json:"releasedClusterIPs,omitempty"`
+	// deletionBlockers are the bound ClusterIPs keeping a deleted pool around.
+	// +optional
+	DeletionBlockers []string `json:"deletionBlockers,omitempty"`
 }
 
 // +kubebuilder:object:root=true
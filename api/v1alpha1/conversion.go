@@ -0,0 +1,99 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"maps"
+	"math/big"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConversionDataAnnotation keeps the v1beta1 fields v1alpha1 cannot represent,
+// so an object read and written back through v1alpha1 does not lose them.
+const ConversionDataAnnotation = "ipam.histack.ir/conversion-data"
+
+// marshalConversionData stores data on the v1alpha1 object.
+func marshalConversionData(obj metav1.Object, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	annotations := maps.Clone(obj.GetAnnotations())
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ConversionDataAnnotation] = string(raw)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// unmarshalConversionData reads data back and drops the annotation from the v1beta1 object.
+func unmarshalConversionData(obj metav1.Object, data any) (bool, error) {
+	raw, ok := obj.GetAnnotations()[ConversionDataAnnotation]
+	if !ok {
+		return false, nil
+	}
+	annotations := maps.Clone(obj.GetAnnotations())
+	delete(annotations, ConversionDataAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+	if err := json.Unmarshal([]byte(raw), data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// stringToQuantity converts a v1alpha1 decimal counter.
+func stringToQuantity(s string) (*resource.Quantity, error) {
+	if s == "" {
+		return nil, nil
+	}
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// quantityToString renders a quantity as a plain decimal integer, the form
+// v1alpha1 counters are parsed with.
+func quantityToString(q *resource.Quantity) string {
+	if q == nil {
+		return ""
+	}
+	dec := q.AsDec()
+	value := new(big.Int).Set(dec.UnscaledBig())
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(int(dec.Scale())))), nil)
+	if dec.Scale() > 0 {
+		value.Quo(value, scale)
+	} else {
+		value.Mul(value, scale)
+	}
+	return value.String()
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
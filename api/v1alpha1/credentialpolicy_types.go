@@ -0,0 +1,175 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CharacterClass is a set of characters a generated password draws from.
+// +kubebuilder:validation:Enum=Lowercase;Uppercase;Digits;Symbols
+type CharacterClass string
+
+const (
+	CharacterClassLowercase CharacterClass = "Lowercase"
+	CharacterClassUppercase CharacterClass = "Uppercase"
+	CharacterClassDigits    CharacterClass = "Digits"
+	CharacterClassSymbols   CharacterClass = "Symbols"
+)
+
+// PasswordPolicy shapes generated passwords.
+type PasswordPolicy struct {
+	// length of generated passwords.
+	// +kubebuilder:validation:Minimum=8
+	// +kubebuilder:validation:Maximum=128
+	// +kubebuilder:default=16
+	// +optional
+	Length int32 `json:"length,omitempty"`
+	// characterClasses a password draws from, each at least once.
+	// Lowercase, Uppercase and Digits when empty.
+	// +listType=set
+	// +optional
+	CharacterClasses []CharacterClass `json:"characterClasses,omitempty"`
+}
+
+// SSHPublicKeysSource is a secret of SSH public keys, one key per value.
+type SSHPublicKeysSource struct {
+	// secretName of the secret in the namespace of the VirtualMachine.
+	// +required
+	SecretName string `json:"secretName"`
+	// users the keys are authorized for through the guest agent.
+	// The username of the VirtualMachine when empty.
+	// +listType=set
+	// +optional
+	Users []string `json:"users,omitempty"`
+}
+
+const (
+	// ResetPasswordAnnotation on a VirtualMachine regenerates its password
+	// whenever it is set to a new value, e.g. the time of the request.
+	ResetPasswordAnnotation = "ipam.histack.ir/reset-password"
+	// PasswordRotationIntervalAnnotation on a VirtualMachine regenerates its
+	// password once the last reset is older than the duration, e.g. 720h.
+	PasswordRotationIntervalAnnotation = "ipam.histack.ir/password-rotation-interval"
+	// PasswordResetStatusAnnotation on a VirtualMachine publishes its
+	// PasswordResetStatus as JSON.
+	PasswordResetStatusAnnotation = "ipam.histack.ir/password-reset-status"
+)
+
+// PasswordResetReason tells why the password of a VirtualMachine was reset.
+type PasswordResetReason string
+
+const (
+	// PasswordResetRequested is a reset asked for with the ResetPasswordAnnotation.
+	PasswordResetRequested PasswordResetReason = "Requested"
+	// PasswordResetRotated is a reset due by the PasswordRotationIntervalAnnotation.
+	PasswordResetRotated PasswordResetReason = "Rotated"
+)
+
+// PasswordResetStatus is the last password reset of a VirtualMachine.
+type PasswordResetStatus struct {
+	// request is the value of the ResetPasswordAnnotation last handled.
+	// +optional
+	Request string `json:"request,omitempty"`
+	// reason the password was reset.
+	Reason PasswordResetReason `json:"reason"`
+	// lastResetTime is when the credentials secret got the new password.
+	LastResetTime metav1.Time `json:"lastResetTime"`
+	// confirmed once the guest agent synchronized the new password.
+	Confirmed bool `json:"confirmed"`
+	// message of the guest agent failing to synchronize it.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// CredentialPolicySpec defines how the access credentials of VirtualMachines are set up.
+type CredentialPolicySpec struct {
+	// vmSelector selects the VirtualMachines the policy applies to, all when empty.
+	// +optional
+	VMSelector *metav1.LabelSelector `json:"vmSelector,omitempty"`
+	// generate creates a credentials secret with a generated password and
+	// propagates it through the guest agent. Nothing is generated when false.
+	// +kubebuilder:default=true
+	// +optional
+	Generate *bool `json:"generate,omitempty"`
+	// usernames by OS category, the histack/oscategory label of the VirtualMachine.
+	// Categories it leaves out use root, administrator for windows and admin for mikrotik.
+	// +optional
+	Usernames map[string]string `json:"usernames,omitempty"`
+	// password shapes generated passwords.
+	// +optional
+	Password PasswordPolicy `json:"password,omitempty,omitzero"`
+	// sshPublicKeys are propagated to the VirtualMachine through the guest agent.
+	// +optional
+	SSHPublicKeys *SSHPublicKeysSource `json:"sshPublicKeys,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=credpol
+
+// CredentialPolicy sets up the access credentials of the VirtualMachines in
+// its namespace. It takes precedence over ClusterCredentialPolicies.
+type CredentialPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of CredentialPolicy
+	// +required
+	Spec CredentialPolicySpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// CredentialPolicyList contains a list of CredentialPolicy
+type CredentialPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CredentialPolicy `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=ccredpol
+
+// ClusterCredentialPolicy sets up the access credentials of VirtualMachines in
+// any namespace without a matching CredentialPolicy.
+type ClusterCredentialPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of ClusterCredentialPolicy
+	// +required
+	Spec CredentialPolicySpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterCredentialPolicyList contains a list of ClusterCredentialPolicy
+type ClusterCredentialPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCredentialPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CredentialPolicy{}, &CredentialPolicyList{}, &ClusterCredentialPolicy{}, &ClusterCredentialPolicyList{})
+}
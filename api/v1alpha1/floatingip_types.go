@@ -0,0 +1,125 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FloatingIPSpec defines the desired state of FloatingIP
+type FloatingIPSpec struct {
+	// clusterIPPool is the public pool the address is allocated from.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="field is immutable"
+	// +required
+	ClusterIPPool string `json:"clusterIPPool"`
+	// virtualMachine in the namespace of the FloatingIP the address is
+	// associated with. The address is kept while it is empty.
+	// +optional
+	VirtualMachine string `json:"virtualMachine,omitempty"`
+	// interface of the VirtualMachine whose private address is translated.
+	// +kubebuilder:default=eth0
+	// +optional
+	Interface string `json:"interface,omitempty"`
+}
+
+// FloatingIPPhase is the state of a FloatingIP.
+// +kubebuilder:validation:Enum=Pending;Allocated;Associated
+type FloatingIPPhase string
+
+const (
+	// FloatingIPPending addresses wait for a free address in their pool.
+	FloatingIPPending FloatingIPPhase = "Pending"
+	// FloatingIPAllocated addresses are held but not associated with a VirtualMachine.
+	FloatingIPAllocated FloatingIPPhase = "Allocated"
+	// FloatingIPAssociated addresses are translated to the private address of a VirtualMachine.
+	FloatingIPAssociated FloatingIPPhase = "Associated"
+)
+
+const (
+	// FloatingIPFinalizer removes the NAT and releases the address of a deleted FloatingIP.
+	FloatingIPFinalizer = "ipam.histack.ir/floatingip-protection"
+	// FloatingIPKind is the resourceKind of ClusterIPs held by a FloatingIP.
+	FloatingIPKind = "FloatingIP"
+)
+
+// FloatingIPStatus defines the observed state of FloatingIP.
+type FloatingIPStatus struct {
+	// phase is the state of the floating address.
+	// +optional
+	Phase FloatingIPPhase `json:"phase,omitempty"`
+	// clusterIP is the name of the ClusterIP holding the public address.
+	// +optional
+	ClusterIP string `json:"clusterIP,omitempty"`
+	// address is the public address.
+	// +optional
+	Address string `json:"address,omitempty"`
+	// virtualMachine the address is associated with.
+	// +optional
+	VirtualMachine string `json:"virtualMachine,omitempty"`
+	// logicalIP is the private address the public address is translated to.
+	// +optional
+	LogicalIP string `json:"logicalIP,omitempty"`
+	// associatedAt is when the address was associated with virtualMachine.
+	// +optional
+	AssociatedAt *metav1.Time `json:"associatedAt,omitempty"`
+
+	// conditions represent the current state of the FloatingIP resource.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=fip
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=.status.phase
+// +kubebuilder:printcolumn:name="Address",type=string,JSONPath=.status.address
+// +kubebuilder:printcolumn:name="VM",type=string,JSONPath=.status.virtualMachine
+// +kubebuilder:printcolumn:name="Logical IP",type=string,JSONPath=.status.logicalIP
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=.metadata.creationTimestamp
+
+// FloatingIP is a public address that can be moved between VirtualMachines
+// through dnat_and_snat NAT on the OVN logical router.
+type FloatingIP struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of FloatingIP
+	// +required
+	Spec FloatingIPSpec `json:"spec"`
+
+	// status defines the observed state of FloatingIP
+	// +optional
+	Status FloatingIPStatus `json:"status,omitempty,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// FloatingIPList contains a list of FloatingIP
+type FloatingIPList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FloatingIP `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FloatingIP{}, &FloatingIPList{})
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// IPClaimSpec defines the desired state of IPClaim
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type IPClaimSpec struct {
+	// family of the claimed address.
+	// +kubebuilder:validation:Enum=v4;v6
+	// +kubebuilder:default=v4
+	// +optional
+	Family string `json:"family,omitempty"`
+	// clusterIPPool pins the claim to a single pool.
+	// +optional
+	ClusterIPPool string `json:"clusterIPPool,omitempty"`
+	// poolSelector restricts the claim to pools with matching labels.
+	// +optional
+	PoolSelector *metav1.LabelSelector `json:"poolSelector,omitempty"`
+}
+
+// IPClaimPhase is the binding state of an IPClaim.
+// +kubebuilder:validation:Enum=Pending;Bound;Lost
+type IPClaimPhase string
+
+const (
+	// IPClaimPending claims wait for a pool with a free address.
+	IPClaimPending IPClaimPhase = "Pending"
+	// IPClaimBound claims hold a ClusterIP.
+	IPClaimBound IPClaimPhase = "Bound"
+	// IPClaimLost claims lost their ClusterIP, it was deleted or bound elsewhere.
+	IPClaimLost IPClaimPhase = "Lost"
+)
+
+const (
+	// IPClaimAnnotation on a Pod or VirtualMachine names the IPClaims its
+	// eth0 interface uses, comma separated, at most one per family.
+	IPClaimAnnotation = "ipam.histack.ir/ip-claims"
+	// IPClaimFinalizer releases the ClusterIP of a deleted IPClaim.
+	IPClaimFinalizer = "ipam.histack.ir/ipclaim-protection"
+	// IPClaimKind is the resourceKind of ClusterIPs bound to an IPClaim.
+	IPClaimKind = "IPClaim"
+)
+
+// IPClaimConsumer is the workload using an IPClaim.
+type IPClaimConsumer struct {
+	// kind of the workload, Pod, VirtualMachine or VirtualMachineInstance.
+	Kind string `json:"kind"`
+	// name of the workload in the namespace of the claim.
+	Name string `json:"name"`
+	// uid of the workload.
+	UID types.UID `json:"uid"`
+}
+
+// IPClaimStatus defines the observed state of IPClaim.
+type IPClaimStatus struct {
+	// phase is the binding state of the claim.
+	// +optional
+	Phase IPClaimPhase `json:"phase,omitempty"`
+	// clusterIP is the name of the bound ClusterIP.
+	// +optional
+	ClusterIP string `json:"clusterIP,omitempty"`
+	// address is the bound IP address.
+	// +optional
+	Address string `json:"address,omitempty"`
+	// mac is the MAC address workloads using the claim get.
+	// +optional
+	Mac string `json:"mac,omitempty"`
+	// clusterIPPool is the pool the address comes from.
+	// +optional
+	ClusterIPPool string `json:"clusterIPPool,omitempty"`
+	// gateway of the pool.
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
+	// consumer is the workload using the claim. Another workload may only use
+	// the claim once the consumer is gone.
+	// +optional
+	Consumer *IPClaimConsumer `json:"consumer,omitempty"`
+
+	// conditions represent the current state of the IPClaim resource.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=ipc
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=.status.phase
+// +kubebuilder:printcolumn:name="Address",type=string,JSONPath=.status.address
+// +kubebuilder:printcolumn:name="MAC",type=string,JSONPath=.status.mac
+// +kubebuilder:printcolumn:name="Pool",type=string,JSONPath=.status.clusterIPPool
+// +kubebuilder:printcolumn:name="Consumer",type=string,JSONPath=.status.consumer.name
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=.metadata.creationTimestamp
+
+// IPClaim is a namespaced request for an address, bound to a ClusterIP like a
+// PersistentVolumeClaim is bound to a PersistentVolume.
+type IPClaim struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of IPClaim
+	// +required
+	Spec IPClaimSpec `json:"spec"`
+
+	// status defines the observed state of IPClaim
+	// +optional
+	Status IPClaimStatus `json:"status,omitempty,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// IPClaimList contains a list of IPClaim
+type IPClaimList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IPClaim `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IPClaim{}, &IPClaimList{})
+}
@@ -25,12 +25,70 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCredentialPolicy) DeepCopyInto(out *ClusterCredentialPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCredentialPolicy.
+func (in *ClusterCredentialPolicy) DeepCopy() *ClusterCredentialPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCredentialPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterCredentialPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCredentialPolicyList) DeepCopyInto(out *ClusterCredentialPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterCredentialPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCredentialPolicyList.
+func (in *ClusterCredentialPolicyList) DeepCopy() *ClusterCredentialPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCredentialPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterCredentialPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterIP) DeepCopyInto(out *ClusterIP) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -106,7 +164,7 @@ func (in *ClusterIPPool) DeepCopyInto(out *ClusterIPPool) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -163,6 +221,11 @@ func (in *ClusterIPPoolList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterIPPoolSpec) DeepCopyInto(out *ClusterIPPoolSpec) {
 	*out = *in
+	if in.RetainFor != nil {
+		in, out := &in.RetainFor, &out.RetainFor
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIPPoolSpec.
@@ -190,6 +253,11 @@ func (in *ClusterIPPoolStatus) DeepCopyInto(out *ClusterIPPoolStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DeletionBlockers != nil {
+		in, out := &in.DeletionBlockers, &out.DeletionBlockers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIPPoolStatus.
@@ -205,6 +273,11 @@ func (in *ClusterIPPoolStatus) DeepCopy() *ClusterIPPoolStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterIPSpec) DeepCopyInto(out *ClusterIPSpec) {
 	*out = *in
+	if in.RetainFor != nil {
+		in, out := &in.RetainFor, &out.RetainFor
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIPSpec.
@@ -234,6 +307,10 @@ func (in *ClusterIPStatus) DeepCopyInto(out *ClusterIPStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RetainedUntil != nil {
+		in, out := &in.RetainedUntil, &out.RetainedUntil
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterIPStatus.
@@ -245,3 +322,396 @@ func (in *ClusterIPStatus) DeepCopy() *ClusterIPStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialPolicy) DeepCopyInto(out *CredentialPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialPolicy.
+func (in *CredentialPolicy) DeepCopy() *CredentialPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CredentialPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialPolicyList) DeepCopyInto(out *CredentialPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CredentialPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialPolicyList.
+func (in *CredentialPolicyList) DeepCopy() *CredentialPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CredentialPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialPolicySpec) DeepCopyInto(out *CredentialPolicySpec) {
+	*out = *in
+	if in.VMSelector != nil {
+		in, out := &in.VMSelector, &out.VMSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Generate != nil {
+		in, out := &in.Generate, &out.Generate
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Usernames != nil {
+		in, out := &in.Usernames, &out.Usernames
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Password.DeepCopyInto(&out.Password)
+	if in.SSHPublicKeys != nil {
+		in, out := &in.SSHPublicKeys, &out.SSHPublicKeys
+		*out = new(SSHPublicKeysSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialPolicySpec.
+func (in *CredentialPolicySpec) DeepCopy() *CredentialPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIP) DeepCopyInto(out *FloatingIP) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIP.
+func (in *FloatingIP) DeepCopy() *FloatingIP {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIP)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FloatingIP) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIPList) DeepCopyInto(out *FloatingIPList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]FloatingIP, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIPList.
+func (in *FloatingIPList) DeepCopy() *FloatingIPList {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIPList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FloatingIPList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIPSpec) DeepCopyInto(out *FloatingIPSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIPSpec.
+func (in *FloatingIPSpec) DeepCopy() *FloatingIPSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIPSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIPStatus) DeepCopyInto(out *FloatingIPStatus) {
+	*out = *in
+	if in.AssociatedAt != nil {
+		in, out := &in.AssociatedAt, &out.AssociatedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIPStatus.
+func (in *FloatingIPStatus) DeepCopy() *FloatingIPStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIPStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPClaim) DeepCopyInto(out *IPClaim) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPClaim.
+func (in *IPClaim) DeepCopy() *IPClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(IPClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPClaim) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPClaimConsumer) DeepCopyInto(out *IPClaimConsumer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPClaimConsumer.
+func (in *IPClaimConsumer) DeepCopy() *IPClaimConsumer {
+	if in == nil {
+		return nil
+	}
+	out := new(IPClaimConsumer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPClaimList) DeepCopyInto(out *IPClaimList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IPClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPClaimList.
+func (in *IPClaimList) DeepCopy() *IPClaimList {
+	if in == nil {
+		return nil
+	}
+	out := new(IPClaimList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPClaimList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPClaimSpec) DeepCopyInto(out *IPClaimSpec) {
+	*out = *in
+	if in.PoolSelector != nil {
+		in, out := &in.PoolSelector, &out.PoolSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPClaimSpec.
+func (in *IPClaimSpec) DeepCopy() *IPClaimSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IPClaimSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPClaimStatus) DeepCopyInto(out *IPClaimStatus) {
+	*out = *in
+	if in.Consumer != nil {
+		in, out := &in.Consumer, &out.Consumer
+		*out = new(IPClaimConsumer)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPClaimStatus.
+func (in *IPClaimStatus) DeepCopy() *IPClaimStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IPClaimStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPool) DeepCopyInto(out *NetworkPool) {
+	*out = *in
+	if in.PoolSelector != nil {
+		in, out := &in.PoolSelector, &out.PoolSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPool.
+func (in *NetworkPool) DeepCopy() *NetworkPool {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordPolicy) DeepCopyInto(out *PasswordPolicy) {
+	*out = *in
+	if in.CharacterClasses != nil {
+		in, out := &in.CharacterClasses, &out.CharacterClasses
+		*out = make([]CharacterClass, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordPolicy.
+func (in *PasswordPolicy) DeepCopy() *PasswordPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordResetStatus) DeepCopyInto(out *PasswordResetStatus) {
+	*out = *in
+	in.LastResetTime.DeepCopyInto(&out.LastResetTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordResetStatus.
+func (in *PasswordResetStatus) DeepCopy() *PasswordResetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordResetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHPublicKeysSource) DeepCopyInto(out *SSHPublicKeysSource) {
+	*out = *in
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHPublicKeysSource.
+func (in *SSHPublicKeysSource) DeepCopy() *SSHPublicKeysSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHPublicKeysSource)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ClusterIPBindingRef identifies the workload interface a ClusterIP is bound to.
+type ClusterIPBindingRef struct {
+	// kind of the bound workload, e.g. VirtualMachine or Pod.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// namespace of the bound workload.
+	Namespace string `json:"namespace"`
+	// name of the bound workload.
+	Name string `json:"name"`
+	// uid of the bound workload instance.
+	// +optional
+	UID types.UID `json:"uid,omitempty"`
+	// interface is the container interface the address is attached to.
+	// +optional
+	Interface string `json:"interface,omitempty"`
+	// mac is the hardware address of the bound interface.
+	// +optional
+	Mac string `json:"mac,omitempty"`
+}
+
+// ClusterIPSpec defines the desired state of ClusterIP
+type ClusterIPSpec struct {
+	// clusterIPPool is the pool the address was allocated from.
+	ClusterIPPool string `json:"clusterIPPool"`
+	Address       string `json:"address"`
+	// +kubebuilder:validation:Enum=v4;v6
+	Family string `json:"family"`
+	// bindingRef is the workload interface holding the address. A released address
+	// keeps the workload it was last bound to but has no mac.
+	// +optional
+	BindingRef *ClusterIPBindingRef `json:"bindingRef,omitempty"`
+	// retention decides whether the binding follows the workload name or its instance.
+	// +optional
+	Retention ClusterIPRetention `json:"retention,omitempty"`
+	// releasePolicy overrides the release policy of the pool for this address.
+	// +optional
+	ReleasePolicy ReleasePolicy `json:"releasePolicy,omitempty"`
+	// retainFor overrides the retainFor of the pool for this address.
+	// +optional
+	RetainFor *metav1.Duration `json:"retainFor,omitempty"`
+}
+
+// ClusterIPRetention decides which workload a ClusterIP stays bound to.
+// +kubebuilder:validation:Enum=Sticky;Ephemeral
+type ClusterIPRetention string
+
+const (
+	// ClusterIPRetentionSticky keeps the address for any workload recreated with the same name.
+	ClusterIPRetentionSticky ClusterIPRetention = "Sticky"
+	// ClusterIPRetentionEphemeral releases the address when a workload with a different uid takes the name.
+	ClusterIPRetentionEphemeral ClusterIPRetention = "Ephemeral"
+)
+
+// ClusterIPPhase is the lifecycle phase of a ClusterIP.
+// +kubebuilder:validation:Enum=Bound;Released
+type ClusterIPPhase string
+
+const (
+	// ClusterIPPhaseBound means the address is bound to a workload.
+	ClusterIPPhaseBound ClusterIPPhase = "Bound"
+	// ClusterIPPhaseReleased means the address can be handed out again.
+	ClusterIPPhaseReleased ClusterIPPhase = "Released"
+)
+
+type ClusterIPHistory struct {
+	Mac         string      `json:"mac"`
+	Interface   string      `json:"interface,omitempty"`
+	Resource    string      `json:"resource"`
+	AllocatedAt metav1.Time `json:"allocatedAt"`
+	ReleasedAt  metav1.Time `json:"releasedAt,omitempty"`
+}
+
+// ClusterIPStatus defines the observed state of ClusterIP.
+type ClusterIPStatus struct {
+	// phase of the ClusterIP.
+	// +optional
+	Phase ClusterIPPhase `json:"phase,omitempty"`
+	// conditions represent the current state of the ClusterIP resource.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	History    []ClusterIPHistory `json:"history,omitempty"`
+	// retainedUntil is when a retained address goes back to its pool unless
+	// a workload with the same name claims it first.
+	// +optional
+	RetainedUntil *metav1.Time `json:"retainedUntil,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Address",type=string,JSONPath=.spec.address
+// +kubebuilder:printcolumn:name="Pool",type=string,JSONPath=.spec.clusterIPPool
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=.status.phase
+// +kubebuilder:printcolumn:name="Kind",type=string,JSONPath=.spec.bindingRef.kind
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=.spec.bindingRef.namespace
+// +kubebuilder:printcolumn:name="Name",type=string,JSONPath=.spec.bindingRef.name
+// +kubebuilder:printcolumn:name="MAC",type=string,JSONPath=.spec.bindingRef.mac
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=.metadata.creationTimestamp
+// +kubebuilder:selectablefield:JSONPath=.spec.family
+// +kubebuilder:selectablefield:JSONPath=.spec.clusterIPPool
+// +kubebuilder:selectablefield:JSONPath=.spec.bindingRef.mac
+type ClusterIP struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of ClusterIP
+	// +required
+	Spec ClusterIPSpec `json:"spec"`
+
+	// status defines the observed state of ClusterIP
+	// +optional
+	Status ClusterIPStatus `json:"status,omitempty,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterIPList contains a list of ClusterIP
+type ClusterIPList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterIP `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterIP{}, &ClusterIPList{})
+}
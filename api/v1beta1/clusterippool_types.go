@@ -0,0 +1,165 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterIPPoolSpec defines the desired state of ClusterIPPool
+type ClusterIPPoolSpec struct {
+	// ipFamily is inferred from the cidr when omitted.
+	// +kubebuilder:validation:Enum=v4;v6
+	// +optional
+	IPFamily string `json:"ipFamily,omitempty"`
+	CIDR     string `json:"cidr"`
+	Gateway  string `json:"gateway,omitempty"`
+	// deletionPolicy decides what happens to bound ClusterIPs when the pool is deleted.
+	// +kubebuilder:default=Block
+	// +optional
+	DeletionPolicy ClusterIPPoolDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// releasePolicy decides what happens to an address when its workload is deleted.
+	// Pods and VirtualMachines override it with the ReleasePolicyAnnotation.
+	// +kubebuilder:default=Delete
+	// +optional
+	ReleasePolicy ReleasePolicy `json:"releasePolicy,omitempty"`
+	// retainFor is how long the RetainFor release policy keeps an address.
+	// +optional
+	RetainFor *metav1.Duration `json:"retainFor,omitempty"`
+	// nearlyExhaustedThreshold is the percentage of addresses in use at which
+	// the pool reports NearlyExhausted.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default=90
+	// +optional
+	NearlyExhaustedThreshold int32 `json:"nearlyExhaustedThreshold,omitempty"`
+	// public pools hold the addresses of FloatingIPs and only theirs, pods
+	// and VirtualMachines never take an address from them.
+	// +optional
+	Public bool `json:"public,omitempty"`
+}
+
+// ReleasePolicy describes what happens to an address when its workload is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;RetainFor
+type ReleasePolicy string
+
+const (
+	// ReleasePolicyDelete returns the address to its pool as soon as the workload is deleted.
+	ReleasePolicyDelete ReleasePolicy = "Delete"
+	// ReleasePolicyRetain keeps the address for a workload recreated with the same name
+	// until an admin clears the resource of its ClusterIP.
+	ReleasePolicyRetain ReleasePolicy = "Retain"
+	// ReleasePolicyRetainFor keeps the address for the same name during retainFor.
+	ReleasePolicyRetainFor ReleasePolicy = "RetainFor"
+)
+
+const (
+	// ReleasePolicyAnnotation on a Pod or VirtualMachine overrides the release policy of its pool.
+	ReleasePolicyAnnotation = "ipam.histack.ir/release-policy"
+	// RetainForAnnotation on a Pod or VirtualMachine overrides the retainFor of its pool.
+	RetainForAnnotation = "ipam.histack.ir/retain-for"
+)
+
+// ClusterIPPoolDeletionPolicy describes how a ClusterIPPool is deleted.
+// +kubebuilder:validation:Enum=Block;Cascade
+type ClusterIPPoolDeletionPolicy string
+
+const (
+	// ClusterIPPoolDeletionBlock keeps the pool until none of its ClusterIPs is bound.
+	ClusterIPPoolDeletionBlock ClusterIPPoolDeletionPolicy = "Block"
+	// ClusterIPPoolDeletionCascade releases and deletes the ClusterIPs of the pool.
+	ClusterIPPoolDeletionCascade ClusterIPPoolDeletionPolicy = "Cascade"
+)
+
+// ClusterIPPoolFinalizer holds a ClusterIPPool until its ClusterIPs are gone.
+const ClusterIPPoolFinalizer = "ipam.histack.ir/clusterippool-protection"
+
+// ReleasedClusterIP references a ClusterIP of the pool that is free for reuse.
+type ReleasedClusterIP struct {
+	// name of the released ClusterIP.
+	Name string `json:"name"`
+	// address held by the released ClusterIP.
+	// +optional
+	Address string `json:"address,omitempty"`
+}
+
+// ClusterIPPoolStatus defines the observed state of ClusterIPPool.
+type ClusterIPPoolStatus struct {
+	// conditions represent the current state of the ClusterIPPool resource.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// totalIPs is the number of usable addresses in the cidr.
+	// +optional
+	TotalIPs *resource.Quantity `json:"totalIPs,omitempty"`
+	// allocatedIPs is the number of addresses handed out from the pool.
+	// +optional
+	AllocatedIPs *resource.Quantity `json:"allocatedIPs,omitempty"`
+	// freeIPs is the number of addresses left in the pool.
+	// +optional
+	FreeIPs *resource.Quantity `json:"freeIPs,omitempty"`
+	// nextIndex is the index of the next never-used address in the cidr.
+	// +optional
+	NextIndex *resource.Quantity `json:"nextIndex,omitempty"`
+	// releasedClusterIPs are reused before new addresses are taken from the cidr.
+	// +optional
+	ReleasedClusterIPs []ReleasedClusterIP `json:"releasedClusterIPs,omitempty"`
+	// deletionBlockers are the bound ClusterIPs keeping a deleted pool around.
+	// +optional
+	DeletionBlockers []string `json:"deletionBlockers,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Family",type=string,JSONPath=.spec.ipFamily
+// +kubebuilder:printcolumn:name="CIDR",type=string,JSONPath=.spec.cidr
+// +kubebuilder:printcolumn:name="Allocated",type=string,JSONPath=.status.allocatedIPs
+// +kubebuilder:printcolumn:name="Free",type=string,JSONPath=.status.freeIPs
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=.metadata.creationTimestamp
+// +kubebuilder:selectablefield:JSONPath=.spec.ipFamily
+type ClusterIPPool struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of ClusterIPPool
+	// +required
+	Spec ClusterIPPoolSpec `json:"spec"`
+
+	// status defines the observed state of ClusterIPPool
+	// +optional
+	Status ClusterIPPoolStatus `json:"status,omitempty,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterIPPoolList contains a list of ClusterIPPool
+type ClusterIPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterIPPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterIPPool{}, &ClusterIPPoolList{})
+}
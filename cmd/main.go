@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
@@ -36,7 +37,14 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	ipamv1beta1 "github.com/hicompute/histack/api/v1beta1"
 	"github.com/hicompute/histack/internal/controller"
+	webhookv1alpha1 "github.com/hicompute/histack/internal/webhook/v1alpha1"
+	webhookv1beta1 "github.com/hicompute/histack/internal/webhook/v1beta1"
+	"github.com/hicompute/histack/pkg/credentials"
+	"github.com/hicompute/histack/pkg/metrics"
+	netutils "github.com/hicompute/histack/pkg/net_utils"
+	"github.com/hicompute/histack/pkg/ovn"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,6 +57,7 @@ func init() {
 	utilruntime.Must(kubevirtv1.AddToScheme(scheme))
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(ipamv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(ipamv1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -61,6 +70,11 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var podCIDRs, serviceCIDRs string
+	var defaultPoolGateway bool
+	var ovnNBAddress, floatingIPRouter string
+	var credentialStore, vaultAddress, vaultMount, vaultPrefix string
+	var suspendMismatchedPorts bool
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -79,6 +93,25 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&podCIDRs, "pod-cidrs", "", "Comma separated pod networks of the cluster. ClusterIPPools may not overlap them.")
+	flag.StringVar(&serviceCIDRs, "service-cidrs", "",
+		"Comma separated service networks of the cluster. ClusterIPPools may not overlap them.")
+	flag.BoolVar(&defaultPoolGateway, "default-pool-gateway", false,
+		"If set, ClusterIPPools created without a gateway get the first usable address of their cidr.")
+	flag.StringVar(&ovnNBAddress, "ovn-nb-address", "",
+		"The OVN northbound database, e.g. tcp:10.0.0.1:6641. FloatingIPs are only reconciled when it is set.")
+	flag.StringVar(&floatingIPRouter, "floating-ip-router", "public-router",
+		"The OVN logical router carrying the NAT of FloatingIPs.")
+	flag.BoolVar(&suspendMismatchedPorts, "suspend-mismatched-ports", false,
+		"If set, the OVN port of a VM interface the guest configured with an address other than its ClusterIP "+
+			"is disabled until the guest uses its own address. Needs --ovn-nb-address.")
+	flag.StringVar(&credentialStore, "credential-store", "secret",
+		"Where VM credentials are kept: secret, or vault to keep them in Vault and project them into secrets "+
+			"only while the VM runs.")
+	flag.StringVar(&vaultAddress, "vault-address", os.Getenv("VAULT_ADDR"),
+		"The Vault server of the vault credential store. Its token is read from VAULT_TOKEN.")
+	flag.StringVar(&vaultMount, "vault-mount", "secret", "The path the KV version 2 secrets engine is mounted at in Vault.")
+	flag.StringVar(&vaultPrefix, "vault-prefix", "histack", "The path of VM credentials in the Vault secrets engine.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -178,17 +211,60 @@ func main() {
 		os.Exit(1)
 	}
 
+	metrics.RegisterIPAMMetrics()
+
+	clusterPodCIDRs, err := netutils.ParseCIDRList(podCIDRs)
+	if err != nil {
+		setupLog.Error(err, "invalid --pod-cidrs")
+		os.Exit(1)
+	}
+	clusterServiceCIDRs, err := netutils.ParseCIDRList(serviceCIDRs)
+	if err != nil {
+		setupLog.Error(err, "invalid --service-cidrs")
+		os.Exit(1)
+	}
+
+	if err := controller.SetupIndexes(context.Background(), mgr); err != nil {
+		setupLog.Error(err, "unable to set up field indexes")
+		os.Exit(1)
+	}
+
 	if err := (&controller.ClusterIPPoolReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Recorder:     mgr.GetEventRecorderFor("clusterippool-controller"),
+		PodCIDRs:     clusterPodCIDRs,
+		ServiceCIDRs: clusterServiceCIDRs,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterIPPool")
 		os.Exit(1)
 	}
 
+	var vmCredentials credentials.Store
+	switch credentialStore {
+	case "secret":
+		vmCredentials = &credentials.SecretStore{Client: mgr.GetClient(), Reader: mgr.GetAPIReader()}
+	case "vault":
+		if vaultAddress == "" || os.Getenv("VAULT_TOKEN") == "" {
+			setupLog.Error(nil, "the vault credential store needs --vault-address and VAULT_TOKEN")
+			os.Exit(1)
+		}
+		vmCredentials = &credentials.VaultStore{
+			Address: vaultAddress,
+			Token:   os.Getenv("VAULT_TOKEN"),
+			Mount:   vaultMount,
+			Prefix:  vaultPrefix,
+		}
+	default:
+		setupLog.Error(nil, "invalid --credential-store", "credential-store", credentialStore)
+		os.Exit(1)
+	}
+
 	if err := (&controller.KubeVirtVMReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		APIReader:   mgr.GetAPIReader(),
+		Credentials: vmCredentials,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KubeVirtVM")
 		os.Exit(1)
@@ -200,13 +276,81 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterIP")
 		os.Exit(1)
 	}
-	if err := (&controller.KubevirtVMIReconciler{
+	if err := (&controller.PodReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Pod")
+		os.Exit(1)
+	}
+	if err := (&controller.IPClaimReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "IPClaim")
+		os.Exit(1)
+	}
+	var ovnAgent *ovn.OVNagent
+	if ovnNBAddress != "" {
+		ovnAgent, err = ovn.CreateOVNagent(ovnNBAddress)
+		if err != nil {
+			setupLog.Error(err, "unable to connect to the OVN northbound database")
+			os.Exit(1)
+		}
+		defer ovnAgent.Close()
+		if err := (&controller.FloatingIPReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			NAT:    ovnAgent,
+			Router: floatingIPRouter,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "FloatingIP")
+			os.Exit(1)
+		}
+	} else {
+		setupLog.Info("--ovn-nb-address is not set, FloatingIPs will not be reconciled")
+	}
+	vmiReconciler := &controller.KubevirtVMIReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("virtualmachineinstance-controller"),
+	}
+	if suspendMismatchedPorts {
+		if ovnAgent == nil {
+			setupLog.Error(nil, "--suspend-mismatched-ports needs --ovn-nb-address")
+			os.Exit(1)
+		}
+		vmiReconciler.Ports = ovnAgent
+	}
+	if err := vmiReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KubevirtVMI")
 		os.Exit(1)
 	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookv1alpha1.SetupClusterIPPoolWebhookWithManager(mgr, clusterPodCIDRs, clusterServiceCIDRs,
+			defaultPoolGateway); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterIPPool")
+			os.Exit(1)
+		}
+		if err := webhookv1alpha1.SetupClusterIPWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterIP")
+			os.Exit(1)
+		}
+		if err := webhookv1alpha1.SetupVirtualMachineWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "VirtualMachine")
+			os.Exit(1)
+		}
+		if err := webhookv1beta1.SetupClusterIPPoolWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterIPPool")
+			os.Exit(1)
+		}
+		if err := webhookv1beta1.SetupClusterIPWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterIP")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -2,16 +2,38 @@ package main
 
 import (
 	"flag"
+	"net/http"
+	"os"
 
 	ovncnid "github.com/hicompute/histack/pkg/daemon/ovn-cni-server"
+	"github.com/hicompute/histack/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/klog/v2"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 func main() {
 	var cniSocketFile string
+	var metricsAddr string
+	var nodeName string
 
 	flag.StringVar(&cniSocketFile, "cni-socket", "/var/run/histack-ovn-cni.sock", "The unix socket file cni daemon should create.")
-	if err := ovncnid.Start(cniSocketFile); err != nil {
+	flag.StringVar(&metricsAddr, "metrics-bind-address", "", "The address serving the IPAM metrics of the daemon, e.g. :9477. Disabled when empty.")
+	flag.StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"),
+		"The node the daemon runs on. Interfaces hotplugged into the running VMIs of the node are plugged when set.")
+	flag.Parse()
+
+	if metricsAddr != "" {
+		metrics.RegisterIPAMMetrics()
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(ctrlmetrics.Registry, promhttp.HandlerOpts{}))
+			if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+				klog.Errorf("Error on serving metrics: %v", err)
+			}
+		}()
+	}
+	if err := ovncnid.Start(cniSocketFile, nodeName); err != nil {
 		klog.Fatalf("Error on starting ovn cni daemon: %v", err)
 	}
 }
@@ -18,8 +18,9 @@ func main() {
 	runtime.LockOSThread()
 
 	funcs := skel.CNIFuncs{
-		Add: cmdAdd,
-		Del: cmdDel,
+		Add:   cmdAdd,
+		Del:   cmdDel,
+		Check: cmdCheck,
 	}
 
 	skel.PluginMainFuncs(funcs, version.All, "ik8s-ovn")
@@ -41,6 +42,11 @@ func cmdDel(args *skel.CmdArgs) error {
 	return nil
 }
 
+func cmdCheck(args *skel.CmdArgs) error {
+	_, err := runOnDaemon("Check", args)
+	return err
+}
+
 func runOnDaemon(CMD string, args *skel.CmdArgs) (*current.Result, error) {
 	cniDsocket := "/var/run/histack-ovn-cni.sock"
 	var resp ovnCniTypes.CNIResponse
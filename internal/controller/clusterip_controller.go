@@ -18,11 +18,13 @@ package controller
 
 import (
 	"context"
-	"math/big"
+	"slices"
+	"time"
 
 	"github.com/hicompute/histack/api/v1alpha1"
 	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
-	helper "github.com/hicompute/histack/pkg/helpers"
+	"github.com/hicompute/histack/pkg/ipam"
+	"github.com/hicompute/histack/pkg/metrics"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -52,7 +54,17 @@ func (r *ClusterIPReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	log := logf.FromContext(ctx)
 	var clusterIP v1alpha1.ClusterIP
 	if err := r.Client.Get(ctx, client.ObjectKey{Name: req.Name}, &clusterIP); err != nil {
-		return ctrl.Result{}, err
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if until := clusterIP.Status.RetainedUntil; until != nil && clusterIP.Spec.ResourceUID == "" {
+		if remaining := time.Until(until.Time); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+		log.Info("Retention expired, releasing ClusterIP", "clusterip", clusterIP.Name, "resource", clusterIP.Spec.Resource)
+		if err := ipam.ReleaseClusterIP(ctx, r.Client, &clusterIP, *until); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	if clusterIP.Spec.Mac == "" && clusterIP.Spec.Resource == "" {
@@ -61,21 +73,16 @@ func (r *ClusterIPReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		if err := r.Client.Get(ctx, client.ObjectKey{Name: clusterIP.Spec.ClusterIPPool}, &clusterIPPool); err != nil {
 			return ctrl.Result{}, err
 		}
+		if slices.Contains(clusterIPPool.Status.ReleasedClusterIPs, clusterIP.GetName()) {
+			return ctrl.Result{}, nil
+		}
+		// the pool controller recounts the free and allocated addresses.
 		pool := clusterIPPool.DeepCopy()
 		pool.Status.ReleasedClusterIPs = append(pool.Status.ReleasedClusterIPs, clusterIP.GetName())
-
-		freeIPs := helper.StringToBigInt(pool.Status.FreeIPs)
-		allocatedIps := helper.StringToBigInt(pool.Status.AllocatedIPs)
-
-		freeIPs.Add(freeIPs, big.NewInt(1))
-		allocatedIps.Sub(allocatedIps, big.NewInt(1))
-
-		pool.Status.FreeIPs = freeIPs.String()
-		pool.Status.AllocatedIPs = allocatedIps.String()
-
 		if err := r.Client.Status().Update(ctx, pool); err != nil {
-			log.Error(err, "update cluster ip pool failed.")
+			return ctrl.Result{}, err
 		}
+		metrics.Releases.WithLabelValues(pool.Name).Inc()
 	}
 	return ctrl.Result{}, nil
 }
@@ -17,7 +17,16 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
 )
 
 var _ = Describe("ClusterIP Controller", func() {
@@ -29,4 +38,63 @@ var _ = Describe("ClusterIP Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When a retained ClusterIP expires", func() {
+		const poolName = "retention-pool"
+
+		ctx := context.Background()
+		clusterIPKey := types.NamespacedName{Name: "retention-pool-cip"}
+
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.20.0.0/24",
+				},
+			})).To(Succeed())
+			cip := &ipamv1alpha1.ClusterIP{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterIPKey.Name},
+				Spec: ipamv1alpha1.ClusterIPSpec{
+					ClusterIPPool: poolName,
+					Address:       "10.20.0.5",
+					Family:        "v4",
+					Mac:           "02:00:00:00:00:05",
+					Interface:     "eth0",
+					Resource:      "default/pod1",
+					ResourceKind:  "Pod",
+				},
+			}
+			Expect(k8sClient.Create(ctx, cip)).To(Succeed())
+			cip.Status.RetainedUntil = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+			Expect(k8sClient.Status().Update(ctx, cip)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIP{ObjectMeta: metav1.ObjectMeta{Name: clusterIPKey.Name}})).To(Succeed())
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIPPool{ObjectMeta: metav1.ObjectMeta{Name: poolName}})).To(Succeed())
+		})
+
+		It("should release the address back to its pool", func() {
+			controllerReconciler := &ClusterIPReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: clusterIPKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, clusterIPKey, cip)).To(Succeed())
+			Expect(cip.Spec.Resource).To(BeEmpty())
+			Expect(cip.Status.RetainedUntil).To(BeNil())
+			Expect(cip.Status.History).To(HaveLen(1))
+
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: poolName}, pool)).To(Succeed())
+			Expect(pool.Status.ReleasedClusterIPs).To(ContainElement(clusterIPKey.Name))
+			// the counters are left to the pool controller.
+			Expect(pool.Status.FreeIPs).To(BeEmpty())
+			Expect(pool.Status.AllocatedIPs).To(BeEmpty())
+		})
+	})
 })
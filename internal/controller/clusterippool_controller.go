@@ -19,17 +19,29 @@ package controller
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"net"
 	"reflect"
+	"sort"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/hicompute/histack/api/v1alpha1"
 	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	helper "github.com/hicompute/histack/pkg/helpers"
+	"github.com/hicompute/histack/pkg/metrics"
 	netutils "github.com/hicompute/histack/pkg/net_utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -37,12 +49,17 @@ import (
 // ClusterIPPoolReconciler reconciles a ClusterIPPool object
 type ClusterIPPoolReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// PodCIDRs and ServiceCIDRs are the cluster networks pools are checked against.
+	PodCIDRs     []*net.IPNet
+	ServiceCIDRs []*net.IPNet
 }
 
 // +kubebuilder:rbac:groups=ipam.histack.ir,resources=clusterippools,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=ipam.histack.ir,resources=clusterippools/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=ipam.histack.ir,resources=clusterippools/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -59,38 +76,309 @@ func (r *ClusterIPPoolReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	// TODO(user): your logic here
 	var pool v1alpha1.ClusterIPPool
 	if err := r.Get(ctx, req.NamespacedName, &pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.DeletePoolAddresses(req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	if !pool.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, &pool)
+	}
+	if controllerutil.AddFinalizer(&pool, ipamv1alpha1.ClusterIPPoolFinalizer) {
+		if err := r.Update(ctx, &pool); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	newStatus := pool.Status.DeepCopy()
 	_, ipnet, err := net.ParseCIDR(pool.Spec.CIDR)
 	if err != nil {
 		// Set a degraded condition
-		meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
 			Type:    "Ready",
 			Status:  metav1.ConditionFalse,
 			Reason:  "InvalidCIDR",
 			Message: fmt.Sprintf("Invalid CIDR: %v", err),
 		})
-		_ = r.Status().Update(ctx, &pool)
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, r.updateStatus(ctx, &pool, newStatus)
 	}
-	totalIPs := netutils.CountUsableIPs(ipnet)
-	newStatus := pool.Status.DeepCopy()
-	newStatus.TotalIPs = totalIPs.String()
-	newStatus.FreeIPs = totalIPs.String()
+
+	usage, err := r.countAddresses(ctx, &pool, ipnet)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	total, _ := new(big.Float).SetInt(usage.total).Float64()
+	free, _ := new(big.Float).SetInt(usage.free).Float64()
+	metrics.SetPoolAddresses(pool.Name, total, float64(usage.allocated), free,
+		float64(len(pool.Status.ReleasedClusterIPs)), float64(usage.quarantined))
+	newStatus.TotalIPs = usage.total.String()
+	newStatus.FreeIPs = usage.free.String()
+	newStatus.AllocatedIPs = big.NewInt(usage.allocated).String()
+
+	overlaps, err := r.findOverlaps(ctx, &pool, ipnet)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	setPoolConditions(newStatus, &pool, usage, overlaps)
+	r.recordThresholdEvents(&pool, newStatus)
+	return ctrl.Result{}, r.updateStatus(ctx, &pool, newStatus)
+}
+
+// poolUsage counts the addresses of a pool.
+type poolUsage struct {
+	total *big.Int
+	free  *big.Int
+	// allocated addresses are bound to a workload.
+	allocated int64
+	// quarantined addresses are retained by their release policy for a deleted workload.
+	quarantined int64
+}
+
+// countAddresses counts the ClusterIPs of a pool. Free addresses are counted
+// the way they are allocated: the indexes not handed out yet and the released
+// ClusterIPs that still exist. The gateway is never handed out, so it is not
+// free.
+func (r *ClusterIPPoolReconciler) countAddresses(ctx context.Context, pool *ipamv1alpha1.ClusterIPPool, ipnet *net.IPNet) (*poolUsage, error) {
+	var clusterIPs ipamv1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPs, client.MatchingFields{clusterIPPoolField: pool.Name}); err != nil {
+		return nil, err
+	}
+	usage := &poolUsage{total: netutils.CountUsableIPs(ipnet)}
+	released := map[string]bool{}
+	for _, clusterIP := range clusterIPs.Items {
+		switch {
+		case clusterIP.Spec.ResourceKind != "" && clusterIP.Spec.ResourceUID == "" && clusterIP.Spec.Resource != "":
+			usage.quarantined++
+		case clusterIP.Spec.Mac != "":
+			usage.allocated++
+		case clusterIP.DeletionTimestamp.IsZero():
+			released[clusterIP.Name] = true
+		}
+	}
+	gateway := net.ParseIP(pool.Spec.Gateway)
+	if gateway != nil && !ipnet.Contains(gateway) {
+		gateway = nil
+	}
+
+	// the last index is never handed out, allocation reuses released
+	// addresses once the next index reaches it.
+	last := new(big.Int).Sub(usage.total, big.NewInt(2))
+	next := helper.StringToBigInt(pool.Status.NextIndex)
+	usage.free = new(big.Int).Sub(last, next)
+	usage.free.Add(usage.free, big.NewInt(1))
+	if usage.free.Sign() > 0 && gateway != nil && indexRangeContains(pool.Spec.CIDR, next, last, gateway) {
+		usage.free.Sub(usage.free, big.NewInt(1))
+	}
+	if usage.free.Sign() < 0 {
+		usage.free.SetInt64(0)
+	}
+	for _, name := range pool.Status.ReleasedClusterIPs {
+		if released[name] {
+			usage.free.Add(usage.free, big.NewInt(1))
+		}
+	}
+
+	// ClusterIPs created outside of allocation take addresses too.
+	unused := new(big.Int).Sub(usage.total, big.NewInt(usage.allocated+usage.quarantined))
+	if gateway != nil {
+		unused.Sub(unused, big.NewInt(1))
+	}
+	if unused.Cmp(usage.free) < 0 {
+		usage.free = unused
+	}
+	if usage.free.Sign() < 0 {
+		usage.free.SetInt64(0)
+	}
+	return usage, nil
+}
+
+// indexRangeContains reports whether ip is one of the addresses of the cidr
+// from index first to index last.
+func indexRangeContains(cidr string, first, last *big.Int, ip net.IP) bool {
+	from, err := netutils.PickUsableIPFromCIDRIndex(cidr, first)
+	if err != nil {
+		return false
+	}
+	to, err := netutils.PickUsableIPFromCIDRIndex(cidr, last)
+	if err != nil {
+		return false
+	}
+	value := new(big.Int).SetBytes(ip.To16())
+	return value.Cmp(new(big.Int).SetBytes(net.ParseIP(from).To16())) >= 0 &&
+		value.Cmp(new(big.Int).SetBytes(net.ParseIP(to).To16())) <= 0
+}
+
+// findOverlaps returns the other pools and cluster networks overlapping the pool.
+func (r *ClusterIPPoolReconciler) findOverlaps(ctx context.Context, pool *ipamv1alpha1.ClusterIPPool, ipnet *net.IPNet) ([]string, error) {
+	var overlaps []string
+	for _, c := range r.PodCIDRs {
+		if netutils.CIDRsOverlap(ipnet, c) {
+			overlaps = append(overlaps, fmt.Sprintf("pod network %s", c))
+		}
+	}
+	for _, c := range r.ServiceCIDRs {
+		if netutils.CIDRsOverlap(ipnet, c) {
+			overlaps = append(overlaps, fmt.Sprintf("service network %s", c))
+		}
+	}
+
+	var pools ipamv1alpha1.ClusterIPPoolList
+	if err := r.List(ctx, &pools); err != nil {
+		return nil, err
+	}
+	for _, other := range pools.Items {
+		if other.Name == pool.Name {
+			continue
+		}
+		if _, otherNet, err := net.ParseCIDR(other.Spec.CIDR); err == nil && netutils.CIDRsOverlap(ipnet, otherNet) {
+			overlaps = append(overlaps, fmt.Sprintf("ClusterIPPool %s (%s)", other.Name, other.Spec.CIDR))
+		}
+	}
+	sort.Strings(overlaps)
+	return overlaps, nil
+}
+
+// setPoolConditions sets the Ready, Overlapping, NearlyExhausted and Exhausted conditions.
+func setPoolConditions(status *ipamv1alpha1.ClusterIPPoolStatus, pool *ipamv1alpha1.ClusterIPPool, usage *poolUsage, overlaps []string) {
+	if len(overlaps) > 0 {
+		message := fmt.Sprintf("%s overlaps %s", pool.Spec.CIDR, strings.Join(overlaps, ", "))
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "Overlapping", Status: metav1.ConditionTrue, Reason: "CIDROverlap", Message: message,
+		})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "Ready", Status: metav1.ConditionFalse, Reason: "Overlapping", Message: message,
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "Overlapping", Status: metav1.ConditionFalse, Reason: "NoOverlap",
+			Message: fmt.Sprintf("%s overlaps no other network", pool.Spec.CIDR),
+		})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "Ready", Status: metav1.ConditionTrue, Reason: "Available",
+			Message: fmt.Sprintf("%s has %s usable addresses", pool.Spec.CIDR, usage.total),
+		})
+	}
+
+	threshold := int64(pool.Spec.NearlyExhaustedThreshold)
+	if threshold <= 0 {
+		threshold = 90
+	}
+	used := new(big.Int).Sub(usage.total, usage.free)
+	// used/total >= threshold%, without rounding.
+	nearlyExhausted := new(big.Int).Mul(used, big.NewInt(100)).Cmp(new(big.Int).Mul(usage.total, big.NewInt(threshold))) >= 0
+	usageMessage := fmt.Sprintf("%s of %s addresses in use, %s free", used, usage.total, usage.free)
+	if nearlyExhausted {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "NearlyExhausted", Status: metav1.ConditionTrue, Reason: "ThresholdReached",
+			Message: fmt.Sprintf("%s, at or above the threshold of %d%%", usageMessage, threshold),
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "NearlyExhausted", Status: metav1.ConditionFalse, Reason: "BelowThreshold",
+			Message: fmt.Sprintf("%s, below the threshold of %d%%", usageMessage, threshold),
+		})
+	}
+	if usage.free.Sign() == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "Exhausted", Status: metav1.ConditionTrue, Reason: "NoFreeAddress", Message: usageMessage,
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: "Exhausted", Status: metav1.ConditionFalse, Reason: "FreeAddressesAvailable", Message: usageMessage,
+		})
+	}
+}
+
+// recordThresholdEvents warns when a condition on-call should know about turns true.
+func (r *ClusterIPPoolReconciler) recordThresholdEvents(pool *ipamv1alpha1.ClusterIPPool, newStatus *ipamv1alpha1.ClusterIPPoolStatus) {
+	if r.Recorder == nil {
+		return
+	}
+	for _, conditionType := range []string{"NearlyExhausted", "Exhausted", "Overlapping"} {
+		condition := meta.FindStatusCondition(newStatus.Conditions, conditionType)
+		if condition == nil || condition.Status != metav1.ConditionTrue || meta.IsStatusConditionTrue(pool.Status.Conditions, conditionType) {
+			continue
+		}
+		r.Recorder.Event(pool, corev1.EventTypeWarning, conditionType, condition.Message)
+	}
+}
+
+func (r *ClusterIPPoolReconciler) updateStatus(ctx context.Context, pool *ipamv1alpha1.ClusterIPPool, newStatus *ipamv1alpha1.ClusterIPPoolStatus) error {
 	if reflect.DeepEqual(&pool.Status, newStatus) {
-		return ctrl.Result{}, nil // no changes
+		return nil // no changes
 	}
 	pool.Status = *newStatus
-	if err := r.Status().Update(ctx, &pool); err != nil {
+	return r.Status().Update(ctx, pool)
+}
+
+// reconcileDelete holds the finalizer while bound ClusterIPs still use the pool.
+// With the Cascade policy they are released and deleted instead.
+func (r *ClusterIPPoolReconciler) reconcileDelete(ctx context.Context, pool *ipamv1alpha1.ClusterIPPool) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(pool, ipamv1alpha1.ClusterIPPoolFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	var clusterIPs ipamv1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPs, client.MatchingFields{clusterIPPoolField: pool.Name}); err != nil {
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+
+	var blockers []string
+	for i := range clusterIPs.Items {
+		clusterIP := &clusterIPs.Items[i]
+		if clusterIP.Spec.Mac != "" && pool.Spec.DeletionPolicy != ipamv1alpha1.ClusterIPPoolDeletionCascade {
+			blockers = append(blockers, clusterIP.Name)
+			continue
+		}
+		if !clusterIP.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// Release before deleting, the ClusterIP webhook refuses to delete
+		// addresses still pointing at a live workload.
+		if clusterIP.Spec.Mac != "" || clusterIP.Spec.Interface != "" || clusterIP.Spec.Resource != "" {
+			clusterIP.Spec.Mac = ""
+			clusterIP.Spec.Interface = ""
+			clusterIP.Spec.Resource = ""
+			if err := r.Update(ctx, clusterIP); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if err := r.Delete(ctx, clusterIP); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		log.Info("Deleted ClusterIP of deleted pool", "clusterip", clusterIP.Name, "pool", pool.Name)
+	}
+
+	if len(blockers) > 0 {
+		sort.Strings(blockers)
+		newStatus := pool.Status.DeepCopy()
+		newStatus.DeletionBlockers = blockers
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+			Type:    "DeletionBlocked",
+			Status:  metav1.ConditionTrue,
+			Reason:  "BoundClusterIPs",
+			Message: fmt.Sprintf("%d ClusterIPs are still bound: %s", len(blockers), strings.Join(blockers, ", ")),
+		})
+		if reflect.DeepEqual(&pool.Status, newStatus) {
+			return ctrl.Result{}, nil
+		}
+		pool.Status = *newStatus
+		// Released ClusterIPs requeue the pool through the ClusterIP watch.
+		return ctrl.Result{}, r.Status().Update(ctx, pool)
+	}
+
+	controllerutil.RemoveFinalizer(pool, ipamv1alpha1.ClusterIPPoolFinalizer)
+	return ctrl.Result{}, r.Update(ctx, pool)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ClusterIPPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ipamv1alpha1.ClusterIPPool{}).
+		Watches(&ipamv1alpha1.ClusterIP{}, handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+			cip := obj.(*ipamv1alpha1.ClusterIP)
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: cip.Spec.ClusterIPPool}}}
+		})).
 		Named("clusterippool").
 		Complete(r)
 }
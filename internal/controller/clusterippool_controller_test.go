@@ -18,16 +18,23 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"net"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/metrics"
 )
 
 var _ = Describe("ClusterIPPool Controller", func() {
@@ -81,4 +88,228 @@ var _ = Describe("ClusterIPPool Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When deleting a pool with bound ClusterIPs", func() {
+		const poolName = "deletion-pool"
+
+		ctx := context.Background()
+		poolKey := types.NamespacedName{Name: poolName}
+		clusterIPKey := types.NamespacedName{Name: "deletion-pool-cip"}
+
+		var controllerReconciler *ClusterIPPoolReconciler
+
+		BeforeEach(func() {
+			controllerReconciler = &ClusterIPPoolReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.10.0.0/24",
+				},
+			})).To(Succeed())
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterIPKey.Name},
+				Spec: ipamv1alpha1.ClusterIPSpec{
+					ClusterIPPool: poolName,
+					Address:       "10.10.0.5",
+					Family:        "v4",
+					Mac:           "02:00:00:00:00:05",
+					Interface:     "eth0",
+					Resource:      "default/vm1",
+				},
+			})).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: poolKey})
+			Expect(err).NotTo(HaveOccurred())
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, poolKey, pool)).To(Succeed())
+			Expect(pool.Finalizers).To(ContainElement(ipamv1alpha1.ClusterIPPoolFinalizer))
+			Expect(k8sClient.Delete(ctx, pool)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cip := &ipamv1alpha1.ClusterIP{}
+			if err := k8sClient.Get(ctx, clusterIPKey, cip); err == nil {
+				Expect(k8sClient.Delete(ctx, cip)).To(Succeed())
+			}
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			if err := k8sClient.Get(ctx, poolKey, pool); err == nil {
+				pool.Finalizers = nil
+				Expect(k8sClient.Update(ctx, pool)).To(Succeed())
+			}
+		})
+
+		It("should keep the pool and report the blockers", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: poolKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, poolKey, pool)).To(Succeed())
+			Expect(pool.Status.DeletionBlockers).To(Equal([]string{clusterIPKey.Name}))
+			Expect(meta.IsStatusConditionTrue(pool.Status.Conditions, "DeletionBlocked")).To(BeTrue())
+		})
+
+		It("should release and delete the ClusterIPs with the Cascade policy", func() {
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, poolKey, pool)).To(Succeed())
+			pool.Spec.DeletionPolicy = ipamv1alpha1.ClusterIPPoolDeletionCascade
+			Expect(k8sClient.Update(ctx, pool)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: poolKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, clusterIPKey, &ipamv1alpha1.ClusterIP{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, poolKey, &ipamv1alpha1.ClusterIPPool{}))).To(BeTrue())
+		})
+	})
+
+	Context("When counting the addresses of a pool", func() {
+		const poolName = "metrics-pool"
+
+		ctx := context.Background()
+		poolKey := types.NamespacedName{Name: poolName}
+
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.60.0.0/29",
+				},
+			})).To(Succeed())
+			for _, cip := range []struct {
+				name, address, mac string
+				uid                types.UID
+			}{
+				// a retained ClusterIP has no uid.
+				{"metrics-pool-bound", "10.60.0.2", "02:00:00:00:60:02", "vm-uid"},
+				{"metrics-pool-retained", "10.60.0.3", "02:00:00:00:60:03", ""},
+			} {
+				Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+					ObjectMeta: metav1.ObjectMeta{Name: cip.name},
+					Spec: ipamv1alpha1.ClusterIPSpec{
+						ClusterIPPool: poolName,
+						Address:       cip.address,
+						Family:        "v4",
+						Mac:           cip.mac,
+						Interface:     "eth0",
+						Resource:      "default/" + cip.name,
+						ResourceKind:  "VirtualMachine",
+						ResourceUID:   cip.uid,
+					},
+				})).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			for _, name := range []string{"metrics-pool-bound", "metrics-pool-retained"} {
+				Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIP{ObjectMeta: metav1.ObjectMeta{Name: name}})).To(Succeed())
+			}
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, poolKey, pool)).To(Succeed())
+			pool.Finalizers = nil
+			Expect(k8sClient.Update(ctx, pool)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pool)).To(Succeed())
+		})
+
+		It("should export the address gauges", func() {
+			controllerReconciler := &ClusterIPPoolReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: poolKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(testutil.ToFloat64(metrics.PoolTotalAddresses.WithLabelValues(poolName))).To(Equal(6.0))
+			Expect(testutil.ToFloat64(metrics.PoolAllocatedAddresses.WithLabelValues(poolName))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(metrics.PoolQuarantinedAddresses.WithLabelValues(poolName))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(metrics.PoolFreeAddresses.WithLabelValues(poolName))).To(Equal(4.0))
+		})
+	})
+
+	Context("When a pool runs out of addresses", func() {
+		const poolName = "conditions-pool"
+
+		ctx := context.Background()
+		poolKey := types.NamespacedName{Name: poolName}
+		clusterIPNames := []string{"conditions-pool-a", "conditions-pool-b"}
+
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.61.0.0/30",
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			for _, name := range clusterIPNames {
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIP{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+				}))).To(Succeed())
+			}
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, poolKey, pool)).To(Succeed())
+			pool.Finalizers = nil
+			Expect(k8sClient.Update(ctx, pool)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pool)).To(Succeed())
+		})
+
+		It("should set the exhaustion and overlap conditions and warn once", func() {
+			recorder := record.NewFakeRecorder(10)
+			_, podNet, _ := net.ParseCIDR("10.61.0.0/16")
+			controllerReconciler := &ClusterIPPoolReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: recorder,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: poolKey})
+			Expect(err).NotTo(HaveOccurred())
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, poolKey, pool)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(pool.Status.Conditions, "Ready")).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(pool.Status.Conditions, "NearlyExhausted")).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(pool.Status.Conditions, "Exhausted")).To(BeTrue())
+			Expect(recorder.Events).To(BeEmpty())
+
+			for i, name := range clusterIPNames {
+				Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+					Spec: ipamv1alpha1.ClusterIPSpec{
+						ClusterIPPool: poolName,
+						Address:       fmt.Sprintf("10.61.0.%d", i+1),
+						Family:        "v4",
+						Mac:           fmt.Sprintf("02:00:00:00:61:%02d", i+1),
+						Interface:     "eth0",
+						Resource:      "default/" + name,
+						ResourceKind:  "VirtualMachine",
+						ResourceUID:   types.UID(name + "-uid"),
+					},
+				})).To(Succeed())
+			}
+			controllerReconciler.PodCIDRs = []*net.IPNet{podNet}
+			for range 2 {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: poolKey})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Expect(k8sClient.Get(ctx, poolKey, pool)).To(Succeed())
+			Expect(pool.Status.FreeIPs).To(Equal("0"))
+			Expect(pool.Status.AllocatedIPs).To(Equal("2"))
+			Expect(meta.IsStatusConditionTrue(pool.Status.Conditions, "NearlyExhausted")).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(pool.Status.Conditions, "Exhausted")).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(pool.Status.Conditions, "Overlapping")).To(BeTrue())
+			ready := meta.FindStatusCondition(pool.Status.Conditions, "Ready")
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal("Overlapping"))
+
+			// each threshold is reported once, when it is crossed.
+			Expect(recorder.Events).To(HaveLen(3))
+		})
+	})
 })
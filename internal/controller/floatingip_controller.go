@@ -0,0 +1,321 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/ipam"
+)
+
+// NATProgrammer realises floating addresses as dnat_and_snat NAT on an OVN
+// logical router. It is implemented by ovn.OVNagent.
+type NATProgrammer interface {
+	SetDNATAndSNAT(routerName, externalIP, logicalIP string, externalIDs map[string]string) error
+	DeleteDNATAndSNAT(routerName, externalIP string) error
+}
+
+// FloatingIPReconciler reconciles a FloatingIP object
+type FloatingIPReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	NAT    NATProgrammer
+	// Router is the OVN logical router carrying the NAT of floating addresses.
+	Router string
+}
+
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=floatingips,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=floatingips/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=floatingips/finalizers,verbs=update
+
+// Reconcile allocates the public address of a FloatingIP and points its NAT at
+// the private address of the associated VirtualMachine. Every change of
+// association is recorded in the history of the public ClusterIP.
+func (r *FloatingIPReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	var fip ipamv1alpha1.FloatingIP
+	if err := r.Get(ctx, req.NamespacedName, &fip); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !fip.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.reconcileDelete(ctx, &fip)
+	}
+	if controllerutil.AddFinalizer(&fip, ipamv1alpha1.FloatingIPFinalizer) {
+		if err := r.Update(ctx, &fip); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	newStatus := fip.Status.DeepCopy()
+	clusterIP, pool, err := ipam.NewWithClient(r.Client).BindFloatingIP(ctx, &fip)
+	if apierrors.IsNotFound(err) {
+		newStatus.Phase = ipamv1alpha1.FloatingIPPending
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+			Type:    "Associated",
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoFreeAddress",
+			Message: fmt.Sprintf("ClusterIPPool %s has no free address", fip.Spec.ClusterIPPool),
+		})
+		return ctrl.Result{}, r.updateStatus(ctx, &fip, newStatus)
+	} else if errors.Is(err, ipam.ErrPoolNotPublic) {
+		newStatus.Phase = ipamv1alpha1.FloatingIPPending
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+			Type:    "Associated",
+			Status:  metav1.ConditionFalse,
+			Reason:  "PoolNotPublic",
+			Message: fmt.Sprintf("ClusterIPPool %s is not public", fip.Spec.ClusterIPPool),
+		})
+		return ctrl.Result{}, r.updateStatus(ctx, &fip, newStatus)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	if fip.Status.Address != "" && fip.Status.Address != clusterIP.Spec.Address && fip.Status.LogicalIP != "" {
+		// the previous public address was lost, do not leave its NAT behind.
+		if err := r.NAT.DeleteDNATAndSNAT(r.Router, fip.Status.Address); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	newStatus.ClusterIP = clusterIP.Name
+	newStatus.Address = clusterIP.Spec.Address
+
+	var logicalIP string
+	if fip.Spec.VirtualMachine != "" {
+		if logicalIP, err = r.privateAddress(ctx, &fip, pool.Spec.IPFamily); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if logicalIP == "" {
+		if fip.Status.LogicalIP != "" {
+			if err := r.NAT.DeleteDNATAndSNAT(r.Router, clusterIP.Spec.Address); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else if err := r.NAT.SetDNATAndSNAT(r.Router, clusterIP.Spec.Address, logicalIP, map[string]string{
+		"floatingip":     fip.Namespace + "/" + fip.Name,
+		"virtualMachine": fip.Namespace + "/" + fip.Spec.VirtualMachine,
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	associated := ""
+	if logicalIP != "" {
+		associated = fip.Spec.VirtualMachine
+	}
+	if associated != fip.Status.VirtualMachine {
+		now := metav1.Now()
+		if fip.Status.VirtualMachine != "" && fip.Status.AssociatedAt != nil {
+			if err := ipam.RecordAssociation(ctx, r.Client, clusterIP, fip.Namespace+"/"+fip.Status.VirtualMachine,
+				*fip.Status.AssociatedAt, now); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		newStatus.VirtualMachine = associated
+		newStatus.AssociatedAt = nil
+		if associated != "" {
+			newStatus.AssociatedAt = &now
+		}
+		log.Info("Associated FloatingIP", "address", clusterIP.Spec.Address, "virtualMachine", associated, "logicalIP", logicalIP)
+	}
+	newStatus.LogicalIP = logicalIP
+
+	switch {
+	case logicalIP != "":
+		newStatus.Phase = ipamv1alpha1.FloatingIPAssociated
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+			Type:    "Associated",
+			Status:  metav1.ConditionTrue,
+			Reason:  "NATProgrammed",
+			Message: fmt.Sprintf("%s is translated to %s", clusterIP.Spec.Address, logicalIP),
+		})
+	case fip.Spec.VirtualMachine != "":
+		newStatus.Phase = ipamv1alpha1.FloatingIPAllocated
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+			Type:    "Associated",
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoPrivateAddress",
+			Message: fmt.Sprintf("VirtualMachine %s has no %s address on %s", fip.Spec.VirtualMachine, pool.Spec.IPFamily, fip.Spec.Interface),
+		})
+	default:
+		newStatus.Phase = ipamv1alpha1.FloatingIPAllocated
+		meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+			Type:    "Associated",
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotAssociated",
+			Message: "no virtualMachine is set",
+		})
+	}
+	return ctrl.Result{}, r.updateStatus(ctx, &fip, newStatus)
+}
+
+// reconcileDelete removes the NAT of a deleted FloatingIP and releases its address.
+func (r *FloatingIPReconciler) reconcileDelete(ctx context.Context, fip *ipamv1alpha1.FloatingIP) error {
+	if !controllerutil.ContainsFinalizer(fip, ipamv1alpha1.FloatingIPFinalizer) {
+		return nil
+	}
+	if fip.Status.Address != "" {
+		if err := r.NAT.DeleteDNATAndSNAT(r.Router, fip.Status.Address); err != nil {
+			return err
+		}
+	}
+	if fip.Status.ClusterIP != "" {
+		var clusterIP ipamv1alpha1.ClusterIP
+		err := r.Get(ctx, client.ObjectKey{Name: fip.Status.ClusterIP}, &clusterIP)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if err == nil && clusterIP.Spec.ResourceKind == ipamv1alpha1.FloatingIPKind && clusterIP.Spec.ResourceUID == fip.UID {
+			if fip.Status.VirtualMachine != "" && fip.Status.AssociatedAt != nil {
+				if err := ipam.RecordAssociation(ctx, r.Client, &clusterIP, fip.Namespace+"/"+fip.Status.VirtualMachine,
+					*fip.Status.AssociatedAt, *fip.DeletionTimestamp); err != nil {
+					return err
+				}
+			}
+			logf.FromContext(ctx).Info("Releasing ClusterIP of deleted FloatingIP", "clusterip", clusterIP.Name)
+			if err := ipam.ReleaseClusterIP(ctx, r.Client, &clusterIP, *fip.DeletionTimestamp); err != nil {
+				return err
+			}
+		}
+	}
+	controllerutil.RemoveFinalizer(fip, ipamv1alpha1.FloatingIPFinalizer)
+	return r.Update(ctx, fip)
+}
+
+// privateAddress returns the address of the FloatingIP's VirtualMachine on its
+// interface, taken from an IPClaim of the VirtualMachine when it uses one.
+func (r *FloatingIPReconciler) privateAddress(ctx context.Context, fip *ipamv1alpha1.FloatingIP, family string) (string, error) {
+	iface := fip.Spec.Interface
+	if iface == "" {
+		iface = "eth0"
+	}
+
+	if iface == "eth0" {
+		var vm kubevirtv1.VirtualMachine
+		if err := r.Get(ctx, client.ObjectKey{Namespace: fip.Namespace, Name: fip.Spec.VirtualMachine}, &vm); err != nil {
+			return "", client.IgnoreNotFound(err)
+		}
+		for _, name := range strings.Split(vm.Annotations[ipamv1alpha1.IPClaimAnnotation], ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			var claim ipamv1alpha1.IPClaim
+			if err := r.Get(ctx, client.ObjectKey{Namespace: fip.Namespace, Name: name}, &claim); err != nil {
+				return "", client.IgnoreNotFound(err)
+			}
+			if ipam.ClaimFamily(&claim) == family && claim.Status.Phase == ipamv1alpha1.IPClaimBound {
+				return claim.Status.Address, nil
+			}
+		}
+	}
+
+	var clusterIPs ipamv1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPs, client.MatchingFields{clusterIPResourceField: fip.Namespace + "/" + fip.Spec.VirtualMachine}); err != nil {
+		return "", err
+	}
+	for _, clusterIP := range clusterIPs.Items {
+		if isWorkloadKind(clusterIP.Spec.ResourceKind) && clusterIP.Spec.Interface == iface &&
+			clusterIP.Spec.Family == family && clusterIP.Spec.Mac != "" {
+			return clusterIP.Spec.Address, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *FloatingIPReconciler) updateStatus(ctx context.Context, fip *ipamv1alpha1.FloatingIP, newStatus *ipamv1alpha1.FloatingIPStatus) error {
+	if reflect.DeepEqual(&fip.Status, newStatus) {
+		return nil
+	}
+	fip.Status = *newStatus
+	return r.Status().Update(ctx, fip)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *FloatingIPReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Released ClusterIPs no longer name their VirtualMachine, so both sides
+	// of an update are mapped.
+	clusterIPHandler := handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForClusterIP(ctx, e.Object, q)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForClusterIP(ctx, e.ObjectOld, q)
+			r.enqueueForClusterIP(ctx, e.ObjectNew, q)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			r.enqueueForClusterIP(ctx, e.Object, q)
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ipamv1alpha1.FloatingIP{}).
+		Watches(&ipamv1alpha1.ClusterIP{}, clusterIPHandler).
+		Named("floatingip").
+		Complete(r)
+}
+
+// enqueueForClusterIP requeues the FloatingIP holding a ClusterIP, or the
+// FloatingIPs associated with the VirtualMachine it is bound to.
+func (r *FloatingIPReconciler) enqueueForClusterIP(ctx context.Context, obj client.Object, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	cip := obj.(*ipamv1alpha1.ClusterIP)
+	namespace, name, ok := cutResource(cip.Spec.Resource)
+	if !ok {
+		return
+	}
+	if cip.Spec.ResourceKind == ipamv1alpha1.FloatingIPKind {
+		q.Add(reconcile.Request{NamespacedName: client.ObjectKey{Namespace: namespace, Name: name}})
+		return
+	}
+	if cip.Spec.ResourceKind == ipamv1alpha1.IPClaimKind {
+		// VirtualMachines using the claim are not known, requeue the namespace.
+		name = ""
+	}
+
+	var fips ipamv1alpha1.FloatingIPList
+	if err := r.List(ctx, &fips, client.InNamespace(namespace)); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to list FloatingIPs")
+		return
+	}
+	for _, fip := range fips.Items {
+		if fip.Spec.VirtualMachine != "" && (name == "" || fip.Spec.VirtualMachine == name || fip.Status.VirtualMachine == name) {
+			q.Add(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&fip)})
+		}
+	}
+}
+
+// isWorkloadKind reports whether a ClusterIP resourceKind names a workload,
+// rather than an IPClaim or FloatingIP that holds the address itself.
+func isWorkloadKind(kind string) bool {
+	return kind != ipamv1alpha1.IPClaimKind && kind != ipamv1alpha1.FloatingIPKind
+}
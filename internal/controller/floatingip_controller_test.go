@@ -0,0 +1,158 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/ipam"
+)
+
+// fakeNAT records the NAT of a router by external address.
+type fakeNAT map[string]string
+
+func (f fakeNAT) SetDNATAndSNAT(_, externalIP, logicalIP string, _ map[string]string) error {
+	f[externalIP] = logicalIP
+	return nil
+}
+
+func (f fakeNAT) DeleteDNATAndSNAT(_, externalIP string) error {
+	delete(f, externalIP)
+	return nil
+}
+
+var _ = Describe("FloatingIP Controller", func() {
+	Context("When reconciling a FloatingIP", func() {
+		const poolName = "floatingip-pool"
+
+		ctx := context.Background()
+		fipKey := types.NamespacedName{Namespace: "default", Name: "floatingip-test"}
+
+		var (
+			controllerReconciler *FloatingIPReconciler
+			nat                  fakeNAT
+		)
+
+		createVMAddress := func(vm, address string) {
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "default-" + vm + "-net1"},
+				Spec: ipamv1alpha1.ClusterIPSpec{
+					ClusterIPPool: poolName,
+					Address:       address,
+					Family:        "v4",
+					Mac:           "02:00:00:00:00:" + address[len(address)-2:],
+					Interface:     "net1",
+					Resource:      "default/" + vm,
+					ResourceKind:  "VirtualMachine",
+					ResourceUID:   types.UID(vm + "-uid"),
+				},
+			})).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			nat = fakeNAT{}
+			controllerReconciler = &FloatingIPReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+				NAT:    nat,
+				Router: "public-router",
+			}
+			pool := &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.50.0.0/24",
+					Public:   true,
+				},
+			}
+			Expect(k8sClient.Create(ctx, pool)).To(Succeed())
+			pool.Status.TotalIPs = "254"
+			pool.Status.FreeIPs = "200"
+			pool.Status.AllocatedIPs = "0"
+			pool.Status.NextIndex = "100"
+			Expect(k8sClient.Status().Update(ctx, pool)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			var clusterIPs ipamv1alpha1.ClusterIPList
+			Expect(k8sClient.List(ctx, &clusterIPs)).To(Succeed())
+			for i := range clusterIPs.Items {
+				if clusterIPs.Items[i].Spec.ClusterIPPool == poolName {
+					Expect(k8sClient.Delete(ctx, &clusterIPs.Items[i])).To(Succeed())
+				}
+			}
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIPPool{ObjectMeta: metav1.ObjectMeta{Name: poolName}})).To(Succeed())
+		})
+
+		It("should move the NAT between VirtualMachines and record the history", func() {
+			createVMAddress("vm-a", "10.50.0.11")
+			createVMAddress("vm-b", "10.50.0.12")
+
+			fip := &ipamv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Namespace: fipKey.Namespace, Name: fipKey.Name},
+				Spec: ipamv1alpha1.FloatingIPSpec{
+					ClusterIPPool:  poolName,
+					VirtualMachine: "vm-a",
+					Interface:      "net1",
+				},
+			}
+			Expect(k8sClient.Create(ctx, fip)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: fipKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, fipKey, fip)).To(Succeed())
+			Expect(fip.Status.Phase).To(Equal(ipamv1alpha1.FloatingIPAssociated))
+			Expect(fip.Status.VirtualMachine).To(Equal("vm-a"))
+			Expect(nat).To(Equal(fakeNAT{fip.Status.Address: "10.50.0.11"}))
+			associatedAt := *fip.Status.AssociatedAt
+
+			fip.Spec.VirtualMachine = "vm-b"
+			Expect(k8sClient.Update(ctx, fip)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: fipKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, fipKey, fip)).To(Succeed())
+			Expect(fip.Status.VirtualMachine).To(Equal("vm-b"))
+			Expect(nat).To(Equal(fakeNAT{fip.Status.Address: "10.50.0.12"}))
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: fip.Status.ClusterIP}, cip)).To(Succeed())
+			Expect(cip.Spec.ResourceKind).To(Equal(ipamv1alpha1.FloatingIPKind))
+			Expect(cip.Status.History).NotTo(BeEmpty())
+			Expect(cip.Status.History[len(cip.Status.History)-1].Resource).To(Equal("default/vm-a"))
+
+			// a retry after a failed FloatingIP update records the association once.
+			history := len(cip.Status.History)
+			Expect(ipam.RecordAssociation(ctx, k8sClient, cip, "default/vm-a", associatedAt, metav1.Now())).To(Succeed())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: cip.Name}, cip)).To(Succeed())
+			Expect(cip.Status.History).To(HaveLen(history))
+
+			Expect(k8sClient.Delete(ctx, fip)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: fipKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nat).To(BeEmpty())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: cip.Name}, cip)).To(Succeed())
+			Expect(cip.Spec.Resource).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,92 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+)
+
+const (
+	// clusterIPResourceField indexes ClusterIPs by the namespace/name of their workload.
+	clusterIPResourceField = "spec.resource"
+	// clusterIPPoolField indexes ClusterIPs by their pool.
+	clusterIPPoolField = "spec.clusterIPPool"
+	// clusterIPFamilyField and clusterIPInterfaceField index ClusterIPs by family
+	// and pod interface, pkg/ipam looks the ClusterIP of an interface up with them.
+	clusterIPFamilyField    = "spec.family"
+	clusterIPInterfaceField = "spec.containerInterface"
+	// clusterIPAddressField and clusterIPMacField index ClusterIPs by their
+	// address and MAC in canonical form, the ClusterIP webhook looks
+	// duplicates up with them.
+	clusterIPAddressField = "spec.address"
+	clusterIPMacField     = "spec.mac"
+	// poolIPFamilyField indexes ClusterIPPools by family, pkg/ipam looks pools up with it.
+	poolIPFamilyField = "spec.ipFamily"
+)
+
+// SetupIndexes registers the cache indexes shared by the controllers.
+// It has to run once, before the controllers are set up.
+func SetupIndexes(ctx context.Context, mgr ctrl.Manager) error {
+	indexer := mgr.GetFieldIndexer()
+	if err := indexer.IndexField(ctx, &ipamv1alpha1.ClusterIP{}, clusterIPResourceField, func(rawObj client.Object) []string {
+		return []string{rawObj.(*ipamv1alpha1.ClusterIP).Spec.Resource}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &ipamv1alpha1.ClusterIP{}, clusterIPPoolField, func(rawObj client.Object) []string {
+		return []string{rawObj.(*ipamv1alpha1.ClusterIP).Spec.ClusterIPPool}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &ipamv1alpha1.ClusterIP{}, clusterIPFamilyField, func(rawObj client.Object) []string {
+		return []string{rawObj.(*ipamv1alpha1.ClusterIP).Spec.Family}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &ipamv1alpha1.ClusterIP{}, clusterIPInterfaceField, func(rawObj client.Object) []string {
+		return []string{rawObj.(*ipamv1alpha1.ClusterIP).Spec.Interface}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &ipamv1alpha1.ClusterIP{}, clusterIPAddressField, func(rawObj client.Object) []string {
+		address := net.ParseIP(rawObj.(*ipamv1alpha1.ClusterIP).Spec.Address)
+		if address == nil {
+			return nil
+		}
+		return []string{address.String()}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &ipamv1alpha1.ClusterIP{}, clusterIPMacField, func(rawObj client.Object) []string {
+		mac, err := net.ParseMAC(rawObj.(*ipamv1alpha1.ClusterIP).Spec.Mac)
+		if err != nil {
+			return nil
+		}
+		return []string{mac.String()}
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &ipamv1alpha1.ClusterIPPool{}, poolIPFamilyField, func(rawObj client.Object) []string {
+		return []string{rawObj.(*ipamv1alpha1.ClusterIPPool).Spec.IPFamily}
+	})
+}
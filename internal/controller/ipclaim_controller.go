@@ -0,0 +1,188 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/ipam"
+)
+
+// IPClaimReconciler binds IPClaims to ClusterIPs.
+type IPClaimReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=ipclaims,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=ipclaims/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=ipclaims/finalizers,verbs=update
+
+// Reconcile allocates a ClusterIP for a new IPClaim from a matching pool and
+// mirrors the binding in the claim status. Deleted claims release their address.
+func (r *IPClaimReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	var claim ipamv1alpha1.IPClaim
+	if err := r.Get(ctx, req.NamespacedName, &claim); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !claim.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.reconcileDelete(ctx, &claim)
+	}
+	if controllerutil.AddFinalizer(&claim, ipamv1alpha1.IPClaimFinalizer) {
+		if err := r.Update(ctx, &claim); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	newStatus := claim.Status.DeepCopy()
+	if claim.Status.ClusterIP == "" {
+		clusterIP, pool, err := ipam.NewWithClient(r.Client).BindIPClaim(ctx, &claim)
+		switch {
+		case apierrors.IsNotFound(err):
+			// pools are watched, a new or grown pool requeues the claim.
+			newStatus.Phase = ipamv1alpha1.IPClaimPending
+			meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+				Type:    "Bound",
+				Status:  metav1.ConditionFalse,
+				Reason:  "NoFreeAddress",
+				Message: fmt.Sprintf("no matching %s pool has a free address", ipam.ClaimFamily(&claim)),
+			})
+		case err != nil:
+			return ctrl.Result{}, err
+		default:
+			log.Info("Bound IPClaim", "clusterip", clusterIP.Name, "address", clusterIP.Spec.Address)
+			setBound(newStatus, clusterIP, pool)
+		}
+	} else {
+		var clusterIP ipamv1alpha1.ClusterIP
+		err := r.Get(ctx, client.ObjectKey{Name: claim.Status.ClusterIP}, &clusterIP)
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		if err != nil || clusterIP.Spec.ResourceKind != ipamv1alpha1.IPClaimKind || clusterIP.Spec.ResourceUID != claim.UID {
+			// like a PersistentVolumeClaim, a lost claim does not get a new address.
+			newStatus.Phase = ipamv1alpha1.IPClaimLost
+			meta.SetStatusCondition(&newStatus.Conditions, metav1.Condition{
+				Type:    "Bound",
+				Status:  metav1.ConditionFalse,
+				Reason:  "ClusterIPLost",
+				Message: fmt.Sprintf("ClusterIP %s was deleted or bound elsewhere", claim.Status.ClusterIP),
+			})
+		} else {
+			var pool ipamv1alpha1.ClusterIPPool
+			if err := r.Get(ctx, client.ObjectKey{Name: clusterIP.Spec.ClusterIPPool}, &pool); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+			setBound(newStatus, &clusterIP, &pool)
+		}
+	}
+
+	if reflect.DeepEqual(&claim.Status, newStatus) {
+		return ctrl.Result{}, nil
+	}
+	claim.Status = *newStatus
+	return ctrl.Result{}, r.Status().Update(ctx, &claim)
+}
+
+// reconcileDelete returns the address of a deleted claim to its pool.
+func (r *IPClaimReconciler) reconcileDelete(ctx context.Context, claim *ipamv1alpha1.IPClaim) error {
+	if !controllerutil.ContainsFinalizer(claim, ipamv1alpha1.IPClaimFinalizer) {
+		return nil
+	}
+	if claim.Status.ClusterIP != "" {
+		var clusterIP ipamv1alpha1.ClusterIP
+		err := r.Get(ctx, client.ObjectKey{Name: claim.Status.ClusterIP}, &clusterIP)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if err == nil && clusterIP.Spec.ResourceKind == ipamv1alpha1.IPClaimKind && clusterIP.Spec.ResourceUID == claim.UID {
+			logf.FromContext(ctx).Info("Releasing ClusterIP of deleted IPClaim", "clusterip", clusterIP.Name)
+			if err := ipam.ReleaseClusterIP(ctx, r.Client, &clusterIP, *claim.DeletionTimestamp); err != nil {
+				return err
+			}
+		}
+	}
+	controllerutil.RemoveFinalizer(claim, ipamv1alpha1.IPClaimFinalizer)
+	return r.Update(ctx, claim)
+}
+
+// setBound records the ClusterIP of a claim in its status.
+func setBound(status *ipamv1alpha1.IPClaimStatus, clusterIP *ipamv1alpha1.ClusterIP, pool *ipamv1alpha1.ClusterIPPool) {
+	status.Phase = ipamv1alpha1.IPClaimBound
+	status.ClusterIP = clusterIP.Name
+	status.Address = clusterIP.Spec.Address
+	status.Mac = clusterIP.Spec.Mac
+	status.ClusterIPPool = clusterIP.Spec.ClusterIPPool
+	status.Gateway = pool.Spec.Gateway
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    "Bound",
+		Status:  metav1.ConditionTrue,
+		Reason:  "ClusterIPBound",
+		Message: fmt.Sprintf("bound to ClusterIP %s", clusterIP.Name),
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *IPClaimReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ipamv1alpha1.IPClaim{}).
+		Watches(&ipamv1alpha1.ClusterIPPool{}, handler.EnqueueRequestsFromMapFunc(r.pendingClaims)).
+		Watches(&ipamv1alpha1.ClusterIP{}, handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+			cip := obj.(*ipamv1alpha1.ClusterIP)
+			if cip.Spec.ResourceKind != ipamv1alpha1.IPClaimKind {
+				return nil
+			}
+			namespace, name, ok := cutResource(cip.Spec.Resource)
+			if !ok {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: namespace, Name: name}}}
+		})).
+		Named("ipclaim").
+		Complete(r)
+}
+
+// pendingClaims requeues the claims still waiting for an address when a pool changes.
+func (r *IPClaimReconciler) pendingClaims(ctx context.Context, _ client.Object) []reconcile.Request {
+	var claims ipamv1alpha1.IPClaimList
+	if err := r.List(ctx, &claims); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to list IPClaims")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, claim := range claims.Items {
+		if claim.Status.Phase == "" || claim.Status.Phase == ipamv1alpha1.IPClaimPending {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&claim)})
+		}
+	}
+	return requests
+}
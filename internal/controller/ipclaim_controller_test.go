@@ -0,0 +1,184 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/ipam"
+)
+
+var _ = Describe("IPClaim Controller", func() {
+	Context("When reconciling an IPClaim", func() {
+		const poolName = "ipclaim-pool"
+
+		ctx := context.Background()
+		claimKey := types.NamespacedName{Namespace: "default", Name: "ipclaim-test"}
+
+		var controllerReconciler *IPClaimReconciler
+
+		BeforeEach(func() {
+			controllerReconciler = &IPClaimReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			pool := &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName, Labels: map[string]string{"tier": "public"}},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.40.0.0/24",
+					Gateway:  "10.40.0.1",
+				},
+			}
+			Expect(k8sClient.Create(ctx, pool)).To(Succeed())
+			pool.Status.TotalIPs = "254"
+			pool.Status.FreeIPs = "254"
+			pool.Status.AllocatedIPs = "0"
+			pool.Status.NextIndex = "0"
+			Expect(k8sClient.Status().Update(ctx, pool)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			var clusterIPs ipamv1alpha1.ClusterIPList
+			Expect(k8sClient.List(ctx, &clusterIPs)).To(Succeed())
+			for i := range clusterIPs.Items {
+				if clusterIPs.Items[i].Spec.ClusterIPPool == poolName {
+					Expect(k8sClient.Delete(ctx, &clusterIPs.Items[i])).To(Succeed())
+				}
+			}
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIPPool{ObjectMeta: metav1.ObjectMeta{Name: poolName}})).To(Succeed())
+		})
+
+		It("should bind the claim and release its address on deletion", func() {
+			claim := &ipamv1alpha1.IPClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: claimKey.Namespace, Name: claimKey.Name},
+				Spec: ipamv1alpha1.IPClaimSpec{
+					Family:       "v4",
+					PoolSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "public"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, claim)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: claimKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, claimKey, claim)).To(Succeed())
+			Expect(claim.Finalizers).To(ContainElement(ipamv1alpha1.IPClaimFinalizer))
+			Expect(claim.Status.Phase).To(Equal(ipamv1alpha1.IPClaimBound))
+			Expect(claim.Status.ClusterIPPool).To(Equal(poolName))
+			Expect(claim.Status.Gateway).To(Equal("10.40.0.1"))
+			Expect(claim.Status.Address).NotTo(Or(BeEmpty(), Equal("10.40.0.1")))
+			Expect(claim.Status.Mac).NotTo(BeEmpty())
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: claim.Status.ClusterIP}, cip)).To(Succeed())
+			Expect(cip.Spec.ResourceKind).To(Equal(ipamv1alpha1.IPClaimKind))
+			Expect(cip.Spec.ResourceUID).To(Equal(claim.UID))
+
+			Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: claimKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: cip.Name}, cip)).To(Succeed())
+			Expect(cip.Spec.Resource).To(BeEmpty())
+			Expect(cip.Spec.Mac).To(BeEmpty())
+		})
+
+		It("should hand the claim to one workload at a time", func() {
+			claim := &ipamv1alpha1.IPClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: claimKey.Namespace, Name: claimKey.Name},
+				Spec:       ipamv1alpha1.IPClaimSpec{Family: "v4", ClusterIPPool: poolName},
+			}
+			Expect(k8sClient.Create(ctx, claim)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: claimKey})
+				Expect(err).NotTo(HaveOccurred())
+			})
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: claimKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			newPod := func(name string) *corev1.Pod {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:   claimKey.Namespace,
+						Name:        name,
+						Annotations: map[string]string{ipamv1alpha1.IPClaimAnnotation: claimKey.Name},
+					},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app"}}},
+				}
+				Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed())
+				})
+				return pod
+			}
+			request := func(pod string) ipam.IPAMRequest {
+				return ipam.IPAMRequest{Namespace: claimKey.Namespace, Name: pod, Interface: "eth0", Family: "v4"}
+			}
+			first, second := newPod("ipclaim-pod-a"), newPod("ipclaim-pod-b")
+			histackIPAM := ipam.NewWithClient(k8sClient)
+
+			cip, _, err := histackIPAM.FindOrCreateClusterIP(request(first.Name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, claimKey, claim)).To(Succeed())
+			Expect(cip.Name).To(Equal(claim.Status.ClusterIP))
+			Expect(claim.Status.Consumer).To(Equal(&ipamv1alpha1.IPClaimConsumer{Kind: "Pod", Name: first.Name, UID: first.UID}))
+
+			_, _, err = histackIPAM.FindOrCreateClusterIP(request(second.Name))
+			Expect(err).To(MatchError(ContainSubstring("is used by Pod " + first.Name)))
+
+			// the claim passes on once its consumer is gone.
+			Expect(k8sClient.Delete(ctx, first)).To(Succeed())
+			Eventually(func() error {
+				_, _, err := histackIPAM.FindOrCreateClusterIP(request(second.Name))
+				return err
+			}).Should(Succeed())
+			Expect(k8sClient.Get(ctx, claimKey, claim)).To(Succeed())
+			Expect(claim.Status.Consumer.UID).To(Equal(second.UID))
+		})
+
+		It("should keep a claim without a matching pool pending", func() {
+			claim := &ipamv1alpha1.IPClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: claimKey.Namespace, Name: claimKey.Name},
+				Spec:       ipamv1alpha1.IPClaimSpec{Family: "v4", ClusterIPPool: "missing-pool"},
+			}
+			Expect(k8sClient.Create(ctx, claim)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: claimKey})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: claimKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, claimKey, claim)).To(Succeed())
+			Expect(claim.Status.Phase).To(Equal(ipamv1alpha1.IPClaimPending))
+			Expect(claim.Status.ClusterIP).To(BeEmpty())
+		})
+	})
+})
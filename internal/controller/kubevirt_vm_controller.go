@@ -2,207 +2,722 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/jaswdr/faker/v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/bootconfig"
+	"github.com/hicompute/histack/pkg/credentials"
+	helper "github.com/hicompute/histack/pkg/helpers"
+	"github.com/hicompute/histack/pkg/ipam"
+	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // KubeVirtVMReconciler reconciles a KubeVirt object
 type KubeVirtVMReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// APIReader reads secrets past the cache, the Client when nil.
+	APIReader client.Reader
+	// Credentials keeps the credentials of VMs, secrets owned by them when nil.
+	Credentials credentials.Store
 }
 
 // Add RBAC permissions for VirtualMachines
-// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines/status,verbs=get
+// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachines/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;update;delete
+// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachineinstances,verbs=get;list;watch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=credentialpolicies;clustercredentialpolicies,verbs=get;list;watch
+
+// Reconcile converges a VirtualMachine on its credentials and, once it is
+// deleted, on its ClusterIPs being released. Every step is idempotent, so a
+// missed event is caught up by the next reconcile.
 func (r *KubeVirtVMReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := logf.FromContext(ctx)
 
 	var vm kubevirtv1.VirtualMachine
 	if err := r.Get(ctx, req.NamespacedName, &vm); err != nil {
 		if errors.IsNotFound(err) {
-			return r.handleVMDeletion(ctx, req.Namespace, req.Name, metav1.Now())
+			// deleted without the finalizer, e.g. before it was introduced.
+			return r.handleVMDeletion(ctx, req.Namespace, req.Name, "", metav1.Now())
 		}
 		log.Error(err, "Failed to get VirtualMachine")
 		return ctrl.Result{}, err
 	}
 
-	if vm.DeletionTimestamp != nil {
-		return r.handleVMDeletion(ctx, req.Namespace, req.Name, *vm.DeletionTimestamp)
+	if !vm.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&vm, v1alpha1.VirtualMachineFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		if result, err := r.handleVMDeletion(ctx, vm.Namespace, vm.Name, vm.UID, *vm.DeletionTimestamp); err != nil {
+			return result, err
+		}
+		controllerutil.RemoveFinalizer(&vm, v1alpha1.VirtualMachineFinalizer)
+		return ctrl.Result{}, r.Update(ctx, &vm)
 	}
 
-	// handle vm creation.
-	if vm.GetGeneration() == 1 && vm.Status.ObservedGeneration == 0 {
-		return r.handleVMCreation(ctx, vm)
+	if controllerutil.AddFinalizer(&vm, v1alpha1.VirtualMachineFinalizer) {
+		if err := r.Update(ctx, &vm); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
-
-	// handle update.
-	if vm.Status.ObservedGeneration != vm.GetGeneration() {
-		// return r.handleVMUpdate(ctx, vm)
-		return ctrl.Result{}, nil
+	if err := r.ensureCredentials(ctx, &vm); err != nil {
+		return ctrl.Result{}, err
+	}
+	requeueAfter, err := r.resetPassword(ctx, &vm)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureAddresses(ctx, &vm); err != nil {
+		return ctrl.Result{}, err
 	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, r.ensureBootConfig(ctx, &vm)
+}
 
-	return ctrl.Result{}, nil
+func (r *KubeVirtVMReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
 }
 
-func (r *KubeVirtVMReconciler) handleVMCreation(ctx context.Context, vm kubevirtv1.VirtualMachine) (ctrl.Result, error) {
-	log := logf.FromContext(ctx)
-	fake := faker.New()
-	vmCredentialsSecret := &corev1.Secret{}
-	vmCredentialsSecret.Name = fmt.Sprintf("%s-credentials", vm.Name)
-	vmCredentialsSecret.Namespace = vm.Namespace
+func (r *KubeVirtVMReconciler) credentialStore() credentials.Store {
+	if r.Credentials == nil {
+		return &credentials.SecretStore{Client: r.Client, Reader: r.apiReader()}
+	}
+	return r.Credentials
+}
 
-	labels := vm.GetLabels()
-	osCategory := labels["histack/oscategory"]
-	username := "root"
-	if osCategory == "windows" {
-		username = "administrator"
+// projectCredentials keeps the credentials of the VM in the secret KubeVirt
+// reads them from while it has a VMI, and only then, when the store is not
+// that secret itself.
+func (r *KubeVirtVMReconciler) projectCredentials(ctx context.Context, vm *kubevirtv1.VirtualMachine, vmCredentials map[string]string) error {
+	if _, ok := r.credentialStore().(*credentials.SecretStore); ok {
+		return nil
 	}
+	var vmi kubevirtv1.VirtualMachineInstance
+	err := r.Get(ctx, client.ObjectKeyFromObject(vm), &vmi)
+	if errors.IsNotFound(err) {
+		return credentials.DeleteSecret(ctx, r.Client, r.apiReader(), vm.Namespace, vm.Name, vm.UID)
+	}
+	if err != nil {
+		return err
+	}
+	return credentials.ProjectSecret(ctx, r.Client, r.apiReader(), vm, vmCredentials)
+}
 
-	if osCategory == "mikrotik" {
-		username = "admin"
+// ensureCredentials sets up the access credentials of the VM as its
+// credential policy asks: a generated password, stored if the VM has none yet
+// and propagated through the guest agent, and SSH public keys from a secret.
+func (r *KubeVirtVMReconciler) ensureCredentials(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
+	log := logf.FromContext(ctx)
+	if vm.Spec.Template == nil {
+		return nil
 	}
+	policy, err := r.credentialPolicy(ctx, vm)
+	if err != nil {
+		return err
+	}
+	username := vmUsername(vm, policy)
+	original := vm.DeepCopy()
 
-	password := []byte(fake.Internet().Password())
-	vmCredentialsSecret.Data = map[string][]byte{}
-	vmCredentialsSecret.Data[fmt.Sprintf("%s", username)] = password
+	if policy.Generate == nil || *policy.Generate {
+		vmCredentials, err := r.credentialStore().Get(ctx, vm)
+		if err != nil {
+			log.Error(err, "Failed to get VM credentials", "vm", vm.Name)
+			return err
+		}
+		if vmCredentials == nil {
+			password, err := credentials.GeneratePassword(policy.Password)
+			if err != nil {
+				log.Error(err, "Failed to generate VM password", "vm", vm.Name)
+				return err
+			}
+			vmCredentials = map[string]string{username: password}
+			if err := r.credentialStore().Put(ctx, vm, vmCredentials); err != nil {
+				log.Error(err, "Failed to store VM credentials", "vm", vm.Name)
+				return err
+			}
+		}
+		if err := r.projectCredentials(ctx, vm, vmCredentials); err != nil {
+			log.Error(err, "Failed to project VM credentials secret", "vm", vm.Name)
+			return err
+		}
 
-	err := r.Client.Create(ctx, vmCredentialsSecret)
-	if (err != nil) && (!errors.IsAlreadyExists(err)) {
-		log.Error(err, "Failed to create VM credentials secret", "vm", vm.Name)
-		return ctrl.Result{}, err
+		if !lo.ContainsBy(vm.Spec.Template.Spec.AccessCredentials, func(credential kubevirtv1.AccessCredential) bool {
+			return credential.UserPassword != nil && credential.UserPassword.Source.Secret != nil &&
+				credential.UserPassword.Source.Secret.SecretName == credentials.SecretName(vm.Name)
+		}) {
+			vm.Spec.Template.Spec.AccessCredentials = append(vm.Spec.Template.Spec.AccessCredentials, kubevirtv1.AccessCredential{
+				UserPassword: &kubevirtv1.UserPasswordAccessCredential{
+					Source: kubevirtv1.UserPasswordAccessCredentialSource{
+						Secret: &kubevirtv1.AccessCredentialSecretSource{
+							SecretName: credentials.SecretName(vm.Name),
+						},
+					},
+					PropagationMethod: kubevirtv1.UserPasswordAccessCredentialPropagationMethod{
+						QemuGuestAgent: &kubevirtv1.QemuGuestAgentUserPasswordAccessCredentialPropagation{},
+					},
+				},
+			})
+		}
 	}
 
-	patch := client.MergeFrom(vm.DeepCopy())
-
-	vm.Spec.Template.Spec.AccessCredentials = []kubevirtv1.AccessCredential{
-		{
-			UserPassword: &kubevirtv1.UserPasswordAccessCredential{
-				Source: kubevirtv1.UserPasswordAccessCredentialSource{
+	if keys := policy.SSHPublicKeys; keys != nil && !lo.ContainsBy(vm.Spec.Template.Spec.AccessCredentials, func(credential kubevirtv1.AccessCredential) bool {
+		return credential.SSHPublicKey != nil && credential.SSHPublicKey.Source.Secret != nil &&
+			credential.SSHPublicKey.Source.Secret.SecretName == keys.SecretName
+	}) {
+		users := keys.Users
+		if len(users) == 0 {
+			users = []string{username}
+		}
+		vm.Spec.Template.Spec.AccessCredentials = append(vm.Spec.Template.Spec.AccessCredentials, kubevirtv1.AccessCredential{
+			SSHPublicKey: &kubevirtv1.SSHPublicKeyAccessCredential{
+				Source: kubevirtv1.SSHPublicKeyAccessCredentialSource{
 					Secret: &kubevirtv1.AccessCredentialSecretSource{
-						SecretName: vmCredentialsSecret.Name,
+						SecretName: keys.SecretName,
 					},
 				},
-				PropagationMethod: kubevirtv1.UserPasswordAccessCredentialPropagationMethod{
-					QemuGuestAgent: &kubevirtv1.QemuGuestAgentUserPasswordAccessCredentialPropagation{},
+				PropagationMethod: kubevirtv1.SSHPublicKeyAccessCredentialPropagationMethod{
+					QemuGuestAgent: &kubevirtv1.QemuGuestAgentSSHPublicKeyAccessCredentialPropagation{
+						Users: users,
+					},
 				},
 			},
-		},
-	}
-	// 	vm.Spec.Template.Spec.Volumes = append(vm.Spec.Template.Spec.Volumes, kubevirtv1.Volume{
-	// 		Name: "cloud-init-volume",
-	// 		VolumeSource: kubevirtv1.VolumeSource{
-	// 			CloudInitNoCloud: &kubevirtv1.CloudInitNoCloudSource{
-	// 				UserData: fmt.Sprintf(`#cloud-config
-	// package_update: true
-	// ssh_pwauth: true
-	// chpasswd:
-	//   expire: false
-	// apt:
-	//   primary:
-	//     - arches:
-	//         - "default"
-	//       uri: "http://ir.archive.ubuntu.com/ubuntu/"
-	// users:
-	//   - name: %s
-	//     groups: [ sudo ]
-	//     sudo: ALL=(ALL) NOPASSWD:ALL
-	//     lock_passwd: false
-	// `, username),
-	// 			},
-	// 		},
-	// 	})
-
-	// vm.Spec.Template.Spec.Domain.Devices.Disks = append(vm.Spec.Template.Spec.Domain.Devices.Disks, kubevirtv1.Disk{
-	// 	Name: "cloud-init-volume",
-	// 	DiskDevice: kubevirtv1.DiskDevice{
-	// 		Disk: &kubevirtv1.DiskTarget{
-	// 			Bus: "virtio",
-	// 		},
-	// 	},
-	// })
-
-	if err := r.Patch(ctx, &vm, patch); err != nil {
+		})
+	}
+	if equality.Semantic.DeepEqual(original, vm) {
+		return nil
+	}
+	if err := r.Patch(ctx, vm, client.MergeFrom(original)); err != nil {
 		log.Error(err, "Failed to update VM.", "vm", vm.Name)
-		return ctrl.Result{}, err
+		return err
 	}
 
-	return ctrl.Result{}, nil
+	return nil
 }
 
-func (r *KubeVirtVMReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.ClusterIP{}, "spec.resource", func(rawObj client.Object) []string {
-		cip := rawObj.(*v1alpha1.ClusterIP)
-		return []string{cip.Spec.Resource}
-	}); err != nil {
+// credentialPolicy returns the spec of the first CredentialPolicy, by name, in
+// the namespace of the VM that selects it, else of the first such
+// ClusterCredentialPolicy. Without one, a password is generated as before
+// credential policies existed.
+func (r *KubeVirtVMReconciler) credentialPolicy(ctx context.Context, vm *kubevirtv1.VirtualMachine) (*v1alpha1.CredentialPolicySpec, error) {
+	var policies v1alpha1.CredentialPolicyList
+	if err := r.List(ctx, &policies, client.InNamespace(vm.Namespace)); err != nil {
+		return nil, err
+	}
+	var clusterPolicies v1alpha1.ClusterCredentialPolicyList
+	if err := r.List(ctx, &clusterPolicies); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(policies.Items, func(a, b v1alpha1.CredentialPolicy) int { return strings.Compare(a.Name, b.Name) })
+	slices.SortFunc(clusterPolicies.Items, func(a, b v1alpha1.ClusterCredentialPolicy) int { return strings.Compare(a.Name, b.Name) })
+
+	specs := lo.Map(policies.Items, func(p v1alpha1.CredentialPolicy, _ int) v1alpha1.CredentialPolicySpec { return p.Spec })
+	specs = append(specs, lo.Map(clusterPolicies.Items, func(p v1alpha1.ClusterCredentialPolicy, _ int) v1alpha1.CredentialPolicySpec { return p.Spec })...)
+	for i := range specs {
+		if specs[i].VMSelector == nil {
+			return &specs[i], nil
+		}
+		selector, err := metav1.LabelSelectorAsSelector(specs[i].VMSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vmSelector of credential policy: %w", err)
+		}
+		if selector.Matches(labels.Set(vm.Labels)) {
+			return &specs[i], nil
+		}
+	}
+	return &v1alpha1.CredentialPolicySpec{}, nil
+}
+
+// vmUsername is the user the credentials of the VM are for, chosen by its OS category.
+func vmUsername(vm *kubevirtv1.VirtualMachine, policy *v1alpha1.CredentialPolicySpec) string {
+	osCategory := vm.GetLabels()["histack/oscategory"]
+	if username := policy.Usernames[osCategory]; username != "" {
+		return username
+	}
+	switch osCategory {
+	case "windows":
+		return "administrator"
+	case "mikrotik":
+		return "admin"
+	}
+	return "root"
+}
+
+// passwordSyncPeriod is how long the guest agent gets to synchronize a new
+// password. KubeVirt keeps the AccessCredentialsSynchronized condition of the
+// VMI False while the agent fails to apply it, so a True condition after this
+// period confirms the reset.
+const passwordSyncPeriod = time.Minute
+
+// resetPassword regenerates the password in the credentials secret when the
+// ResetPasswordAnnotation asks for it or the rotation interval of the VM
+// elapsed, and publishes the reset in the PasswordResetStatusAnnotation until
+// the guest agent confirms it. It returns when to look again.
+func (r *KubeVirtVMReconciler) resetPassword(ctx context.Context, vm *kubevirtv1.VirtualMachine) (time.Duration, error) {
+	log := logf.FromContext(ctx)
+	policy, err := r.credentialPolicy(ctx, vm)
+	if err != nil {
+		return 0, err
+	}
+	if policy.Generate != nil && !*policy.Generate {
+		return 0, nil
+	}
+
+	var status *v1alpha1.PasswordResetStatus
+	if raw, ok := vm.Annotations[v1alpha1.PasswordResetStatusAnnotation]; ok {
+		status = &v1alpha1.PasswordResetStatus{}
+		if err := json.Unmarshal([]byte(raw), status); err != nil {
+			log.Error(err, "Ignoring invalid password reset status", "vm", vm.Name)
+			status = nil
+		}
+	}
+	var interval time.Duration
+	if raw, ok := vm.Annotations[v1alpha1.PasswordRotationIntervalAnnotation]; ok {
+		if interval, err = time.ParseDuration(raw); err != nil || interval <= 0 {
+			log.Error(err, "Ignoring invalid password rotation interval", "vm", vm.Name, "interval", raw)
+			interval = 0
+		}
+	}
+	lastReset := vm.CreationTimestamp.Time
+	if status != nil {
+		lastReset = status.LastResetTime.Time
+	}
+	request := vm.Annotations[v1alpha1.ResetPasswordAnnotation]
+
+	var reason v1alpha1.PasswordResetReason
+	switch {
+	case request != "" && (status == nil || status.Request != request):
+		reason = v1alpha1.PasswordResetRequested
+	case interval > 0 && time.Since(lastReset) >= interval:
+		reason = v1alpha1.PasswordResetRotated
+	}
+
+	var requeueAfter time.Duration
+	original := vm.DeepCopy()
+	if reason != "" {
+		password, err := credentials.GeneratePassword(policy.Password)
+		if err != nil {
+			log.Error(err, "Failed to generate VM password", "vm", vm.Name)
+			return 0, err
+		}
+		vmCredentials := map[string]string{vmUsername(vm, policy): password}
+		if err := r.credentialStore().Put(ctx, vm, vmCredentials); err != nil {
+			log.Error(err, "Failed to reset VM password", "vm", vm.Name)
+			return 0, err
+		}
+		if err := r.projectCredentials(ctx, vm, vmCredentials); err != nil {
+			log.Error(err, "Failed to project VM credentials secret", "vm", vm.Name)
+			return 0, err
+		}
+		log.Info("Reset VM password", "vm", vm.Name, "reason", reason)
+		status = &v1alpha1.PasswordResetStatus{
+			Request:       request,
+			Reason:        reason,
+			LastResetTime: metav1.Now(),
+		}
+		requeueAfter = passwordSyncPeriod
+	} else if status != nil && !status.Confirmed {
+		if requeueAfter, err = r.confirmPasswordReset(ctx, vm, status); err != nil {
+			return 0, err
+		}
+	}
+	if status != nil && interval > 0 {
+		rotateAfter := max(time.Until(status.LastResetTime.Add(interval)), time.Second)
+		if requeueAfter == 0 || rotateAfter < requeueAfter {
+			requeueAfter = rotateAfter
+		}
+	}
+
+	if status != nil {
+		raw, err := json.Marshal(status)
+		if err != nil {
+			return 0, err
+		}
+		if vm.Annotations == nil {
+			vm.Annotations = map[string]string{}
+		}
+		vm.Annotations[v1alpha1.PasswordResetStatusAnnotation] = string(raw)
+	}
+	if equality.Semantic.DeepEqual(original, vm) {
+		return requeueAfter, nil
+	}
+	if err := r.Patch(ctx, vm, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		log.Error(err, "Failed to update VM password reset status", "vm", vm.Name)
+		return 0, err
+	}
+	return requeueAfter, nil
+}
+
+// confirmPasswordReset confirms the reset in status once the guest agent of
+// the running VMI synchronized the access credentials. It returns when to look
+// again, zero to wait for the VMI to start.
+func (r *KubeVirtVMReconciler) confirmPasswordReset(ctx context.Context, vm *kubevirtv1.VirtualMachine, status *v1alpha1.PasswordResetStatus) (time.Duration, error) {
+	var vmi kubevirtv1.VirtualMachineInstance
+	if err := r.Get(ctx, client.ObjectKeyFromObject(vm), &vmi); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	if wait := time.Until(status.LastResetTime.Add(passwordSyncPeriod)); wait > 0 {
+		return wait, nil
+	}
+	for _, condition := range vmi.Status.Conditions {
+		if condition.Type != kubevirtv1.VirtualMachineInstanceAccessCredentialsSynchronized {
+			continue
+		}
+		if condition.Status == corev1.ConditionTrue {
+			status.Confirmed = true
+			status.Message = ""
+			return 0, nil
+		}
+		status.Message = condition.Message
+	}
+	return passwordSyncPeriod, nil
+}
+
+// ensureAddresses allocates the ClusterIPs of the VM's networks before its
+// launcher pod exists and publishes them on the VM. Until the VM is first
+// started, the MAC of each ClusterIP is written into the interface without one.
+func (r *KubeVirtVMReconciler) ensureAddresses(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
+	log := logf.FromContext(ctx)
+	if vm.Spec.Template == nil {
+		return nil
+	}
+
+	var clusterIPList v1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPList, client.MatchingFields{clusterIPResourceField: vm.Namespace + "/" + vm.Name}); err != nil {
+		return err
+	}
+
+	original := vm.DeepCopy()
+	addresses := map[string]string{}
+	for _, podIface := range helper.DeclaredPodInterfaces(&vm.Spec.Template.Spec) {
+		clusterIPs, err := r.interfaceClusterIPs(ctx, vm, clusterIPList.Items, podIface)
+		if err != nil {
+			log.Error(err, "Failed to allocate ClusterIP", "vm", vm.Name, "network", podIface.Network.Name)
+			return err
+		}
+		clusterIP := clusterIPs[0]
+		addresses[podIface.Network.Name] = clusterIP.Spec.Address
+		if podIface.Interface.MacAddress != "" || vm.Status.Created {
+			continue
+		}
+		for i := range vm.Spec.Template.Spec.Domain.Devices.Interfaces {
+			if iface := &vm.Spec.Template.Spec.Domain.Devices.Interfaces[i]; iface.Name == podIface.Interface.Name {
+				iface.MacAddress = clusterIP.Spec.Mac
+			}
+		}
+	}
+
+	published, err := json.Marshal(addresses)
+	if err != nil {
+		return err
+	}
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[v1alpha1.AddressesAnnotation] = string(published)
+	if err := r.mirrorNetworkStatus(ctx, vm); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(original, vm) {
+		return nil
+	}
+	return r.Patch(ctx, vm, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+}
+
+// bootConfigVolume is the volume of the VM template carrying its boot configuration.
+const bootConfigVolume = "bootconfig"
+
+// bootConfigSecretName is the secret holding the boot configuration of a VM.
+func bootConfigSecretName(vmName string) string {
+	return vmName + "-bootconfig"
+}
+
+// ensureBootConfig renders what the OS category of the VM reads on first boot
+// into its bootconfig secret and references it from the template: cloud-init
+// NoCloud data for Linux, a sysprep answer file for Windows and an initial
+// script for Mikrotik. A template bringing its own cloud-init or sysprep
+// volume is left alone, and so is the template of a VM that has been created,
+// which would otherwise need a restart and boot for the first time again.
+func (r *KubeVirtVMReconciler) ensureBootConfig(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
+	log := logf.FromContext(ctx)
+	if vm.Spec.Template == nil || vm.Status.Created {
+		return nil
+	}
+	if lo.ContainsBy(vm.Spec.Template.Spec.Volumes, func(volume kubevirtv1.Volume) bool {
+		return volume.Name != bootConfigVolume &&
+			(volume.CloudInitNoCloud != nil || volume.CloudInitConfigDrive != nil || volume.Sysprep != nil)
+	}) {
+		return nil
+	}
+
+	cfg, err := r.bootConfig(ctx, vm)
+	if err != nil {
+		log.Error(err, "Failed to collect VM boot configuration", "vm", vm.Name)
+		return err
+	}
+	data := map[string][]byte{}
+	volume := kubevirtv1.Volume{Name: bootConfigVolume}
+	disk := kubevirtv1.Disk{Name: bootConfigVolume}
+	secretRef := &corev1.LocalObjectReference{Name: bootConfigSecretName(vm.Name)}
+	switch vm.GetLabels()["histack/oscategory"] {
+	case "windows":
+		unattend, err := bootconfig.Sysprep(*cfg)
+		if err != nil {
+			return err
+		}
+		data["unattend.xml"] = []byte(unattend)
+		volume.Sysprep = &kubevirtv1.SysprepSource{Secret: secretRef}
+		// KubeVirt hands sysprep to the guest as a cdrom.
+		disk.CDRom = &kubevirtv1.CDRomTarget{Bus: kubevirtv1.DiskBusSATA}
+	case "mikrotik":
+		data["userdata"] = []byte(bootconfig.MikrotikScript(*cfg))
+		volume.CloudInitNoCloud = &kubevirtv1.CloudInitNoCloudSource{UserDataSecretRef: secretRef}
+		disk.Disk = &kubevirtv1.DiskTarget{Bus: kubevirtv1.DiskBusVirtio}
+	default:
+		userData, networkData, err := bootconfig.CloudInit(*cfg)
+		if err != nil {
+			return err
+		}
+		data["userdata"] = []byte(userData)
+		data["networkdata"] = []byte(networkData)
+		volume.CloudInitNoCloud = &kubevirtv1.CloudInitNoCloudSource{UserDataSecretRef: secretRef, NetworkDataSecretRef: secretRef}
+		disk.Disk = &kubevirtv1.DiskTarget{Bus: kubevirtv1.DiskBusVirtio}
+	}
+	if err := credentials.WriteVMSecret(ctx, r.Client, r.apiReader(), vm, bootConfigSecretName(vm.Name), data); err != nil {
+		log.Error(err, "Failed to write VM boot configuration secret", "vm", vm.Name)
+		return err
+	}
+
+	original := vm.DeepCopy()
+	templateSpec := &vm.Spec.Template.Spec
+	templateSpec.Volumes = append(lo.Reject(templateSpec.Volumes, func(v kubevirtv1.Volume, _ int) bool {
+		return v.Name == bootConfigVolume
+	}), volume)
+	if !lo.ContainsBy(templateSpec.Domain.Devices.Disks, func(d kubevirtv1.Disk) bool { return d.Name == bootConfigVolume }) {
+		templateSpec.Domain.Devices.Disks = append(templateSpec.Domain.Devices.Disks, disk)
+	}
+	if equality.Semantic.DeepEqual(original, vm) {
+		return nil
+	}
+	return r.Patch(ctx, vm, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+}
+
+// bootConfig collects the hostname, user, SSH keys and the static addresses
+// of the networks of the VM. The default network carries the default route.
+func (r *KubeVirtVMReconciler) bootConfig(ctx context.Context, vm *kubevirtv1.VirtualMachine) (*bootconfig.Config, error) {
+	policy, err := r.credentialPolicy(ctx, vm)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &bootconfig.Config{
+		Hostname: vm.Name,
+		Username: vmUsername(vm, policy),
+	}
+	if vm.Spec.Template.Spec.Hostname != "" {
+		cfg.Hostname = vm.Spec.Template.Spec.Hostname
+	}
+	if policy.SSHPublicKeys != nil {
+		keys := &corev1.Secret{}
+		err := r.apiReader().Get(ctx, types.NamespacedName{Namespace: vm.Namespace, Name: policy.SSHPublicKeys.SecretName}, keys)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		for _, key := range slices.Sorted(maps.Keys(keys.Data)) {
+			cfg.SSHAuthorizedKeys = append(cfg.SSHAuthorizedKeys, strings.TrimSpace(string(keys.Data[key])))
+		}
+	}
+
+	var clusterIPList v1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPList, client.MatchingFields{clusterIPResourceField: vm.Namespace + "/" + vm.Name}); err != nil {
+		return nil, err
+	}
+	for _, podIface := range helper.DeclaredPodInterfaces(&vm.Spec.Template.Spec) {
+		clusterIPs, err := r.interfaceClusterIPs(ctx, vm, clusterIPList.Items, podIface)
+		if err != nil {
+			return nil, err
+		}
+		iface := bootconfig.Interface{Mac: clusterIPs[0].Spec.Mac}
+		for _, clusterIP := range clusterIPs {
+			var pool v1alpha1.ClusterIPPool
+			if err := r.Get(ctx, types.NamespacedName{Name: clusterIP.Spec.ClusterIPPool}, &pool); err != nil {
+				return nil, err
+			}
+			address, err := bootconfig.InterfaceAddress(clusterIP.Spec.Address, pool.Spec.CIDR)
+			if err != nil {
+				return nil, err
+			}
+			iface.Addresses = append(iface.Addresses, address)
+			if !podIface.Secondary() && pool.Spec.Gateway != "" {
+				iface.Gateways = append(iface.Gateways, pool.Spec.Gateway)
+			}
+		}
+		cfg.Interfaces = append(cfg.Interfaces, iface)
+	}
+	return cfg, nil
+}
+
+// mirrorNetworkStatus copies the network-status of the running launcher pod
+// onto the VM and labels the VM with the address of its default network. The
+// last status is kept while the VM is stopped.
+func (r *KubeVirtVMReconciler) mirrorNetworkStatus(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(vm.Namespace), client.MatchingLabels{"vm.kubevirt.io/name": vm.Name}); err != nil {
 		return err
 	}
+	var launcher *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning || !pod.DeletionTimestamp.IsZero() || pod.Annotations[helper.NetworkStatusAnnotation] == "" {
+			continue
+		}
+		// the target pod of a migration is the newer one.
+		if launcher == nil || launcher.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			launcher = pod
+		}
+	}
+	if launcher == nil {
+		return nil
+	}
+	statuses, err := helper.ParseNetworkStatus(launcher.Annotations)
+	if err != nil {
+		return err
+	}
+
+	vm.Annotations[helper.NetworkStatusAnnotation] = launcher.Annotations[helper.NetworkStatusAnnotation]
+	for _, status := range statuses {
+		if !status.Default {
+			continue
+		}
+		for _, address := range status.IPs {
+			if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+				if vm.Labels == nil {
+					vm.Labels = map[string]string{}
+				}
+				vm.Labels[v1alpha1.AddressLabel] = ip.String()
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// interfaceClusterIPs returns the ClusterIPs bound to a pod interface of the
+// VM under any of its names, one of each family of the pools of its network
+// and v4 first, allocating those it has none of. They share the MAC of the
+// interface.
+func (r *KubeVirtVMReconciler) interfaceClusterIPs(ctx context.Context, vm *kubevirtv1.VirtualMachine, clusterIPs []v1alpha1.ClusterIP, podIface helper.PodInterface) ([]*v1alpha1.ClusterIP, error) {
+	vmIPAM := ipam.NewWithClient(r.Client)
+	families, err := vmIPAM.VMInterfaceFamilies(ctx, vm, podIface.Name)
+	if err != nil {
+		return nil, err
+	}
+	mac := ""
+	if hw, err := net.ParseMAC(podIface.Interface.MacAddress); err == nil {
+		mac = hw.String()
+	}
+	var bound []*v1alpha1.ClusterIP
+	for _, family := range families {
+		clusterIP, ok := lo.Find(lo.ToSlicePtr(clusterIPs), func(item *v1alpha1.ClusterIP) bool {
+			return item.Spec.ResourceKind == "VirtualMachine" && item.Spec.ResourceUID == vm.UID &&
+				item.Spec.Family == family && lo.Contains(podIface.Names(), item.Spec.Interface)
+		})
+		if !ok {
+			if len(bound) > 0 {
+				mac = bound[0].Spec.Mac
+			}
+			if clusterIP, _, err = vmIPAM.FindOrCreateVMClusterIP(ctx, vm, podIface.Name, family, mac); err != nil {
+				return nil, err
+			}
+		}
+		bound = append(bound, clusterIP)
+	}
+	return bound, nil
+}
+
+func (r *KubeVirtVMReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubevirtv1.VirtualMachine{}).
-		// Watches(&kubevirtv1.VirtualMachine{}, &handler.EnqueueRequestForObject{}).
+		// the guest agent confirms password resets on the VMI.
+		Owns(&kubevirtv1.VirtualMachineInstance{}).
+		// the launcher pod publishes the network status mirrored onto the VM.
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+			vmName := obj.GetLabels()["vm.kubevirt.io/name"]
+			if vmName == "" {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: vmName}}}
+		})).
 		Named("virtualmachine").
 		Complete(r)
 }
 
-func (r *KubeVirtVMReconciler) handleVMDeletion(ctx context.Context, namespace, vmName string, deletedAt v1.Time) (ctrl.Result, error) {
+// handleVMDeletion deletes the credentials of the VM and applies the release
+// policy to the ClusterIPs bound to it. uid is empty when the VM is already
+// gone, any ClusterIP still bound to a VM of that name is then released.
+func (r *KubeVirtVMReconciler) handleVMDeletion(ctx context.Context, namespace, vmName string, uid types.UID, deletedAt v1.Time) (ctrl.Result, error) {
 	log := logf.FromContext(ctx)
 
-	vmCredentials := corev1.Secret{}
-	vmCredentials.Name = fmt.Sprintf("%s-credentials", vmName)
-	vmCredentials.Namespace = namespace
-
-	if err := r.Client.Delete(ctx, &vmCredentials); err != nil {
+	if err := r.credentialStore().Delete(ctx, namespace, vmName, uid); err != nil {
 		log.Error(err, "Failed to delete vm credentials", "vm", vmName)
+		return ctrl.Result{}, err
+	}
+	if _, ok := r.credentialStore().(*credentials.SecretStore); !ok {
+		if err := credentials.DeleteSecret(ctx, r.Client, r.apiReader(), namespace, vmName, uid); err != nil {
+			log.Error(err, "Failed to delete vm credentials secret", "vm", vmName)
+			return ctrl.Result{}, err
+		}
 	}
-
-	// clientset.CoreV1().Secrets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
 
 	clusterIPList := v1alpha1.ClusterIPList{}
 	if err := r.List(ctx, &clusterIPList, &client.ListOptions{
-		FieldSelector: fields.OneTermEqualSelector("spec.resource", namespace+"/"+vmName),
+		FieldSelector: fields.OneTermEqualSelector(clusterIPResourceField, namespace+"/"+vmName),
 		Limit:         1000,
 	}); err != nil {
 		log.Error(err, "Failed to list ClusterIPs for VM", "vm", vmName)
 		return ctrl.Result{}, err
 	}
-	log.Info("Reconciling VirtualMachine", "namespace", clusterIPList)
-
-	for _, clusterIP := range clusterIPList.Items {
-		updatedClusterIP := clusterIP.DeepCopy()
-		updatedClusterIP.Spec.Mac = ""
-		updatedClusterIP.Spec.Interface = ""
-		updatedClusterIP.Spec.Resource = ""
-		updatedClusterIP.Status.History = append(updatedClusterIP.Status.History,
-			v1alpha1.ClusterIPHistory{
-				Mac:         clusterIP.Spec.Mac,
-				Resource:    namespace + "/" + vmName,
-				AllocatedAt: *clusterIP.Status.History[len(clusterIP.Status.History)-1].AllocatedAt.DeepCopy(),
-				ReleasedAt:  deletedAt,
-				Interface:   clusterIP.Spec.Interface,
-			},
-		)
-		if err := r.Status().Update(ctx, updatedClusterIP); err != nil {
-			log.Error(err, "Failed to update ClusterIP status", "clusterip", updatedClusterIP.Name)
+
+	for i := range clusterIPList.Items {
+		clusterIP := &clusterIPList.Items[i]
+		if clusterIP.Spec.ResourceKind != "VirtualMachine" || clusterIP.Spec.ResourceUID == "" {
+			// not bound to a VM, or already retained.
+			continue
+		}
+		if uid != "" && clusterIP.Spec.ResourceUID != uid {
+			// bound to a newer VM with the same name.
+			continue
+		}
+		if err := ipam.ReleaseOrRetain(ctx, r.Client, clusterIP, deletedAt); err != nil {
+			log.Error(err, "Failed to release ClusterIP", "clusterip", clusterIP.Name)
 			return ctrl.Result{}, err
 		}
 	}
 
 	return ctrl.Result{}, nil
 }
-
-// func (r *KubeVirtVMReconciler) handleVMUpdate(ctx context.Context, vm kubevirtv1.VirtualMachine) (ctrl.Result, error) {
-
-// }
@@ -17,16 +17,409 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/credentials"
+	helper "github.com/hicompute/histack/pkg/helpers"
 )
 
 var _ = Describe("KubeVirtVM Controller", func() {
-	Context("When reconciling a resource", func() {
+	Context("When a VirtualMachine is deleted", func() {
+		const vmName = "deleted-vm"
+
+		ctx := context.Background()
+
+		clusterIPs := []struct {
+			name, address, kind string
+			uid                 types.UID
+		}{
+			{"default-deleted-vm-eth0", "10.70.0.2", "VirtualMachine", "vm-uid"},
+			// bound to a VM recreated with the same name.
+			{"default-deleted-vm-net1", "10.70.0.3", "VirtualMachine", "new-vm-uid"},
+			// an IPClaim sharing the name of the VM.
+			{"default-deleted-vm-ipclaim", "10.70.0.4", ipamv1alpha1.IPClaimKind, "claim-uid"},
+		}
 
-		It("should successfully reconcile the resource", func() {
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      credentials.SecretName(vmName),
+					Labels:    map[string]string{credentials.ManagedByLabel: credentials.ManagedBy},
+				},
+				StringData: map[string]string{"root": "secret"},
+			})).To(Succeed())
+			for _, cip := range clusterIPs {
+				Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+					ObjectMeta: metav1.ObjectMeta{Name: cip.name},
+					Spec: ipamv1alpha1.ClusterIPSpec{
+						ClusterIPPool: "missing-pool",
+						Address:       cip.address,
+						Family:        "v4",
+						Mac:           "02:00:00:00:70:" + cip.address[len(cip.address)-2:],
+						Interface:     "eth0",
+						Resource:      "default/" + vmName,
+						ResourceKind:  cip.kind,
+						ResourceUID:   cip.uid,
+					},
+				})).To(Succeed())
+			}
+		})
 
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+		AfterEach(func() {
+			for _, cip := range clusterIPs {
+				Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIP{ObjectMeta: metav1.ObjectMeta{Name: cip.name}})).To(Succeed())
+			}
+		})
+
+		It("should delete the credentials and release only the ClusterIPs of the VM", func() {
+			controllerReconciler := &KubeVirtVMReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.handleVMDeletion(ctx, "default", vmName, "vm-uid", metav1.Now())
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: credentials.SecretName(vmName)}, &corev1.Secret{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: clusterIPs[0].name}, cip)).To(Succeed())
+			Expect(cip.Spec.Resource).To(BeEmpty())
+			for _, kept := range clusterIPs[1:] {
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: kept.name}, cip)).To(Succeed())
+				Expect(cip.Spec.ResourceUID).To(Equal(kept.uid))
+			}
+
+			By("running again after the secret is gone")
+			_, err = controllerReconciler.handleVMDeletion(ctx, "default", vmName, "", metav1.Now())
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When a secret of another owner has the name of the credentials", func() {
+		const vmName = "foreign-secret-vm"
+
+		ctx := context.Background()
+		secretKey := types.NamespacedName{Namespace: "default", Name: credentials.SecretName(vmName)}
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: secretKey.Namespace, Name: secretKey.Name}})).To(Succeed())
+		})
+
+		It("should neither take over nor delete it", func() {
+			controller := true
+			for _, secret := range []*corev1.Secret{
+				// owned by another controller.
+				{ObjectMeta: metav1.ObjectMeta{
+					Namespace: secretKey.Namespace,
+					Name:      secretKey.Name,
+					Labels:    map[string]string{credentials.ManagedByLabel: credentials.ManagedBy},
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: "configmap-uid", Controller: &controller,
+					}},
+				}},
+				// created by a user.
+				{ObjectMeta: metav1.ObjectMeta{Namespace: secretKey.Namespace, Name: secretKey.Name}},
+			} {
+				secret.StringData = map[string]string{"key": "value"}
+				Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+				vm := &kubevirtv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: vmName, UID: "vm-uid"}}
+				Expect(credentials.ProjectSecret(ctx, k8sClient, k8sClient, vm, map[string]string{"root": "secret"})).NotTo(Succeed())
+				Expect(credentials.DeleteSecret(ctx, k8sClient, k8sClient, "default", vmName, "vm-uid")).To(Succeed())
+
+				kept := &corev1.Secret{}
+				Expect(k8sClient.Get(ctx, secretKey, kept)).To(Succeed())
+				Expect(kept.Data).To(Equal(map[string][]byte{"key": []byte("value")}))
+				Expect(kept.OwnerReferences).NotTo(ContainElement(HaveField("Kind", "VirtualMachine")))
+				Expect(k8sClient.Delete(ctx, kept)).To(Succeed())
+			}
+			// a managed secret no controller owns is adopted.
+			Expect(k8sClient.Create(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Namespace: secretKey.Namespace,
+				Name:      secretKey.Name,
+				Labels:    map[string]string{credentials.ManagedByLabel: credentials.ManagedBy},
+			}})).To(Succeed())
+			vm := &kubevirtv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: vmName, UID: "vm-uid"}}
+			Expect(credentials.ProjectSecret(ctx, k8sClient, k8sClient, vm, map[string]string{"root": "secret"})).To(Succeed())
+			adopted := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretKey, adopted)).To(Succeed())
+			Expect(metav1.GetControllerOf(adopted).UID).To(Equal(vm.UID))
+		})
+	})
+
+	Context("When CredentialPolicies select a VirtualMachine", func() {
+		ctx := context.Background()
+
+		policies := []*ipamv1alpha1.CredentialPolicy{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b-linux"},
+				Spec: ipamv1alpha1.CredentialPolicySpec{
+					VMSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"histack/oscategory": "linux"}},
+					Usernames:  map[string]string{"linux": "ubuntu"},
+				},
+			},
+			// sorts first but selects other VMs.
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a-windows"},
+				Spec: ipamv1alpha1.CredentialPolicySpec{
+					VMSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"histack/oscategory": "windows"}},
+				},
+			},
+		}
+		clusterPolicy := &ipamv1alpha1.ClusterCredentialPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "all"},
+			Spec: ipamv1alpha1.CredentialPolicySpec{
+				Usernames: map[string]string{"linux": "debian"},
+			},
+		}
+
+		BeforeEach(func() {
+			for _, policy := range policies {
+				Expect(k8sClient.Create(ctx, policy.DeepCopy())).To(Succeed())
+			}
+			Expect(k8sClient.Create(ctx, clusterPolicy.DeepCopy())).To(Succeed())
+		})
+
+		AfterEach(func() {
+			for _, policy := range policies {
+				Expect(k8sClient.Delete(ctx, policy.DeepCopy())).To(Succeed())
+			}
+			Expect(k8sClient.Delete(ctx, clusterPolicy.DeepCopy())).To(Succeed())
+		})
+
+		It("should prefer a namespaced policy and fall back to the cluster policy", func() {
+			controllerReconciler := &KubeVirtVMReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			vm := &kubevirtv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "linux-vm",
+				Labels:    map[string]string{"histack/oscategory": "linux"},
+			}}
+			policy, err := controllerReconciler.credentialPolicy(ctx, vm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vmUsername(vm, policy)).To(Equal("ubuntu"))
+
+			By("resolving a VM in a namespace without policies")
+			vm.Namespace = "kube-system"
+			policy, err = controllerReconciler.credentialPolicy(ctx, vm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vmUsername(vm, policy)).To(Equal("debian"))
+
+			By("falling back to the built-in usernames")
+			vm.Labels["histack/oscategory"] = "mikrotik"
+			Expect(vmUsername(vm, policy)).To(Equal("admin"))
+		})
+	})
+
+	Context("When a VirtualMachine has several networks", func() {
+		ctx := context.Background()
+
+		pools := []*ipamv1alpha1.ClusterIPPool{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "multi-nic-internal", Labels: map[string]string{"tier": "internal"}},
+				Spec:       ipamv1alpha1.ClusterIPPoolSpec{IPFamily: "v4", CIDR: "10.72.0.0/24", Gateway: "10.72.0.1"},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "multi-nic-public", Labels: map[string]string{"tier": "public"}},
+				Spec:       ipamv1alpha1.ClusterIPPoolSpec{IPFamily: "v4", CIDR: "10.73.0.0/24", Gateway: "10.73.0.1"},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "multi-nic-public-v6", Labels: map[string]string{"tier": "public"}},
+				Spec:       ipamv1alpha1.ClusterIPPoolSpec{IPFamily: "v6", CIDR: "fd00:73::/64", Gateway: "fd00:73::1"},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "multi-nic-internal-v6", Labels: map[string]string{"tier": "internal-v6"}},
+				Spec:       ipamv1alpha1.ClusterIPPoolSpec{IPFamily: "v6", CIDR: "fd00:72::/64", Gateway: "fd00:72::1"},
+			},
+		}
+
+		BeforeEach(func() {
+			for _, p := range pools {
+				pool := p.DeepCopy()
+				Expect(k8sClient.Create(ctx, pool)).To(Succeed())
+				pool.Status.TotalIPs = "254"
+				pool.Status.FreeIPs = "254"
+				pool.Status.AllocatedIPs = "0"
+				pool.Status.NextIndex = "0"
+				Expect(k8sClient.Status().Update(ctx, pool)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			var clusterIPs ipamv1alpha1.ClusterIPList
+			Expect(k8sClient.List(ctx, &clusterIPs)).To(Succeed())
+			for _, pool := range pools {
+				for i := range clusterIPs.Items {
+					if clusterIPs.Items[i].Spec.ClusterIPPool == pool.Name {
+						Expect(k8sClient.Delete(ctx, &clusterIPs.Items[i])).To(Succeed())
+					}
+				}
+				Expect(k8sClient.Delete(ctx, pool.DeepCopy())).To(Succeed())
+			}
+		})
+
+		It("should give every interface its own address and MAC", func() {
+			controllerReconciler := &KubeVirtVMReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			vm := multiNICVM("multi-nic-vm")
+
+			addresses := map[string]bool{}
+			macs := map[string]bool{}
+			for _, podIface := range helper.DeclaredPodInterfaces(&vm.Spec.Template.Spec) {
+				clusterIPs, err := controllerReconciler.interfaceClusterIPs(ctx, vm, nil, podIface)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(clusterIPs).To(HaveLen(1))
+				clusterIP := clusterIPs[0]
+				Expect(clusterIP.Spec.Interface).To(Equal(podIface.Name))
+				addresses[clusterIP.Spec.Address] = true
+				macs[clusterIP.Spec.Mac] = true
+			}
+			Expect(addresses).To(HaveLen(2))
+			Expect(macs).To(HaveLen(2))
+		})
+
+		It("should take the address of each network from its pool", func() {
+			controllerReconciler := &KubeVirtVMReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			vm := multiNICVM("network-pools-vm")
+			vm.Annotations = map[string]string{ipamv1alpha1.NetworkPoolsAnnotation: `{
+				"default": {"clusterIPPool": "multi-nic-internal"},
+				"public": {"poolSelector": {"matchLabels": {"tier": "public"}}}
+			}`}
+
+			expected := map[string]string{"default": "multi-nic-internal", "public": "multi-nic-public"}
+			for _, podIface := range helper.DeclaredPodInterfaces(&vm.Spec.Template.Spec) {
+				clusterIPs, err := controllerReconciler.interfaceClusterIPs(ctx, vm, nil, podIface)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(clusterIPs[0].Spec.ClusterIPPool).To(Equal(expected[podIface.Network.Name]))
+			}
+
+			By("failing on a broken annotation rather than taking any pool")
+			vm = multiNICVM("broken-network-pools-vm")
+			vm.Annotations = map[string]string{ipamv1alpha1.NetworkPoolsAnnotation: `{"public": `}
+			podIfaces := helper.DeclaredPodInterfaces(&vm.Spec.Template.Spec)
+			_, err := controllerReconciler.interfaceClusterIPs(ctx, vm, nil, podIfaces[1])
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should allocate an address of each family of the pools of a network", func() {
+			controllerReconciler := &KubeVirtVMReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			vm := multiNICVM("dual-stack-vm")
+			vm.Annotations = map[string]string{ipamv1alpha1.NetworkPoolsAnnotation: `{
+				"default": {"poolSelector": {"matchLabels": {"tier": "internal-v6"}}},
+				"public": {"poolSelector": {"matchLabels": {"tier": "public"}}}
+			}`}
+			podIfaces := helper.DeclaredPodInterfaces(&vm.Spec.Template.Spec)
+
+			defaultIPs, err := controllerReconciler.interfaceClusterIPs(ctx, vm, nil, podIfaces[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(defaultIPs).To(HaveLen(1))
+			Expect(defaultIPs[0].Spec.Family).To(Equal("v6"))
+			Expect(defaultIPs[0].Spec.ClusterIPPool).To(Equal("multi-nic-internal-v6"))
+
+			publicIPs, err := controllerReconciler.interfaceClusterIPs(ctx, vm, nil, podIfaces[1])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(publicIPs).To(HaveLen(2))
+			Expect(publicIPs[0].Spec.ClusterIPPool).To(Equal("multi-nic-public"))
+			Expect(publicIPs[1].Spec.ClusterIPPool).To(Equal("multi-nic-public-v6"))
+			Expect(publicIPs[1].Spec.Mac).To(Equal(publicIPs[0].Spec.Mac))
+
+			By("putting every address into the boot configuration")
+			cfg, err := controllerReconciler.bootConfig(ctx, vm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Interfaces).To(HaveLen(2))
+			Expect(cfg.Interfaces[0].Addresses).To(Equal([]string{defaultIPs[0].Spec.Address + "/64"}))
+			Expect(cfg.Interfaces[0].Gateways).To(Equal([]string{"fd00:72::1"}))
+			Expect(cfg.Interfaces[1].Addresses).To(Equal([]string{
+				publicIPs[0].Spec.Address + "/24", publicIPs[1].Spec.Address + "/64",
+			}))
+			Expect(cfg.Interfaces[1].Gateways).To(BeEmpty())
+		})
+
+		It("should leave the template of a created VM alone", func() {
+			controllerReconciler := &KubeVirtVMReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			vm := multiNICVM("created-vm")
+			vm.Status.Created = true
+			original := vm.DeepCopy()
+
+			Expect(controllerReconciler.ensureBootConfig(ctx, vm)).To(Succeed())
+			Expect(vm).To(Equal(original))
+			secret := &corev1.Secret{}
+			err := k8sClient.Get(ctx, types.NamespacedName{Namespace: vm.Namespace, Name: bootConfigSecretName(vm.Name)}, secret)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should return the reserved index when the ClusterIP cannot be created", func() {
+			controllerReconciler := &KubeVirtVMReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			vm := multiNICVM("rollback-vm")
+			// takes the name of the ClusterIP of eth0 without being bound to the VM.
+			blocker := &ipamv1alpha1.ClusterIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "default-rollback-vm-eth0"},
+				Spec: ipamv1alpha1.ClusterIPSpec{
+					ClusterIPPool: "missing-pool",
+					Address:       "10.74.0.2",
+					Family:        "v4",
+				},
+			}
+			Expect(k8sClient.Create(ctx, blocker)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, blocker)).To(Succeed())
+			})
+
+			podIfaces := helper.DeclaredPodInterfaces(&vm.Spec.Template.Spec)
+			_, err := controllerReconciler.interfaceClusterIPs(ctx, vm, nil, podIfaces[0])
+			Expect(errors.IsAlreadyExists(err)).To(BeTrue())
+
+			pool := &ipamv1alpha1.ClusterIPPool{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: pools[0].Name}, pool)).To(Succeed())
+			Expect(pool.Status.NextIndex).To(Equal("0"))
+			Expect(pool.Status.FreeIPs).To(Equal("254"))
+			Expect(pool.Status.AllocatedIPs).To(Equal("0"))
 		})
 	})
 })
+
+// multiNICVM returns a VirtualMachine with a pod network and a secondary network.
+func multiNICVM(name string) *kubevirtv1.VirtualMachine {
+	return &kubevirtv1.VirtualMachine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name + "-uid")},
+		Spec: kubevirtv1.VirtualMachineSpec{Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{
+			Spec: kubevirtv1.VirtualMachineInstanceSpec{
+				Domain: kubevirtv1.DomainSpec{Devices: kubevirtv1.Devices{Interfaces: []kubevirtv1.Interface{
+					{Name: "default"},
+					{Name: "public"},
+				}}},
+				Networks: []kubevirtv1.Network{
+					{Name: "default", NetworkSource: kubevirtv1.NetworkSource{Pod: &kubevirtv1.PodNetwork{}}},
+					{Name: "public", NetworkSource: kubevirtv1.NetworkSource{Multus: &kubevirtv1.MultusNetwork{NetworkName: "public"}}},
+				},
+			},
+		}},
+	}
+}
@@ -2,28 +2,47 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"strings"
 
 	"github.com/hicompute/histack/api/v1alpha1"
+	helper "github.com/hicompute/histack/pkg/helpers"
+	"github.com/hicompute/histack/pkg/ipam"
 	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// PortSwitch enables and disables the OVN logical switch ports of pod interfaces.
+type PortSwitch interface {
+	SetLogicalPortEnabled(lspName string, enabled bool) error
+}
+
 // KubevirtVMIReconciler reconciles a VirtualMachineInstance object
 type KubevirtVMIReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Ports suspends the port of an interface the guest configured with an
+	// address other than its ClusterIP. Mismatches are only reported when nil.
+	Ports PortSwitch
 }
 
-// +kubebuilder:rbac:groups=kubevirt.histack.ir,resources=virtualmachineinstances,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=kubevirt.histack.ir,resources=virtualmachineinstances/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups=kubevirt.histack.ir,resources=virtualmachineinstances/finalizers,verbs=update
+// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachineinstances,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=clusterips/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 func (r *KubevirtVMIReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := logf.FromContext(ctx)
 
@@ -39,48 +58,241 @@ func (r *KubevirtVMIReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if vmi.Status.Phase != kubevirtv1.Running {
 		return ctrl.Result{}, nil
 	}
-	interfaces := vmi.Status.Interfaces
-	if len(interfaces) == 0 {
-		return ctrl.Result{}, nil
+	if err := r.releaseUndeclared(ctx, &vmi); err != nil {
+		return ctrl.Result{}, err
 	}
+	if err := r.checkGuestAddresses(ctx, &vmi); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.allocateHotplugged(ctx, &vmi)
+}
+
+// releaseUndeclared releases the ClusterIPs of interfaces no longer declared in
+// the VMI spec. The interfaces reported by the guest agent are only logged:
+// they are empty without an agent and incomplete while the guest boots.
+func (r *KubevirtVMIReconciler) releaseUndeclared(ctx context.Context, vmi *kubevirtv1.VirtualMachineInstance) error {
+	log := logf.FromContext(ctx)
 
 	clusterIPList := v1alpha1.ClusterIPList{}
 	if err := r.List(ctx, &clusterIPList, &client.ListOptions{
-		FieldSelector: fields.OneTermEqualSelector("spec.resource", req.Namespace+"/"+req.Name),
+		FieldSelector: fields.OneTermEqualSelector(clusterIPResourceField, vmi.Namespace+"/"+vmi.Name),
 		Limit:         -1,
 	}); err != nil {
 		log.Error(err, "Error on getting cip list")
+		return err
 	}
 
-	releaseIpList := lo.Reduce(clusterIPList.Items, func(result []v1alpha1.ClusterIP, item v1alpha1.ClusterIP, _ int) []v1alpha1.ClusterIP {
-		_, ok := lo.Find(interfaces, func(i kubevirtv1.VirtualMachineInstanceNetworkInterface) bool {
-			return i.MAC == item.Spec.Mac
+	declared := map[string]kubevirtv1.Interface{}
+	for _, podIface := range helper.DeclaredPodInterfaces(&vmi.Spec) {
+		for _, name := range podIface.Names() {
+			declared[name] = podIface.Interface
+		}
+	}
+	for i := range clusterIPList.Items {
+		item := &clusterIPList.Items[i]
+		if !isWorkloadKind(item.Spec.ResourceKind) || item.Spec.Mac == "" {
+			// an IPClaim or FloatingIP with the name of the VMI holds its own address.
+			continue
+		}
+		iface, ok := declared[item.Spec.Interface]
+		if ok && (iface.MacAddress == "" || sameMAC(iface.MacAddress, item.Spec.Mac)) {
+			if len(vmi.Status.Interfaces) > 0 && !lo.ContainsBy(vmi.Status.Interfaces, func(i kubevirtv1.VirtualMachineInstanceNetworkInterface) bool {
+				return sameMAC(i.MAC, item.Spec.Mac)
+			}) {
+				log.V(1).Info("Guest does not report the MAC of a declared interface",
+					"clusterip", item.Name, "interface", iface.Name, "mac", item.Spec.Mac)
+			}
+			continue
+		}
+		log.Info("Releasing ClusterIP of an undeclared interface", "clusterip", item.Name, "interface", item.Spec.Interface)
+		if err := ipam.ReleaseClusterIP(ctx, r.Client, item, v1.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGuestAddresses compares the addresses the guest agent reports on each
+// interface with the ClusterIP of its MAC, and sets the AddressMismatch
+// condition of the ClusterIP. A guest using another address, possibly one of
+// another tenant, gets a warning event and, when enforcing, its port
+// suspended until it uses its own address again. Interfaces the agent
+// reports no address of are left as they are.
+func (r *KubevirtVMIReconciler) checkGuestAddresses(ctx context.Context, vmi *kubevirtv1.VirtualMachineInstance) error {
+	log := logf.FromContext(ctx)
+	if len(vmi.Status.Interfaces) == 0 {
+		return nil
+	}
+
+	var clusterIPList v1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPList, client.MatchingFields{clusterIPResourceField: vmi.Namespace + "/" + vmi.Name}); err != nil {
+		return err
+	}
+	for i := range clusterIPList.Items {
+		item := &clusterIPList.Items[i]
+		if !isWorkloadKind(item.Spec.ResourceKind) || item.Spec.Mac == "" {
+			continue
+		}
+		guestIface, ok := lo.Find(vmi.Status.Interfaces, func(iface kubevirtv1.VirtualMachineInstanceNetworkInterface) bool {
+			return sameMAC(iface.MAC, item.Spec.Mac)
 		})
 		if !ok {
-			historyItem := v1alpha1.ClusterIPHistory{
-				Mac:        item.Spec.Mac,
-				ReleasedAt: v1.Now(),
-				Interface:  item.Spec.Interface,
-				Resource:   item.Spec.Resource,
+			continue
+		}
+		reported := guestAddresses(guestIface, item.Spec.Family)
+		if len(reported) == 0 {
+			continue
+		}
+
+		previous := meta.FindStatusCondition(item.Status.Conditions, "AddressMismatch")
+		suspended := previous != nil && previous.Status == metav1.ConditionTrue && previous.Reason == "PortSuspended"
+		condition := metav1.Condition{
+			Type:    "AddressMismatch",
+			Status:  metav1.ConditionFalse,
+			Reason:  "GuestReportsAddress",
+			Message: fmt.Sprintf("the guest reports %s on %s", item.Spec.Address, guestIface.InterfaceName),
+		}
+		if !lo.Contains(reported, item.Spec.Address) {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "GuestReportsOtherAddress"
+			condition.Message = fmt.Sprintf("the guest reports %s on %s instead of %s",
+				strings.Join(reported, ", "), guestIface.InterfaceName, item.Spec.Address)
+		}
+
+		if r.Ports != nil && (condition.Status == metav1.ConditionTrue || suspended) {
+			port, err := r.logicalPort(ctx, vmi, item)
+			if err != nil {
+				return err
 			}
-			if len(item.Status.History) <= 0 {
-				item.Status.History = []v1alpha1.ClusterIPHistory{historyItem}
-			} else {
-				item.Status.History = append(item.Status.History, historyItem)
+			if port != "" {
+				enabled := condition.Status == metav1.ConditionFalse
+				if err := r.Ports.SetLogicalPortEnabled(port, enabled); err != nil {
+					log.Error(err, "Failed to switch the port of a mismatching address", "clusterip", item.Name, "port", port)
+					return err
+				}
+				if !enabled {
+					condition.Reason = "PortSuspended"
+				}
 			}
-			item.Spec.Mac = ""
-			item.Spec.Interface = ""
-			result = append(result, item)
 		}
-		return result
-	}, []v1alpha1.ClusterIP{})
 
-	for i := range releaseIpList {
-		if err := r.Update(ctx, &releaseIpList[i]); err != nil {
-			return ctrl.Result{}, err
+		if previous != nil && previous.Status == condition.Status && previous.Reason == condition.Reason && previous.Message == condition.Message {
+			continue
+		}
+		if condition.Status == metav1.ConditionTrue && (previous == nil || previous.Status != metav1.ConditionTrue) {
+			log.Info("Guest uses an address other than its ClusterIP", "clusterip", item.Name, "reported", reported)
+			if r.Recorder != nil {
+				r.Recorder.Event(item, corev1.EventTypeWarning, condition.Reason, condition.Message)
+			}
 		}
+		meta.SetStatusCondition(&item.Status.Conditions, condition)
+		if err := r.Status().Update(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guestAddresses are the addresses of the family the guest reports on an
+// interface, link-local ones left out.
+func guestAddresses(iface kubevirtv1.VirtualMachineInstanceNetworkInterface, family string) []string {
+	ips := iface.IPs
+	if len(ips) == 0 && iface.IP != "" {
+		ips = []string{iface.IP}
+	}
+	return lo.Filter(ips, func(address string, _ int) bool {
+		ip := net.ParseIP(address)
+		if ip == nil || ip.IsLinkLocalUnicast() {
+			return false
+		}
+		return (ip.To4() != nil) == (family != "v6")
+	})
+}
+
+// logicalPort is the OVN logical switch port of the pod interface of a
+// ClusterIP, as the CNI daemon names it. Empty while the VMI has no running pod.
+func (r *KubevirtVMIReconciler) logicalPort(ctx context.Context, vmi *kubevirtv1.VirtualMachineInstance, clusterIP *v1alpha1.ClusterIP) (string, error) {
+	pod, err := r.launcherPod(ctx, vmi)
+	if err != nil || pod == nil {
+		return "", err
+	}
+	return helper.LogicalPortName(pod.Namespace, pod.Name, clusterIP.Spec.Interface), nil
+}
+
+// allocateHotplugged binds a ClusterIP of each family of its pools to each
+// secondary interface declared after the launcher pod started, every network of a VM being served by
+// histack. The interfaces the pod started with got theirs from CNI ADD; the
+// CNI daemon on the node plugs the new ones into the running pod.
+func (r *KubevirtVMIReconciler) allocateHotplugged(ctx context.Context, vmi *kubevirtv1.VirtualMachineInstance) error {
+	log := logf.FromContext(ctx)
+
+	pod, err := r.launcherPod(ctx, vmi)
+	if err != nil || pod == nil {
+		return err
+	}
+	var clusterIPList v1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPList, client.MatchingFields{clusterIPResourceField: vmi.Namespace + "/" + vmi.Name}); err != nil {
+		return err
+	}
+
+	histackIPAM := ipam.NewWithClient(r.Client)
+	for _, podIface := range helper.DeclaredPodInterfaces(&vmi.Spec) {
+		if !podIface.Secondary() {
+			continue
+		}
+		request := ipam.IPAMRequest{Namespace: pod.Namespace, Name: pod.Name, Interface: podIface.Name}
+		families, err := histackIPAM.InterfaceFamilies(request)
+		if err != nil {
+			return err
+		}
+		// the MAC the interface declares, one seeded from the interface otherwise.
+		mac := ""
+		if hw, err := net.ParseMAC(podIface.Interface.MacAddress); err == nil {
+			mac = hw.String()
+		}
+		for _, family := range families {
+			if lo.ContainsBy(clusterIPList.Items, func(item v1alpha1.ClusterIP) bool {
+				return isWorkloadKind(item.Spec.ResourceKind) && item.Spec.Family == family && lo.Contains(podIface.Names(), item.Spec.Interface)
+			}) {
+				continue
+			}
+			request.Family = family
+			request.Mac = &mac
+			clusterIP, _, err := histackIPAM.FindOrCreateClusterIP(request)
+			if err != nil {
+				return err
+			}
+			log.Info("Allocated ClusterIP for a hotplugged interface", "clusterip", clusterIP.Name,
+				"network", podIface.Network.Name, "interface", podIface.Name, "address", clusterIP.Spec.Address)
+		}
+	}
+	return nil
+}
+
+// launcherPod returns the running virt-launcher pod of a VMI, nil if there is none.
+func (r *KubevirtVMIReconciler) launcherPod(ctx context.Context, vmi *kubevirtv1.VirtualMachineInstance) (*corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(vmi.Namespace),
+		client.MatchingLabels{kubevirtv1.CreatedByLabel: string(vmi.UID)}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp.IsZero() {
+			return pod, nil
+		}
+	}
+	return nil, nil
+}
+
+// sameMAC compares two MAC addresses regardless of their notation.
+func sameMAC(a, b string) bool {
+	macA, errA := net.ParseMAC(a)
+	macB, errB := net.ParseMAC(b)
+	if errA != nil || errB != nil {
+		return a == b
 	}
-	return ctrl.Result{}, nil
+	return macA.String() == macB.String()
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -17,16 +17,276 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"fmt"
+
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	helper "github.com/hicompute/histack/pkg/helpers"
 )
 
+// fakePorts records the enabled state of logical ports.
+type fakePorts map[string]bool
+
+func (f fakePorts) SetLogicalPortEnabled(lspName string, enabled bool) error {
+	f[lspName] = enabled
+	return nil
+}
+
 var _ = Describe("KubevirtVMReconciler Controller", func() {
-	Context("When reconciling a resource", func() {
+	Context("When a running VMI changes its interfaces", func() {
+		const vmiName = "running-vmi"
+
+		ctx := context.Background()
+
+		clusterIPs := []struct {
+			name, iface, mac string
+		}{
+			{"default-running-vmi-eth0", "eth0", "02:00:00:00:71:02"},
+			{"default-running-vmi-net1", "net1", "02:00:00:00:71:03"},
+			// the interface of a network removed from the spec.
+			{"default-running-vmi-net2", "net2", "02:00:00:00:71:04"},
+		}
+
+		BeforeEach(func() {
+			for i, cip := range clusterIPs {
+				Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+					ObjectMeta: metav1.ObjectMeta{Name: cip.name},
+					Spec: ipamv1alpha1.ClusterIPSpec{
+						ClusterIPPool: "missing-pool",
+						Address:       fmt.Sprintf("10.71.0.%d", i+2),
+						Family:        "v4",
+						Mac:           cip.mac,
+						Interface:     cip.iface,
+						Resource:      "default/" + vmiName,
+						ResourceKind:  "VirtualMachine",
+						ResourceUID:   "vm-uid",
+					},
+				})).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			for _, cip := range clusterIPs {
+				Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIP{ObjectMeta: metav1.ObjectMeta{Name: cip.name}})).To(Succeed())
+			}
+		})
+
+		It("should release only the addresses of undeclared interfaces", func() {
+			vmi := &kubevirtv1.VirtualMachineInstance{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: vmiName},
+				Spec: kubevirtv1.VirtualMachineInstanceSpec{
+					Domain: kubevirtv1.DomainSpec{Devices: kubevirtv1.Devices{Interfaces: []kubevirtv1.Interface{
+						{Name: "default"},
+						{Name: "public", MacAddress: "02-00-00-00-71-03"},
+					}}},
+					Networks: []kubevirtv1.Network{
+						{Name: "default", NetworkSource: kubevirtv1.NetworkSource{Pod: &kubevirtv1.PodNetwork{}}},
+						{Name: "public", NetworkSource: kubevirtv1.NetworkSource{Multus: &kubevirtv1.MultusNetwork{NetworkName: "public"}}},
+					},
+				},
+				// the guest agent reports nothing yet.
+				Status: kubevirtv1.VirtualMachineInstanceStatus{Phase: kubevirtv1.Running},
+			}
+			controllerReconciler := &KubevirtVMIReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			Expect(controllerReconciler.releaseUndeclared(ctx, vmi)).To(Succeed())
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			for _, kept := range clusterIPs[:2] {
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: kept.name}, cip)).To(Succeed())
+				Expect(cip.Spec.Mac).To(Equal(kept.mac))
+			}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: clusterIPs[2].name}, cip)).To(Succeed())
+			Expect(cip.Spec.Mac).To(BeEmpty())
+		})
+	})
+
+	Context("When the guest configures another address", func() {
+		const (
+			vmiName       = "mismatched-vmi"
+			clusterIPName = "default-mismatched-vmi-eth0"
+		)
+
+		ctx := context.Background()
+		pod := &corev1.Pod{}
+
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterIPName},
+				Spec: ipamv1alpha1.ClusterIPSpec{
+					ClusterIPPool: "missing-pool",
+					Address:       "10.72.0.2",
+					Family:        "v4",
+					Mac:           "02:00:00:00:72:02",
+					Interface:     "eth0",
+					Resource:      "default/" + vmiName,
+					ResourceKind:  "VirtualMachine",
+					ResourceUID:   "vm-uid",
+				},
+			})).To(Succeed())
+			*pod = corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "virt-launcher-" + vmiName + "-abcde",
+					Labels:    map[string]string{kubevirtv1.CreatedByLabel: "vmi-uid"},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "compute", Image: "virt-launcher"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			pod.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIP{ObjectMeta: metav1.ObjectMeta{Name: clusterIPName}})).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+		})
+
+		It("should report the mismatch and suspend the port until the guest uses its address", func() {
+			vmi := &kubevirtv1.VirtualMachineInstance{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: vmiName, UID: "vmi-uid"},
+				Status: kubevirtv1.VirtualMachineInstanceStatus{
+					Phase: kubevirtv1.Running,
+					Interfaces: []kubevirtv1.VirtualMachineInstanceNetworkInterface{{
+						InterfaceName: "eth0",
+						MAC:           "02:00:00:00:72:02",
+						IPs:           []string{"10.72.0.99", "fe80::1"},
+					}},
+				},
+			}
+			ports := fakePorts{}
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &KubevirtVMIReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: recorder,
+				Ports:    ports,
+			}
+			// named after the VM the launcher pod runs.
+			port := "default_" + vmiName + "_eth0"
+
+			Expect(controllerReconciler.checkGuestAddresses(ctx, vmi)).To(Succeed())
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: clusterIPName}, cip)).To(Succeed())
+			condition := meta.FindStatusCondition(cip.Status.Conditions, "AddressMismatch")
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal("PortSuspended"))
+			Expect(ports).To(Equal(fakePorts{port: false}))
+			Expect(recorder.Events).To(HaveLen(1))
+
+			By("the guest going back to its own address")
+			vmi.Status.Interfaces[0].IPs = []string{"10.72.0.2"}
+			Expect(controllerReconciler.checkGuestAddresses(ctx, vmi)).To(Succeed())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: clusterIPName}, cip)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(cip.Status.Conditions, "AddressMismatch")).To(BeTrue())
+			Expect(ports).To(Equal(fakePorts{port: true}))
+			Expect(recorder.Events).To(HaveLen(1))
+		})
+	})
+
+	Context("When a network is hotplugged into a running VMI", func() {
+		const (
+			vmiName  = "hotplug-vmi"
+			poolName = "hotplug-pool"
+		)
+
+		ctx := context.Background()
+		pod := &corev1.Pod{}
+
+		BeforeEach(func() {
+			pool := &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.73.0.0/24",
+					Gateway:  "10.73.0.1",
+				},
+			}
+			Expect(k8sClient.Create(ctx, pool)).To(Succeed())
+			pool.Status.TotalIPs = "254"
+			pool.Status.FreeIPs = "254"
+			pool.Status.AllocatedIPs = "0"
+			pool.Status.NextIndex = "0"
+			Expect(k8sClient.Status().Update(ctx, pool)).To(Succeed())
+
+			// the VirtualMachine API is not served, the pod owns its addresses.
+			*pod = corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "virt-launcher-" + vmiName + "-abcde",
+					Labels:    map[string]string{kubevirtv1.CreatedByLabel: "hotplug-vmi-uid"},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "compute", Image: "virt-launcher"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			pod.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			var clusterIPs ipamv1alpha1.ClusterIPList
+			Expect(k8sClient.List(ctx, &clusterIPs)).To(Succeed())
+			for i := range clusterIPs.Items {
+				if clusterIPs.Items[i].Spec.ClusterIPPool == poolName {
+					Expect(k8sClient.Delete(ctx, &clusterIPs.Items[i])).To(Succeed())
+				}
+			}
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIPPool{ObjectMeta: metav1.ObjectMeta{Name: poolName}})).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+		})
+
+		It("should allocate the address of the new interface with its MAC once", func() {
+			vmi := &kubevirtv1.VirtualMachineInstance{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: vmiName, UID: "hotplug-vmi-uid"},
+				Spec: kubevirtv1.VirtualMachineInstanceSpec{
+					Domain: kubevirtv1.DomainSpec{Devices: kubevirtv1.Devices{Interfaces: []kubevirtv1.Interface{
+						{Name: "default"},
+						{Name: "public", MacAddress: "02-00-00-00-73-09"},
+					}}},
+					Networks: []kubevirtv1.Network{
+						{Name: "default", NetworkSource: kubevirtv1.NetworkSource{Pod: &kubevirtv1.PodNetwork{}}},
+						{Name: "public", NetworkSource: kubevirtv1.NetworkSource{Multus: &kubevirtv1.MultusNetwork{NetworkName: "public"}}},
+					},
+				},
+				Status: kubevirtv1.VirtualMachineInstanceStatus{Phase: kubevirtv1.Running},
+			}
+			controllerReconciler := &KubevirtVMIReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			poolClusterIPs := func() []ipamv1alpha1.ClusterIP {
+				var clusterIPs ipamv1alpha1.ClusterIPList
+				Expect(k8sClient.List(ctx, &clusterIPs)).To(Succeed())
+				var items []ipamv1alpha1.ClusterIP
+				for _, item := range clusterIPs.Items {
+					if item.Spec.ClusterIPPool == poolName {
+						items = append(items, item)
+					}
+				}
+				return items
+			}
 
-		It("should successfully reconcile the resource", func() {
+			Expect(controllerReconciler.allocateHotplugged(ctx, vmi)).To(Succeed())
+			allocated := poolClusterIPs()
+			Expect(allocated).To(HaveLen(1))
+			Expect(allocated[0].Spec.Interface).To(Equal(helper.HashedPodInterfaceName("public")))
+			Expect(allocated[0].Spec.Family).To(Equal("v4"))
+			Expect(allocated[0].Spec.Mac).To(Equal("02:00:00:00:73:09"))
 
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+			Expect(controllerReconciler.allocateHotplugged(ctx, vmi)).To(Succeed())
+			Expect(poolClusterIPs()).To(HaveLen(1))
 		})
 	})
 })
@@ -0,0 +1,185 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/ipam"
+)
+
+// vmNameLabel marks virt-launcher pods, their ClusterIPs belong to the VM.
+const vmNameLabel = "vm.kubevirt.io/name"
+
+// PodReconciler releases the ClusterIPs of plain pods once the pod is gone.
+// Addresses of virt-launcher pods are handled by the KubeVirt controllers.
+type PodReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// APIReader confirms a pod is gone past the cache, the Client when nil.
+	APIReader client.Reader
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+// Reconcile applies the release policy to the ClusterIPs of a deleted pod.
+// Deleted pods are seen as tombstones: the pod is not found, or its ClusterIPs
+// name a pod of another uid. ClusterIPs are watched too, so pods deleted while
+// the manager was down are caught on the next start. A ClusterIP event may
+// come before a new pod reaches the cache, so the API server confirms the pod
+// is gone before anything is released.
+func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
+	var pod corev1.Pod
+	live, err := getPod(ctx, r.Client, req.NamespacedName, &pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if live && pod.Labels[vmNameLabel] != "" {
+		return ctrl.Result{}, nil
+	}
+
+	var clusterIPs ipamv1alpha1.ClusterIPList
+	if err := r.List(ctx, &clusterIPs, client.MatchingFields{clusterIPResourceField: req.Namespace + "/" + req.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	deletedAt := metav1.Now()
+	confirmed := false
+	for i := range clusterIPs.Items {
+		clusterIP := &clusterIPs.Items[i]
+		if clusterIP.Status.RetainedUntil != nil || (clusterIP.Spec.ResourceUID == "" && clusterIP.Spec.ResourceKind != "") {
+			// already retained for a pod with the same name.
+			continue
+		}
+		if live && boundToPod(clusterIP, &pod) {
+			continue
+		}
+		if !confirmed {
+			if live, err = getPod(ctx, r.apiReader(), req.NamespacedName, &pod); err != nil {
+				return ctrl.Result{}, err
+			}
+			confirmed = true
+			if live && pod.Labels[vmNameLabel] != "" {
+				return ctrl.Result{}, nil
+			}
+			if live && boundToPod(clusterIP, &pod) {
+				continue
+			}
+		}
+		owned, err := r.ownedByPod(ctx, clusterIP)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !owned {
+			continue
+		}
+		log.Info("Pod is gone, releasing ClusterIP", "pod", req.NamespacedName, "clusterip", clusterIP.Name)
+		if err := ipam.ReleaseOrRetain(ctx, r.Client, clusterIP, deletedAt); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *PodReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
+
+// getPod reads the pod and reports whether it exists.
+func getPod(ctx context.Context, reader client.Reader, key types.NamespacedName, pod *corev1.Pod) (bool, error) {
+	if err := reader.Get(ctx, key, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// boundToPod reports whether a ClusterIP is still bound to the live pod, or
+// left for the IPAM to hand over to it.
+func boundToPod(clusterIP *ipamv1alpha1.ClusterIP, pod *corev1.Pod) bool {
+	return clusterIP.Spec.ResourceUID == "" || clusterIP.Spec.ResourceUID == pod.UID ||
+		clusterIP.Spec.Retention == ipamv1alpha1.ClusterIPRetentionSticky
+}
+
+// ownedByPod reports whether a ClusterIP belongs to a plain pod. ClusterIPs
+// allocated before the kind was recorded are checked against the KubeVirt
+// objects sharing their resource name.
+func (r *PodReconciler) ownedByPod(ctx context.Context, clusterIP *ipamv1alpha1.ClusterIP) (bool, error) {
+	if clusterIP.Spec.ResourceKind != "" {
+		return clusterIP.Spec.ResourceKind == "Pod", nil
+	}
+	namespace, name, _ := cutResource(clusterIP.Spec.Resource)
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	for _, obj := range []client.Object{&kubevirtv1.VirtualMachine{}, &kubevirtv1.VirtualMachineInstance{}} {
+		if err := r.Get(ctx, key, obj); err == nil {
+			return false, nil
+		} else if !errors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetLabels()[vmNameLabel] == ""
+		}))).
+		Watches(&ipamv1alpha1.ClusterIP{}, handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+			cip := obj.(*ipamv1alpha1.ClusterIP)
+			if cip.Spec.ResourceKind != "" && cip.Spec.ResourceKind != "Pod" {
+				return nil
+			}
+			namespace, name, ok := cutResource(cip.Spec.Resource)
+			if !ok {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}}
+		})).
+		Named("pod").
+		Complete(r)
+}
+
+// cutResource splits the namespace/name of a ClusterIP resource.
+func cutResource(resource string) (namespace, name string, ok bool) {
+	namespace, name, ok = strings.Cut(resource, "/")
+	return namespace, name, ok && namespace != "" && name != ""
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+)
+
+var _ = Describe("Pod Controller", func() {
+	Context("When reconciling a pod", func() {
+		const poolName = "pod-pool"
+
+		ctx := context.Background()
+		podKey := types.NamespacedName{Namespace: "default", Name: "pod-controller-test"}
+		clusterIPKey := types.NamespacedName{Name: "default-pod-controller-test-eth0"}
+
+		var controllerReconciler *PodReconciler
+
+		BeforeEach(func() {
+			controllerReconciler = &PodReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: poolName},
+				Spec: ipamv1alpha1.ClusterIPPoolSpec{
+					IPFamily: "v4",
+					CIDR:     "10.30.0.0/24",
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIP{ObjectMeta: metav1.ObjectMeta{Name: clusterIPKey.Name}})).To(Succeed())
+			Expect(k8sClient.Delete(ctx, &ipamv1alpha1.ClusterIPPool{ObjectMeta: metav1.ObjectMeta{Name: poolName}})).To(Succeed())
+		})
+
+		createClusterIP := func(uid types.UID) {
+			Expect(k8sClient.Create(ctx, &ipamv1alpha1.ClusterIP{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterIPKey.Name},
+				Spec: ipamv1alpha1.ClusterIPSpec{
+					ClusterIPPool: poolName,
+					Address:       "10.30.0.5",
+					Family:        "v4",
+					Mac:           "02:00:00:00:00:05",
+					Interface:     "eth0",
+					Resource:      podKey.Namespace + "/" + podKey.Name,
+					ResourceKind:  "Pod",
+					ResourceUID:   uid,
+				},
+			})).To(Succeed())
+		}
+
+		It("should keep the ClusterIP of a live pod", func() {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: podKey.Namespace, Name: podKey.Name},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "busybox"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+			})
+			createClusterIP(pod.UID)
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: podKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, clusterIPKey, cip)).To(Succeed())
+			Expect(cip.Spec.Resource).To(Equal(podKey.Namespace + "/" + podKey.Name))
+		})
+
+		It("should keep the ClusterIP of a pod the cache has not seen yet", func() {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: podKey.Namespace, Name: podKey.Name},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "busybox"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+			})
+			createClusterIP(pod.UID)
+			controllerReconciler.Client = podlessCache{k8sClient}
+			controllerReconciler.APIReader = k8sClient
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: podKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, clusterIPKey, cip)).To(Succeed())
+			Expect(cip.Spec.ResourceUID).To(Equal(pod.UID))
+			Expect(cip.Spec.Mac).NotTo(BeEmpty())
+		})
+
+		It("should release the ClusterIP of a deleted pod", func() {
+			createClusterIP("deleted-pod-uid")
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: podKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			cip := &ipamv1alpha1.ClusterIP{}
+			Expect(k8sClient.Get(ctx, clusterIPKey, cip)).To(Succeed())
+			Expect(cip.Spec.Resource).To(BeEmpty())
+			Expect(cip.Spec.Mac).To(BeEmpty())
+			Expect(cip.Status.History).To(HaveLen(1))
+			Expect(cip.Status.History[0].Resource).To(Equal(podKey.Namespace + "/" + podKey.Name))
+		})
+	})
+})
+
+// podlessCache is a client whose cache has not seen any pod yet.
+type podlessCache struct {
+	client.Client
+}
+
+func (c podlessCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if _, ok := obj.(*corev1.Pod); ok {
+		return apierrors.NewNotFound(corev1.Resource("pods"), key.Name)
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
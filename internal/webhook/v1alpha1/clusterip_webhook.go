@@ -0,0 +1,251 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	netutils "github.com/hicompute/histack/pkg/net_utils"
+)
+
+// log is for logging in this package.
+var clusteriplog = logf.Log.WithName("clusterip-resource")
+
+// SetupClusterIPWebhookWithManager registers the webhook for ClusterIP in the manager.
+func SetupClusterIPWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&ipamv1alpha1.ClusterIP{}).
+		WithValidator(&ClusterIPCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-ipam-histack-ir-v1alpha1-clusterip,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.histack.ir,resources=clusterips,verbs=create;update;delete,versions=v1alpha1,name=vclusterip-v1alpha1.kb.io,admissionReviewVersions=v1
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kubevirt.io,resources=virtualmachineinstances,verbs=get;list;watch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=ipclaims,verbs=get;list;watch
+// +kubebuilder:rbac:groups=ipam.histack.ir,resources=floatingips,verbs=get;list;watch
+
+// ClusterIPCustomValidator struct is responsible for validating the ClusterIP resource
+// when it is created, updated, or deleted.
+type ClusterIPCustomValidator struct {
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &ClusterIPCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type ClusterIP.
+func (v *ClusterIPCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	clusterIP, ok := obj.(*ipamv1alpha1.ClusterIP)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterIP object but got %T", obj)
+	}
+	clusteriplog.Info("Validation for ClusterIP upon creation", "name", clusterIP.GetName())
+
+	return nil, v.validate(ctx, nil, clusterIP)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type ClusterIP.
+func (v *ClusterIPCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	clusterIP, ok := newObj.(*ipamv1alpha1.ClusterIP)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterIP object for the newObj but got %T", newObj)
+	}
+	oldClusterIP, ok := oldObj.(*ipamv1alpha1.ClusterIP)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterIP object for the oldObj but got %T", oldObj)
+	}
+	clusteriplog.Info("Validation for ClusterIP upon update", "name", clusterIP.GetName())
+
+	return nil, v.validate(ctx, oldClusterIP, clusterIP)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type ClusterIP.
+func (v *ClusterIPCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	clusterIP, ok := obj.(*ipamv1alpha1.ClusterIP)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterIP object but got %T", obj)
+	}
+	clusteriplog.Info("Validation for ClusterIP upon deletion", "name", clusterIP.GetName())
+
+	live, err := v.resourceExists(ctx, clusterIP)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	if live {
+		return nil, apierrors.NewForbidden(ipamv1alpha1.GroupVersion.WithResource("clusterips").GroupResource(), clusterIP.Name,
+			fmt.Errorf("still bound to %s, release it first", clusterIP.Spec.Resource))
+	}
+	return nil, nil
+}
+
+func (v *ClusterIPCustomValidator) validate(ctx context.Context, oldClusterIP, clusterIP *ipamv1alpha1.ClusterIP) error {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if oldClusterIP != nil && oldClusterIP.Spec.ClusterIPPool != clusterIP.Spec.ClusterIPPool {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("clusterIPPool"), "field is immutable"))
+	}
+
+	// The pool is only consulted when the address itself changes, so bindings
+	// can still be released after the pool is gone.
+	if oldClusterIP == nil || oldClusterIP.Spec.Address != clusterIP.Spec.Address || oldClusterIP.Spec.Family != clusterIP.Spec.Family {
+		errs, err := v.validateAddress(ctx, clusterIP)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		allErrs = append(allErrs, errs...)
+	}
+
+	if clusterIP.Spec.Mac != "" && (oldClusterIP == nil || oldClusterIP.Spec.Mac != clusterIP.Spec.Mac) {
+		errs, err := v.validateMac(ctx, clusterIP)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		allErrs = append(allErrs, errs...)
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(ipamv1alpha1.GroupVersion.WithKind("ClusterIP").GroupKind(), clusterIP.Name, allErrs)
+}
+
+// validateAddress checks the address belongs to the pool and is not handed out twice.
+func (v *ClusterIPCustomValidator) validateAddress(ctx context.Context, clusterIP *ipamv1alpha1.ClusterIP) (field.ErrorList, error) {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	addressPath := specPath.Child("address")
+
+	address := net.ParseIP(clusterIP.Spec.Address)
+	if address == nil {
+		return append(allErrs, field.Invalid(addressPath, clusterIP.Spec.Address, "not a valid IP address")), nil
+	}
+	if family := netutils.IPFamily(address); family != clusterIP.Spec.Family {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("family"), clusterIP.Spec.Family,
+			fmt.Sprintf("address %s is an IP%s address", clusterIP.Spec.Address, family)))
+	}
+
+	var pool ipamv1alpha1.ClusterIPPool
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: clusterIP.Spec.ClusterIPPool}, &pool); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		allErrs = append(allErrs, field.NotFound(specPath.Child("clusterIPPool"), clusterIP.Spec.ClusterIPPool))
+	} else {
+		if !pool.DeletionTimestamp.IsZero() {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("clusterIPPool"),
+				fmt.Sprintf("ClusterIPPool %s is being deleted", pool.Name)))
+		}
+		if pool.Spec.IPFamily != clusterIP.Spec.Family {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("family"), clusterIP.Spec.Family,
+				fmt.Sprintf("does not match the family %s of ClusterIPPool %s", pool.Spec.IPFamily, pool.Name)))
+		}
+		if _, ipNet, err := net.ParseCIDR(pool.Spec.CIDR); err == nil && !ipNet.Contains(address) {
+			allErrs = append(allErrs, field.Invalid(addressPath, clusterIP.Spec.Address,
+				fmt.Sprintf("not inside %s of ClusterIPPool %s", pool.Spec.CIDR, pool.Name)))
+		}
+	}
+
+	var list ipamv1alpha1.ClusterIPList
+	if err := v.Client.List(ctx, &list, client.MatchingFields{"spec.address": address.String()}); err != nil {
+		return nil, err
+	}
+	for _, other := range list.Items {
+		if other.Name != clusterIP.Name && address.Equal(net.ParseIP(other.Spec.Address)) {
+			allErrs = append(allErrs, field.Duplicate(addressPath, fmt.Sprintf("%s (ClusterIP %s)", clusterIP.Spec.Address, other.Name)))
+		}
+	}
+	return allErrs, nil
+}
+
+// validateMac checks the MAC is a unicast ethernet address not used by another ClusterIP.
+func (v *ClusterIPCustomValidator) validateMac(ctx context.Context, clusterIP *ipamv1alpha1.ClusterIP) (field.ErrorList, error) {
+	var allErrs field.ErrorList
+	macPath := field.NewPath("spec", "mac")
+
+	mac, err := net.ParseMAC(clusterIP.Spec.Mac)
+	if err != nil || len(mac) != 6 {
+		return append(allErrs, field.Invalid(macPath, clusterIP.Spec.Mac, "not a valid ethernet MAC address")), nil
+	}
+	if mac[0]&0x01 != 0 {
+		return append(allErrs, field.Invalid(macPath, clusterIP.Spec.Mac, "must be a unicast MAC address")), nil
+	}
+
+	var list ipamv1alpha1.ClusterIPList
+	if err := v.Client.List(ctx, &list, client.MatchingFields{"spec.mac": mac.String()}); err != nil {
+		return nil, err
+	}
+	for _, other := range list.Items {
+		if other.Name == clusterIP.Name || other.Spec.Mac == "" || other.Spec.Family != clusterIP.Spec.Family {
+			continue
+		}
+		if otherMac, err := net.ParseMAC(other.Spec.Mac); err == nil && otherMac.String() == mac.String() {
+			allErrs = append(allErrs, field.Duplicate(macPath, fmt.Sprintf("%s (ClusterIP %s)", clusterIP.Spec.Mac, other.Name)))
+		}
+	}
+	return allErrs, nil
+}
+
+// resourceExists reports whether the workload a ClusterIP is bound to still
+// exists. When the ClusterIP records the workload's kind and uid, a workload
+// recreated under the same name does not count.
+func (v *ClusterIPCustomValidator) resourceExists(ctx context.Context, clusterIP *ipamv1alpha1.ClusterIP) (bool, error) {
+	namespace, name, ok := strings.Cut(clusterIP.Spec.Resource, "/")
+	if !ok || namespace == "" || name == "" {
+		return false, nil
+	}
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+
+	for _, candidate := range []struct {
+		kind string
+		obj  client.Object
+	}{
+		{"VirtualMachine", &kubevirtv1.VirtualMachine{}},
+		{"VirtualMachineInstance", &kubevirtv1.VirtualMachineInstance{}},
+		{"Pod", &corev1.Pod{}},
+		{ipamv1alpha1.IPClaimKind, &ipamv1alpha1.IPClaim{}},
+		{ipamv1alpha1.FloatingIPKind, &ipamv1alpha1.FloatingIP{}},
+	} {
+		if clusterIP.Spec.ResourceKind != "" && clusterIP.Spec.ResourceKind != candidate.kind {
+			continue
+		}
+		obj := candidate.obj
+		if err := v.Client.Get(ctx, key, obj); apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if clusterIP.Spec.ResourceUID == "" || clusterIP.Spec.ResourceUID == obj.GetUID() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
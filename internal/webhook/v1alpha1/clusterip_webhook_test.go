@@ -0,0 +1,218 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	ipamv1beta1 "github.com/hicompute/histack/api/v1beta1"
+)
+
+func newClusterIP(name, address, mac, resource string) *ipamv1alpha1.ClusterIP {
+	return &ipamv1alpha1.ClusterIP{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ipamv1alpha1.ClusterIPSpec{
+			ClusterIPPool: "pool",
+			Interface:     "eth0",
+			Address:       address,
+			Mac:           mac,
+			Family:        "v4",
+			Resource:      resource,
+		},
+	}
+}
+
+var _ = Describe("ClusterIP Webhook", func() {
+	var (
+		ctx       context.Context
+		validator ClusterIPCustomValidator
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		validator = ClusterIPCustomValidator{
+			Client: newFakeClient(
+				newPool("pool", "v4", "192.168.10.0/24", "192.168.10.1"),
+				newClusterIP("taken", "192.168.10.5", "02:00:00:00:00:05", "default/vm1"),
+				&kubevirtv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vm1", UID: "vm1-uid"}},
+			),
+		}
+	})
+
+	Context("When creating ClusterIP under Validating Webhook", func() {
+		It("Should admit a free address inside the pool", func() {
+			_, err := validator.ValidateCreate(ctx, newClusterIP("cip", "192.168.10.6", "02:00:00:00:00:06", "default/vm2"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny an address outside the pool", func() {
+			_, err := validator.ValidateCreate(ctx, newClusterIP("cip", "192.168.11.6", "", ""))
+			Expect(err).To(MatchError(ContainSubstring("spec.address")))
+		})
+
+		It("Should deny a duplicate address", func() {
+			_, err := validator.ValidateCreate(ctx, newClusterIP("cip", "192.168.10.5", "", ""))
+			Expect(err).To(MatchError(ContainSubstring("taken")))
+		})
+
+		It("Should deny a family that does not match the pool", func() {
+			cip := newClusterIP("cip", "192.168.10.6", "", "")
+			cip.Spec.Family = "v6"
+			_, err := validator.ValidateCreate(ctx, cip)
+			Expect(err).To(MatchError(ContainSubstring("spec.family")))
+		})
+
+		It("Should deny malformed and duplicate MACs", func() {
+			_, err := validator.ValidateCreate(ctx, newClusterIP("cip", "192.168.10.6", "02:00:00", ""))
+			Expect(err).To(MatchError(ContainSubstring("spec.mac")))
+			_, err = validator.ValidateCreate(ctx, newClusterIP("cip", "192.168.10.6", "02:00:00:00:00:05", ""))
+			Expect(err).To(MatchError(ContainSubstring("taken")))
+			_, err = validator.ValidateCreate(ctx, newClusterIP("cip", "192.168.10.6", "02-00-00-00-00-05", ""))
+			Expect(err).To(MatchError(ContainSubstring("taken")))
+		})
+
+		It("Should deny an address from a pool being deleted", func() {
+			pool := newPool("pool", "v4", "192.168.10.0/24", "192.168.10.1")
+			pool.Finalizers = []string{ipamv1alpha1.ClusterIPPoolFinalizer}
+			pool.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			validator.Client = newFakeClient(pool)
+
+			_, err := validator.ValidateCreate(ctx, newClusterIP("cip", "192.168.10.6", "", ""))
+			Expect(err).To(MatchError(ContainSubstring("being deleted")))
+		})
+	})
+
+	Context("When updating ClusterIP under Validating Webhook", func() {
+		It("Should deny changing the pool", func() {
+			oldCIP := newClusterIP("taken", "192.168.10.5", "02:00:00:00:00:05", "default/vm1")
+			newCIP := oldCIP.DeepCopy()
+			newCIP.Spec.ClusterIPPool = "other"
+			_, err := validator.ValidateUpdate(ctx, oldCIP, newCIP)
+			Expect(err).To(MatchError(ContainSubstring("immutable")))
+		})
+
+		It("Should admit releasing the binding", func() {
+			oldCIP := newClusterIP("taken", "192.168.10.5", "02:00:00:00:00:05", "default/vm1")
+			newCIP := oldCIP.DeepCopy()
+			newCIP.Spec.Mac = ""
+			newCIP.Spec.Resource = ""
+			_, err := validator.ValidateUpdate(ctx, oldCIP, newCIP)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When deleting ClusterIP under Validating Webhook", func() {
+		It("Should deny deleting an address bound to a live VM", func() {
+			_, err := validator.ValidateDelete(ctx, newClusterIP("taken", "192.168.10.5", "02:00:00:00:00:05", "default/vm1"))
+			Expect(err).To(MatchError(ContainSubstring("still bound")))
+		})
+
+		It("Should admit deleting an address whose workload is gone", func() {
+			_, err := validator.ValidateDelete(ctx, newClusterIP("stale", "192.168.10.7", "02:00:00:00:00:07", "default/gone"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should admit deleting an address of a previous VM with the same name", func() {
+			cip := newClusterIP("stale", "192.168.10.7", "02:00:00:00:00:07", "default/vm1")
+			cip.Spec.ResourceKind = "VirtualMachine"
+			cip.Spec.ResourceUID = "previous-uid"
+			_, err := validator.ValidateDelete(ctx, cip)
+			Expect(err).NotTo(HaveOccurred())
+
+			cip.Spec.ResourceUID = "vm1-uid"
+			_, err = validator.ValidateDelete(ctx, cip)
+			Expect(err).To(MatchError(ContainSubstring("still bound")))
+		})
+	})
+
+	Context("When converting ClusterIP under Conversion Webhook", func() {
+		It("Should map the v1alpha1 binding to a bindingRef", func() {
+			hub := &ipamv1beta1.ClusterIP{}
+			Expect(newClusterIP("cip", "192.168.10.6", "02:00:00:00:00:06", "default/vm2").ConvertTo(hub)).To(Succeed())
+			Expect(hub.Spec.BindingRef).To(Equal(&ipamv1beta1.ClusterIPBindingRef{
+				Namespace: "default",
+				Name:      "vm2",
+				Interface: "eth0",
+				Mac:       "02:00:00:00:00:06",
+			}))
+			Expect(hub.Status.Phase).To(Equal(ipamv1beta1.ClusterIPPhaseBound))
+
+			released := &ipamv1beta1.ClusterIP{}
+			Expect(newClusterIP("cip", "192.168.10.6", "", "default/vm2").ConvertTo(released)).To(Succeed())
+			Expect(released.Spec.BindingRef.Name).To(Equal("vm2"))
+			Expect(released.Status.Phase).To(Equal(ipamv1beta1.ClusterIPPhaseReleased))
+		})
+
+		It("Should carry kind, uid and retention through v1alpha1", func() {
+			hub := &ipamv1beta1.ClusterIP{}
+			hub.Name = "cip"
+			hub.Spec = ipamv1beta1.ClusterIPSpec{
+				ClusterIPPool: "pool",
+				Address:       "192.168.10.6",
+				Family:        "v4",
+				BindingRef: &ipamv1beta1.ClusterIPBindingRef{
+					Kind:      "VirtualMachine",
+					Namespace: "default",
+					Name:      "vm2",
+					UID:       types.UID("1234"),
+					Interface: "eth0",
+					Mac:       "02:00:00:00:00:06",
+				},
+				Retention: ipamv1beta1.ClusterIPRetentionSticky,
+			}
+			hub.Status.Phase = ipamv1beta1.ClusterIPPhaseBound
+
+			spoke := &ipamv1alpha1.ClusterIP{}
+			Expect(spoke.ConvertFrom(hub)).To(Succeed())
+			Expect(spoke.Spec.Resource).To(Equal("default/vm2"))
+			Expect(spoke.Spec.ResourceUID).To(Equal(types.UID("1234")))
+			Expect(spoke.Annotations).NotTo(HaveKey(ipamv1alpha1.ConversionDataAnnotation))
+
+			back := &ipamv1beta1.ClusterIP{}
+			Expect(spoke.ConvertTo(back)).To(Succeed())
+			Expect(back.Spec).To(Equal(hub.Spec))
+		})
+
+		It("Should preserve a phase v1alpha1 cannot express while the binding is unchanged", func() {
+			hub := &ipamv1beta1.ClusterIP{}
+			Expect(newClusterIP("cip", "192.168.10.6", "02:00:00:00:00:06", "default/vm2").ConvertTo(hub)).To(Succeed())
+			hub.Status.Phase = ipamv1beta1.ClusterIPPhaseReleased
+
+			spoke := &ipamv1alpha1.ClusterIP{}
+			Expect(spoke.ConvertFrom(hub)).To(Succeed())
+			Expect(spoke.Annotations).To(HaveKey(ipamv1alpha1.ConversionDataAnnotation))
+
+			back := &ipamv1beta1.ClusterIP{}
+			Expect(spoke.DeepCopy().ConvertTo(back)).To(Succeed())
+			Expect(back.Status.Phase).To(Equal(ipamv1beta1.ClusterIPPhaseReleased))
+
+			By("rebinding through v1alpha1")
+			spoke.Spec.Resource = "default/vm3"
+			rebound := &ipamv1beta1.ClusterIP{}
+			Expect(spoke.ConvertTo(rebound)).To(Succeed())
+			Expect(rebound.Status.Phase).To(Equal(ipamv1beta1.ClusterIPPhaseBound))
+		})
+	})
+})
@@ -0,0 +1,276 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	helper "github.com/hicompute/histack/pkg/helpers"
+	netutils "github.com/hicompute/histack/pkg/net_utils"
+)
+
+// log is for logging in this package.
+var clusterippoollog = logf.Log.WithName("clusterippool-resource")
+
+// SetupClusterIPPoolWebhookWithManager registers the webhook for ClusterIPPool in the manager.
+// podCIDRs and serviceCIDRs are the cluster networks no pool is allowed to overlap.
+// When defaultGateway is set, pools without a gateway get the first usable address of their cidr.
+func SetupClusterIPPoolWebhookWithManager(mgr ctrl.Manager, podCIDRs, serviceCIDRs []*net.IPNet, defaultGateway bool) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&ipamv1alpha1.ClusterIPPool{}).
+		WithValidator(&ClusterIPPoolCustomValidator{
+			Client:       mgr.GetClient(),
+			PodCIDRs:     podCIDRs,
+			ServiceCIDRs: serviceCIDRs,
+		}).
+		WithDefaulter(&ClusterIPPoolCustomDefaulter{
+			DefaultGateway: defaultGateway,
+		}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-ipam-histack-ir-v1alpha1-clusterippool,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipam.histack.ir,resources=clusterippools,verbs=create;update,versions=v1alpha1,name=mclusterippool-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// ClusterIPPoolCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind ClusterIPPool when those are created or updated.
+type ClusterIPPoolCustomDefaulter struct {
+	DefaultGateway bool
+}
+
+var _ webhook.CustomDefaulter = &ClusterIPPoolCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind ClusterIPPool.
+func (d *ClusterIPPoolCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	pool, ok := obj.(*ipamv1alpha1.ClusterIPPool)
+	if !ok {
+		return fmt.Errorf("expected a ClusterIPPool object but got %T", obj)
+	}
+	clusterippoollog.Info("Defaulting for ClusterIPPool", "name", pool.GetName())
+
+	ip, ipNet, err := net.ParseCIDR(pool.Spec.CIDR)
+	if err != nil {
+		// Left for the validating webhook to reject.
+		return nil
+	}
+	pool.Spec.CIDR = ipNet.String()
+	if pool.Spec.IPFamily == "" {
+		pool.Spec.IPFamily = netutils.IPFamily(ip)
+	}
+
+	if d.DefaultGateway && pool.Spec.Gateway == "" {
+		// The IPv6 network address is the subnet-router anycast address, skip it.
+		index := big.NewInt(0)
+		if ip.To4() == nil {
+			index = big.NewInt(1)
+		}
+		if gateway, err := netutils.PickUsableIPFromCIDRIndex(pool.Spec.CIDR, index); err == nil {
+			pool.Spec.Gateway = gateway
+		}
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-ipam-histack-ir-v1alpha1-clusterippool,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.histack.ir,resources=clusterippools,verbs=create;update,versions=v1alpha1,name=vclusterippool-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// ClusterIPPoolCustomValidator struct is responsible for validating the ClusterIPPool resource
+// when it is created, updated, or deleted.
+type ClusterIPPoolCustomValidator struct {
+	Client       client.Reader
+	PodCIDRs     []*net.IPNet
+	ServiceCIDRs []*net.IPNet
+}
+
+var _ webhook.CustomValidator = &ClusterIPPoolCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type ClusterIPPool.
+func (v *ClusterIPPoolCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	pool, ok := obj.(*ipamv1alpha1.ClusterIPPool)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterIPPool object but got %T", obj)
+	}
+	clusterippoollog.Info("Validation for ClusterIPPool upon creation", "name", pool.GetName())
+
+	return nil, v.validate(ctx, nil, pool)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type ClusterIPPool.
+func (v *ClusterIPPoolCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	pool, ok := newObj.(*ipamv1alpha1.ClusterIPPool)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterIPPool object for the newObj but got %T", newObj)
+	}
+	oldPool, ok := oldObj.(*ipamv1alpha1.ClusterIPPool)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterIPPool object for the oldObj but got %T", oldObj)
+	}
+	clusterippoollog.Info("Validation for ClusterIPPool upon update", "name", pool.GetName())
+
+	return nil, v.validate(ctx, oldPool, pool)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type ClusterIPPool.
+func (v *ClusterIPPoolCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *ClusterIPPoolCustomValidator) validate(ctx context.Context, oldPool, pool *ipamv1alpha1.ClusterIPPool) error {
+	allErrs := validateClusterIPPoolSpec(pool)
+	if len(allErrs) == 0 {
+		errs, err := v.validateOverlaps(ctx, pool)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		allErrs = append(allErrs, errs...)
+	}
+
+	if oldPool != nil && !sameNetwork(oldPool.Spec.CIDR, pool.Spec.CIDR) {
+		inUse, err := v.hasAllocations(ctx, oldPool)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		if inUse {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "cidr"),
+				"cidr cannot be changed while addresses are allocated from the pool"))
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(ipamv1alpha1.GroupVersion.WithKind("ClusterIPPool").GroupKind(), pool.Name, allErrs)
+}
+
+// sameNetwork reports whether two cidrs are the same network. A pool stored
+// before its cidr was normalized, e.g. 10.0.0.5/24, is updated as 10.0.0.0/24.
+func sameNetwork(a, b string) bool {
+	_, aNet, aErr := net.ParseCIDR(a)
+	_, bNet, bErr := net.ParseCIDR(b)
+	if aErr != nil || bErr != nil {
+		return a == b
+	}
+	return aNet.String() == bNet.String()
+}
+
+// validateClusterIPPoolSpec checks the spec on its own, without looking at other objects.
+func validateClusterIPPoolSpec(pool *ipamv1alpha1.ClusterIPPool) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	ip, ipNet, err := net.ParseCIDR(pool.Spec.CIDR)
+	if err != nil {
+		return append(allErrs, field.Invalid(specPath.Child("cidr"), pool.Spec.CIDR, err.Error()))
+	}
+	if family := netutils.IPFamily(ip); family != pool.Spec.IPFamily {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("ipFamily"), pool.Spec.IPFamily,
+			fmt.Sprintf("cidr %s is an IP%s network", pool.Spec.CIDR, family)))
+	}
+
+	retainForPath := specPath.Child("retainFor")
+	if pool.Spec.RetainFor != nil && pool.Spec.RetainFor.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(retainForPath, pool.Spec.RetainFor.Duration.String(), "must not be negative"))
+	}
+	if pool.Spec.ReleasePolicy == ipamv1alpha1.ReleasePolicyRetainFor && (pool.Spec.RetainFor == nil || pool.Spec.RetainFor.Duration == 0) {
+		allErrs = append(allErrs, field.Required(retainForPath, "required when releasePolicy is RetainFor"))
+	}
+
+	if pool.Spec.Gateway == "" {
+		return allErrs
+	}
+	gatewayPath := specPath.Child("gateway")
+	gateway := net.ParseIP(pool.Spec.Gateway)
+	switch {
+	case gateway == nil:
+		allErrs = append(allErrs, field.Invalid(gatewayPath, pool.Spec.Gateway, "not a valid IP address"))
+	case netutils.IPFamily(gateway) != netutils.IPFamily(ip):
+		allErrs = append(allErrs, field.Invalid(gatewayPath, pool.Spec.Gateway, "gateway and cidr must be of the same IP family"))
+	case ipNet.Contains(gateway):
+		if netutils.IsNetworkOrBroadcast(gateway, ipNet) {
+			allErrs = append(allErrs, field.Invalid(gatewayPath, pool.Spec.Gateway, "gateway cannot be the network or broadcast address"))
+		}
+	case !gateway.IsGlobalUnicast():
+		// A gateway outside the cidr is reached through a point-to-point route.
+		allErrs = append(allErrs, field.Invalid(gatewayPath, pool.Spec.Gateway,
+			"a gateway outside the cidr must be a unicast point-to-point address"))
+	}
+	return allErrs
+}
+
+// validateOverlaps rejects pools overlapping other pools or the cluster's pod and service networks.
+func (v *ClusterIPPoolCustomValidator) validateOverlaps(ctx context.Context, pool *ipamv1alpha1.ClusterIPPool) (field.ErrorList, error) {
+	var allErrs field.ErrorList
+	cidrPath := field.NewPath("spec", "cidr")
+	_, ipNet, _ := net.ParseCIDR(pool.Spec.CIDR)
+
+	for _, c := range v.PodCIDRs {
+		if netutils.CIDRsOverlap(ipNet, c) {
+			allErrs = append(allErrs, field.Invalid(cidrPath, pool.Spec.CIDR, fmt.Sprintf("overlaps the pod network %s", c)))
+		}
+	}
+	for _, c := range v.ServiceCIDRs {
+		if netutils.CIDRsOverlap(ipNet, c) {
+			allErrs = append(allErrs, field.Invalid(cidrPath, pool.Spec.CIDR, fmt.Sprintf("overlaps the service network %s", c)))
+		}
+	}
+
+	var pools ipamv1alpha1.ClusterIPPoolList
+	if err := v.Client.List(ctx, &pools); err != nil {
+		return nil, err
+	}
+	for _, other := range pools.Items {
+		if other.Name == pool.Name {
+			continue
+		}
+		_, otherNet, err := net.ParseCIDR(other.Spec.CIDR)
+		if err != nil {
+			continue
+		}
+		if netutils.CIDRsOverlap(ipNet, otherNet) {
+			allErrs = append(allErrs, field.Invalid(cidrPath, pool.Spec.CIDR,
+				fmt.Sprintf("overlaps ClusterIPPool %s (%s)", other.Name, other.Spec.CIDR)))
+		}
+	}
+	return allErrs, nil
+}
+
+// hasAllocations reports whether any ClusterIP was handed out from the pool.
+func (v *ClusterIPPoolCustomValidator) hasAllocations(ctx context.Context, pool *ipamv1alpha1.ClusterIPPool) (bool, error) {
+	if helper.StringToBigInt(pool.Status.AllocatedIPs).Sign() > 0 {
+		return true, nil
+	}
+	var clusterIPs ipamv1alpha1.ClusterIPList
+	if err := v.Client.List(ctx, &clusterIPs); err != nil {
+		return false, err
+	}
+	for _, cip := range clusterIPs.Items {
+		if cip.Spec.ClusterIPPool == pool.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	ipamv1beta1 "github.com/hicompute/histack/api/v1beta1"
+	netutils "github.com/hicompute/histack/pkg/net_utils"
+)
+
+func newPool(name, family, cidr, gateway string) *ipamv1alpha1.ClusterIPPool {
+	return &ipamv1alpha1.ClusterIPPool{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ipamv1alpha1.ClusterIPPoolSpec{
+			IPFamily: family,
+			CIDR:     cidr,
+			Gateway:  gateway,
+		},
+	}
+}
+
+var _ = Describe("ClusterIPPool Webhook", func() {
+	var (
+		ctx       context.Context
+		validator ClusterIPPoolCustomValidator
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		podCIDRs, err := netutils.ParseCIDRList("10.244.0.0/16")
+		Expect(err).NotTo(HaveOccurred())
+		serviceCIDRs, err := netutils.ParseCIDRList("10.96.0.0/12")
+		Expect(err).NotTo(HaveOccurred())
+		validator = ClusterIPPoolCustomValidator{
+			Client:       newFakeClient(newPool("existing", "v4", "192.168.10.0/24", "")),
+			PodCIDRs:     podCIDRs,
+			ServiceCIDRs: serviceCIDRs,
+		}
+	})
+
+	Context("When creating ClusterIPPool under Defaulting Webhook", func() {
+		It("Should infer the family and normalize the cidr", func() {
+			pool := newPool("pool", "", "192.168.20.17/24", "")
+			Expect((&ClusterIPPoolCustomDefaulter{}).Default(ctx, pool)).To(Succeed())
+			Expect(pool.Spec.IPFamily).To(Equal("v4"))
+			Expect(pool.Spec.CIDR).To(Equal("192.168.20.0/24"))
+			Expect(pool.Spec.Gateway).To(BeEmpty())
+
+			pool = newPool("pool", "", "fd00:10::5/64", "")
+			Expect((&ClusterIPPoolCustomDefaulter{}).Default(ctx, pool)).To(Succeed())
+			Expect(pool.Spec.IPFamily).To(Equal("v6"))
+			Expect(pool.Spec.CIDR).To(Equal("fd00:10::/64"))
+		})
+
+		It("Should default the gateway to the first usable address when enabled", func() {
+			defaulter := &ClusterIPPoolCustomDefaulter{DefaultGateway: true}
+			pool := newPool("pool", "", "192.168.20.0/24", "")
+			Expect(defaulter.Default(ctx, pool)).To(Succeed())
+			Expect(pool.Spec.Gateway).To(Equal("192.168.20.1"))
+
+			pool = newPool("pool", "", "fd00:10::/64", "")
+			Expect(defaulter.Default(ctx, pool)).To(Succeed())
+			Expect(pool.Spec.Gateway).To(Equal("fd00:10::1"))
+
+			pool = newPool("pool", "", "192.168.20.0/24", "185.20.31.1")
+			Expect(defaulter.Default(ctx, pool)).To(Succeed())
+			Expect(pool.Spec.Gateway).To(Equal("185.20.31.1"))
+		})
+	})
+
+	Context("When creating ClusterIPPool under Validating Webhook", func() {
+		It("Should admit a valid pool", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v4", "192.168.20.0/24", "192.168.20.1"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should admit a point-to-point gateway outside the cidr", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v4", "185.20.30.0/24", "185.20.31.1"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny an unparsable cidr", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v4", "192.168.20.0/33", ""))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should deny a cidr that does not match the family", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v6", "192.168.20.0/24", ""))
+			Expect(err).To(MatchError(ContainSubstring("spec.ipFamily")))
+		})
+
+		It("Should deny the broadcast address as gateway", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v4", "192.168.20.0/24", "192.168.20.255"))
+			Expect(err).To(MatchError(ContainSubstring("spec.gateway")))
+		})
+
+		It("Should deny a gateway of another family", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v4", "192.168.20.0/24", "fd00::1"))
+			Expect(err).To(MatchError(ContainSubstring("spec.gateway")))
+		})
+
+		It("Should deny overlapping pools", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v4", "192.168.0.0/16", ""))
+			Expect(err).To(MatchError(ContainSubstring("existing")))
+		})
+
+		It("Should deny overlaps with the pod and service networks", func() {
+			_, err := validator.ValidateCreate(ctx, newPool("pool", "v4", "10.244.1.0/24", ""))
+			Expect(err).To(MatchError(ContainSubstring("pod network")))
+			_, err = validator.ValidateCreate(ctx, newPool("pool", "v4", "10.100.0.0/24", ""))
+			Expect(err).To(MatchError(ContainSubstring("service network")))
+		})
+
+		It("Should require retainFor with the RetainFor release policy", func() {
+			pool := newPool("pool", "v4", "192.168.20.0/24", "")
+			pool.Spec.ReleasePolicy = ipamv1alpha1.ReleasePolicyRetainFor
+			_, err := validator.ValidateCreate(ctx, pool)
+			Expect(err).To(MatchError(ContainSubstring("spec.retainFor")))
+
+			pool.Spec.RetainFor = &metav1.Duration{Duration: time.Hour}
+			_, err = validator.ValidateCreate(ctx, pool)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When updating ClusterIPPool under Validating Webhook", func() {
+		It("Should not count the pool itself as an overlap", func() {
+			oldPool := newPool("existing", "v4", "192.168.10.0/24", "")
+			newPool := oldPool.DeepCopy()
+			newPool.Spec.Gateway = "192.168.10.1"
+			_, err := validator.ValidateUpdate(ctx, oldPool, newPool)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny changing the cidr while addresses are allocated", func() {
+			oldPool := newPool("existing", "v4", "192.168.10.0/24", "")
+			oldPool.Status.AllocatedIPs = "3"
+			newPool := oldPool.DeepCopy()
+			newPool.Spec.CIDR = "192.168.10.0/23"
+			_, err := validator.ValidateUpdate(ctx, oldPool, newPool)
+			Expect(err).To(MatchError(ContainSubstring("cannot be changed")))
+		})
+
+		It("Should allow normalizing the cidr of an allocated pool", func() {
+			oldPool := newPool("existing", "v4", "192.168.10.5/24", "")
+			oldPool.Status.AllocatedIPs = "3"
+			newPool := oldPool.DeepCopy()
+			defaulter := ClusterIPPoolCustomDefaulter{}
+			Expect(defaulter.Default(ctx, newPool)).To(Succeed())
+			Expect(newPool.Spec.CIDR).To(Equal("192.168.10.0/24"))
+			newPool.Finalizers = append(newPool.Finalizers, ipamv1alpha1.ClusterIPPoolFinalizer)
+			_, err := validator.ValidateUpdate(ctx, oldPool, newPool)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should allow changing the cidr of an empty pool", func() {
+			oldPool := newPool("existing", "v4", "192.168.10.0/24", "")
+			newPool := oldPool.DeepCopy()
+			newPool.Spec.CIDR = "192.168.10.0/23"
+			_, err := validator.ValidateUpdate(ctx, oldPool, newPool)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+	Context("When converting ClusterIPPool under Conversion Webhook", func() {
+		It("Should round-trip the v1alpha1 status counters through v1beta1", func() {
+			pool := newPool("pool", "v6", "fd00::/64", "")
+			pool.Status.TotalIPs = "18446744073709551614"
+			pool.Status.AllocatedIPs = "1000"
+			pool.Status.FreeIPs = "18446744073709550614"
+			pool.Status.NextIndex = "1000"
+			pool.Status.ReleasedClusterIPs = []string{"cip-a"}
+			pool.Spec.Public = true
+
+			hub := &ipamv1beta1.ClusterIPPool{}
+			Expect(pool.ConvertTo(hub)).To(Succeed())
+			Expect(hub.Spec.Public).To(BeTrue())
+			Expect(hub.Status.TotalIPs.String()).To(Equal("18446744073709551614"))
+			Expect(hub.Status.ReleasedClusterIPs).To(Equal([]ipamv1beta1.ReleasedClusterIP{{Name: "cip-a"}}))
+
+			back := &ipamv1alpha1.ClusterIPPool{}
+			Expect(back.ConvertFrom(hub)).To(Succeed())
+			Expect(back.Spec).To(Equal(pool.Spec))
+			Expect(back.Status).To(Equal(pool.Status))
+			Expect(back.Annotations).NotTo(HaveKey(ipamv1alpha1.ConversionDataAnnotation))
+		})
+
+		It("Should preserve released addresses through v1alpha1", func() {
+			allocated := resource.MustParse("2")
+			hub := &ipamv1beta1.ClusterIPPool{}
+			hub.Name = "pool"
+			hub.Spec = ipamv1beta1.ClusterIPPoolSpec{IPFamily: "v4", CIDR: "192.168.10.0/24"}
+			hub.Status.AllocatedIPs = &allocated
+			hub.Status.ReleasedClusterIPs = []ipamv1beta1.ReleasedClusterIP{{Name: "cip-a", Address: "192.168.10.7"}}
+
+			spoke := &ipamv1alpha1.ClusterIPPool{}
+			Expect(spoke.ConvertFrom(hub)).To(Succeed())
+			Expect(spoke.Status.AllocatedIPs).To(Equal("2"))
+			Expect(spoke.Status.ReleasedClusterIPs).To(Equal([]string{"cip-a"}))
+			Expect(spoke.Annotations).To(HaveKey(ipamv1alpha1.ConversionDataAnnotation))
+
+			back := &ipamv1beta1.ClusterIPPool{}
+			Expect(spoke.ConvertTo(back)).To(Succeed())
+			Expect(back.Status.ReleasedClusterIPs).To(Equal(hub.Status.ReleasedClusterIPs))
+			Expect(back.Annotations).NotTo(HaveKey(ipamv1alpha1.ConversionDataAnnotation))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	"github.com/hicompute/histack/pkg/ipam"
+)
+
+// log is for logging in this package.
+var virtualmachinelog = logf.Log.WithName("virtualmachine-resource")
+
+// SetupVirtualMachineWebhookWithManager registers the webhook for VirtualMachine in the manager.
+func SetupVirtualMachineWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&kubevirtv1.VirtualMachine{}).
+		WithValidator(&VirtualMachineCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// The allocation refuses a claim used elsewhere as well, so VirtualMachines
+// are not blocked while the webhook is unavailable.
+// +kubebuilder:webhook:path=/validate-kubevirt-io-v1-virtualmachine,mutating=false,failurePolicy=ignore,sideEffects=None,groups=kubevirt.io,resources=virtualmachines,verbs=create;update,versions=v1,name=vvirtualmachine-v1.kb.io,admissionReviewVersions=v1
+
+// VirtualMachineCustomValidator struct is responsible for validating the IPClaims
+// a VirtualMachine names when it is created or updated.
+type VirtualMachineCustomValidator struct {
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &VirtualMachineCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type VirtualMachine.
+func (v *VirtualMachineCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	vm, ok := obj.(*kubevirtv1.VirtualMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected a VirtualMachine object but got %T", obj)
+	}
+	virtualmachinelog.Info("Validation for VirtualMachine upon creation", "name", vm.GetName())
+
+	return nil, v.validate(ctx, vm)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type VirtualMachine.
+func (v *VirtualMachineCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	vm, ok := newObj.(*kubevirtv1.VirtualMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected a VirtualMachine object for the newObj but got %T", newObj)
+	}
+	oldVM, ok := oldObj.(*kubevirtv1.VirtualMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected a VirtualMachine object for the oldObj but got %T", oldObj)
+	}
+	if oldVM.Annotations[ipamv1alpha1.IPClaimAnnotation] == vm.Annotations[ipamv1alpha1.IPClaimAnnotation] {
+		return nil, nil
+	}
+	virtualmachinelog.Info("Validation for VirtualMachine upon update", "name", vm.GetName())
+
+	return nil, v.validate(ctx, vm)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type VirtualMachine.
+func (v *VirtualMachineCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate denies IPClaims another workload that still exists uses.
+func (v *VirtualMachineCustomValidator) validate(ctx context.Context, vm *kubevirtv1.VirtualMachine) error {
+	var allErrs field.ErrorList
+	claimsPath := field.NewPath("metadata", "annotations").Key(ipamv1alpha1.IPClaimAnnotation)
+
+	for _, name := range strings.Split(vm.Annotations[ipamv1alpha1.IPClaimAnnotation], ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		var claim ipamv1alpha1.IPClaim
+		if err := v.Client.Get(ctx, client.ObjectKey{Namespace: vm.Namespace, Name: name}, &claim); err != nil {
+			if apierrors.IsNotFound(err) {
+				// the claim may be created after the VirtualMachine.
+				continue
+			}
+			return apierrors.NewInternalError(err)
+		}
+		consumer := claim.Status.Consumer
+		if consumer == nil || (consumer.Kind == "VirtualMachine" && consumer.Name == vm.Name) {
+			continue
+		}
+		exists, err := ipam.ConsumerExists(ctx, v.Client, claim.Namespace, consumer)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		if exists {
+			allErrs = append(allErrs, field.Forbidden(claimsPath,
+				fmt.Sprintf("IPClaim %s is used by %s %s", name, consumer.Kind, consumer.Name)))
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(kubevirtv1.VirtualMachineGroupVersionKind.GroupKind(), vm.Name, allErrs)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+)
+
+func newClaimVM(name, claims string) *kubevirtv1.VirtualMachine {
+	return &kubevirtv1.VirtualMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			UID:         types.UID(name + "-uid"),
+			Annotations: map[string]string{ipamv1alpha1.IPClaimAnnotation: claims},
+		},
+	}
+}
+
+func newConsumedClaim(name string, consumer *ipamv1alpha1.IPClaimConsumer) *ipamv1alpha1.IPClaim {
+	return &ipamv1alpha1.IPClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Status:     ipamv1alpha1.IPClaimStatus{Phase: ipamv1alpha1.IPClaimBound, Consumer: consumer},
+	}
+}
+
+var _ = Describe("VirtualMachine Webhook", func() {
+	var (
+		ctx       context.Context
+		validator VirtualMachineCustomValidator
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		validator = VirtualMachineCustomValidator{
+			Client: newFakeClient(
+				newClaimVM("vm1", "web"),
+				newConsumedClaim("web", &ipamv1alpha1.IPClaimConsumer{Kind: "VirtualMachine", Name: "vm1", UID: "vm1-uid"}),
+				newConsumedClaim("stale", &ipamv1alpha1.IPClaimConsumer{Kind: "VirtualMachine", Name: "gone", UID: "gone-uid"}),
+				newConsumedClaim("free", nil),
+			),
+		}
+	})
+
+	Context("When creating VirtualMachine under Validating Webhook", func() {
+		It("Should deny an IPClaim another VirtualMachine uses", func() {
+			_, err := validator.ValidateCreate(ctx, newClaimVM("vm2", "free, web"))
+			Expect(err).To(MatchError(ContainSubstring("IPClaim web is used by VirtualMachine vm1")))
+		})
+
+		It("Should admit a free IPClaim and one whose consumer is gone", func() {
+			_, err := validator.ValidateCreate(ctx, newClaimVM("vm2", "free,stale,missing"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When updating VirtualMachine under Validating Webhook", func() {
+		It("Should admit the consumer of the IPClaim", func() {
+			oldVM := newClaimVM("vm1", "")
+			_, err := validator.ValidateUpdate(ctx, oldVM, newClaimVM("vm1", "web"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny adding an IPClaim another VirtualMachine uses", func() {
+			oldVM := newClaimVM("vm2", "free")
+			_, err := validator.ValidateUpdate(ctx, oldVM, newClaimVM("vm2", "free,web"))
+			Expect(err).To(MatchError(ContainSubstring("is used by")))
+		})
+	})
+})
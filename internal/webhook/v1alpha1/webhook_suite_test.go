@@ -0,0 +1,77 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	ipamv1alpha1 "github.com/hicompute/histack/api/v1alpha1"
+	// +kubebuilder:scaffold:imports
+)
+
+// These tests use Ginkgo (BDD-style Go testing framework). Refer to
+// http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
+// The validators only read other objects, so a fake client is enough and the
+// suite does not need an envtest API server.
+
+var scheme = runtime.NewScheme()
+
+func TestWebhooks(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Webhook Suite")
+}
+
+var _ = BeforeSuite(func() {
+	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
+
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(ipamv1alpha1.AddToScheme(scheme)).To(Succeed())
+	Expect(kubevirtv1.AddToScheme(scheme)).To(Succeed())
+	// +kubebuilder:scaffold:scheme
+})
+
+// newFakeClient returns a client preloaded with the given objects and the
+// ClusterIP indexes the validators list with.
+func newFakeClient(objs ...client.Object) client.Client {
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithIndex(&ipamv1alpha1.ClusterIP{}, "spec.address", func(obj client.Object) []string {
+			if address := net.ParseIP(obj.(*ipamv1alpha1.ClusterIP).Spec.Address); address != nil {
+				return []string{address.String()}
+			}
+			return nil
+		}).
+		WithIndex(&ipamv1alpha1.ClusterIP{}, "spec.mac", func(obj client.Object) []string {
+			if mac, err := net.ParseMAC(obj.(*ipamv1alpha1.ClusterIP).Spec.Mac); err == nil {
+				return []string{mac.String()}
+			}
+			return nil
+		}).
+		Build()
+}
@@ -0,0 +1,30 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	ipamv1beta1 "github.com/hicompute/histack/api/v1beta1"
+)
+
+// SetupClusterIPPoolWebhookWithManager registers the conversion webhook for ClusterIPPool in the manager.
+// Validation and defaulting stay on v1alpha1, the API server converts v1beta1 requests for them.
+func SetupClusterIPPoolWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&ipamv1beta1.ClusterIPPool{}).
+		Complete()
+}
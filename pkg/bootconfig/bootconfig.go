@@ -0,0 +1,245 @@
+// Package bootconfig renders the configuration VMs read on first boot:
+// cloud-init NoCloud data for Linux, a sysprep answer file for Windows and an
+// initial script for Mikrotik RouterOS. Passwords are left out, the guest
+// agent sets them from the credentials of the VM.
+package bootconfig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Interface is a network interface of a VM with static addresses, one of
+// each family of its network.
+type Interface struct {
+	// Mac finds the interface in the guest.
+	Mac string
+	// Addresses in CIDR notation, e.g. 10.0.0.5/24.
+	Addresses []string
+	// Gateways of the default routes, one per family at most.
+	Gateways []string
+}
+
+// Config is what a VM is set up with on first boot.
+type Config struct {
+	Hostname          string
+	Username          string
+	SSHAuthorizedKeys []string
+	Interfaces        []Interface
+}
+
+// CloudInit renders NoCloud user-data and network-data (version 2) for Linux.
+func CloudInit(cfg Config) (userData, networkData string, err error) {
+	user := map[string]any{
+		"name":        cfg.Username,
+		"lock_passwd": false,
+	}
+	if cfg.Username != "root" {
+		user["groups"] = []string{"sudo"}
+		user["sudo"] = "ALL=(ALL) NOPASSWD:ALL"
+		user["shell"] = "/bin/bash"
+	}
+	if len(cfg.SSHAuthorizedKeys) > 0 {
+		user["ssh_authorized_keys"] = cfg.SSHAuthorizedKeys
+	}
+	rawUserData, err := yaml.Marshal(map[string]any{
+		"hostname":     cfg.Hostname,
+		"ssh_pwauth":   true,
+		"disable_root": cfg.Username != "root",
+		"users":        []any{user},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	ethernets := map[string]any{}
+	for i, iface := range cfg.Interfaces {
+		ethernet := map[string]any{
+			"match":     map[string]string{"macaddress": strings.ToLower(iface.Mac)},
+			"addresses": iface.Addresses,
+		}
+		var routes []map[string]string
+		for _, gateway := range iface.Gateways {
+			routes = append(routes, map[string]string{"to": "default", "via": gateway})
+		}
+		if len(routes) > 0 {
+			ethernet["routes"] = routes
+		}
+		ethernets[fmt.Sprintf("nic%d", i)] = ethernet
+	}
+	rawNetworkData, err := yaml.Marshal(map[string]any{
+		"version":   2,
+		"ethernets": ethernets,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return "#cloud-config\n" + string(rawUserData), string(rawNetworkData), nil
+}
+
+var unattend = template.Must(template.New("unattend").Funcs(template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var b bytes.Buffer
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+	"mac": func(s string) string {
+		return strings.ToUpper(strings.ReplaceAll(s, ":", "-"))
+	},
+	"hasIPv4": func(addresses []string) bool {
+		return slices.ContainsFunc(addresses, func(address string) bool { return !ipv6(address) })
+	},
+	"hasIPv6":      func(addresses []string) bool { return slices.ContainsFunc(addresses, ipv6) },
+	"inc":          func(i int) int { return i + 1 },
+	"defaultRoute": defaultRoute,
+}).Parse(`<?xml version="1.0" encoding="utf-8"?>
+<unattend xmlns="urn:schemas-microsoft-com:unattend" xmlns:wcm="http://schemas.microsoft.com/WMIConfig/2002/State">
+  <settings pass="specialize">
+    <component name="Microsoft-Windows-Shell-Setup" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+      <ComputerName>{{ xml .ComputerName }}</ComputerName>
+    </component>
+    <component name="Microsoft-Windows-Deployment" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+      <RunSynchronous>
+        <RunSynchronousCommand wcm:action="add">
+          <Order>1</Order>
+          <Path>cmd /c net user "{{ xml .Username }}" /add &amp; net user "{{ xml .Username }}" /active:yes &amp; net localgroup Administrators "{{ xml .Username }}" /add</Path>
+        </RunSynchronousCommand>
+      </RunSynchronous>
+    </component>
+    <component name="Microsoft-Windows-TCPIP" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+      <Interfaces>
+{{- range .Interfaces }}
+        <Interface wcm:action="add">
+          <Identifier>{{ mac .Mac }}</Identifier>
+{{- if hasIPv4 .Addresses }}
+          <Ipv4Settings>
+            <DhcpEnabled>false</DhcpEnabled>
+          </Ipv4Settings>
+{{- end }}
+{{- if hasIPv6 .Addresses }}
+          <Ipv6Settings>
+            <DhcpEnabled>false</DhcpEnabled>
+          </Ipv6Settings>
+{{- end }}
+          <UnicastIpAddresses>
+{{- range $i, $address := .Addresses }}
+            <IpAddress wcm:action="add" wcm:keyValue="{{ inc $i }}">{{ xml $address }}</IpAddress>
+{{- end }}
+          </UnicastIpAddresses>
+{{- if .Gateways }}
+          <Routes>
+{{- range $i, $gateway := .Gateways }}
+            <Route wcm:action="add">
+              <Identifier>{{ $i }}</Identifier>
+              <Prefix>{{ defaultRoute $gateway }}</Prefix>
+              <NextHopAddress>{{ xml $gateway }}</NextHopAddress>
+            </Route>
+{{- end }}
+          </Routes>
+{{- end }}
+        </Interface>
+{{- end }}
+      </Interfaces>
+    </component>
+  </settings>
+  <settings pass="oobeSystem">
+    <component name="Microsoft-Windows-Shell-Setup" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+      <OOBE>
+        <HideEULAPage>true</HideEULAPage>
+        <HideOnlineAccountScreens>true</HideOnlineAccountScreens>
+        <HideWirelessSetupInOOBE>true</HideWirelessSetupInOOBE>
+        <ProtectYourPC>3</ProtectYourPC>
+      </OOBE>
+    </component>
+  </settings>
+</unattend>
+`))
+
+// Sysprep renders an unattend answer file for Windows. The computer name is
+// the hostname cut to the 15 characters Windows allows.
+func Sysprep(cfg Config) (string, error) {
+	computerName := cfg.Hostname
+	if len(computerName) > 15 {
+		computerName = computerName[:15]
+	}
+	var b bytes.Buffer
+	err := unattend.Execute(&b, struct {
+		Config
+		ComputerName string
+	}{cfg, computerName})
+	return b.String(), err
+}
+
+// MikrotikScript renders a RouterOS script run on first boot of a Mikrotik
+// CHR, which reads it as NoCloud user-data.
+func MikrotikScript(cfg Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/system identity set name=%s\n", routerOSString(cfg.Hostname))
+	if cfg.Username != "admin" {
+		fmt.Fprintf(&b, "/user add name=%s group=full\n", routerOSString(cfg.Username))
+	}
+	for _, key := range cfg.SSHAuthorizedKeys {
+		fmt.Fprintf(&b, "/user ssh-keys add user=%s key=%s\n", routerOSString(cfg.Username), routerOSString(key))
+	}
+	for _, iface := range cfg.Interfaces {
+		mac := strings.ToUpper(iface.Mac)
+		for _, address := range iface.Addresses {
+			fmt.Fprintf(&b, ":foreach i in=[/interface ethernet find where orig-mac-address=%s] do={ %s address add address=%s interface=$i }\n",
+				routerOSString(mac), routerOSMenu(address), routerOSString(address))
+		}
+		for _, gateway := range iface.Gateways {
+			fmt.Fprintf(&b, "%s route add dst-address=%s gateway=%s\n",
+				routerOSMenu(gateway), defaultRoute(gateway), routerOSString(gateway))
+		}
+	}
+	return b.String()
+}
+
+// routerOSMenu is the RouterOS menu of the family of an address.
+func routerOSMenu(address string) string {
+	if ipv6(address) {
+		return "/ipv6"
+	}
+	return "/ip"
+}
+
+// ipv6 reports whether an address, in CIDR notation or not, is an IPv6 one.
+func ipv6(address string) bool {
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		ip = net.ParseIP(address)
+	}
+	return ip != nil && ip.To4() == nil
+}
+
+// defaultRoute is the destination of the default route through the gateway.
+func defaultRoute(gateway string) string {
+	if ipv6(gateway) {
+		return "::/0"
+	}
+	return "0.0.0.0/0"
+}
+
+// routerOSString quotes s for a RouterOS script.
+func routerOSString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// InterfaceAddress is the address in CIDR notation with the prefix length of
+// the cidr of its pool.
+func InterfaceAddress(address, poolCIDR string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(poolCIDR)
+	if err != nil {
+		return "", err
+	}
+	ones, _ := ipNet.Mask.Size()
+	return fmt.Sprintf("%s/%d", address, ones), nil
+}
@@ -0,0 +1,298 @@
+package bootconfig
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestCloudInit(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             Config
+		wantUser        map[string]any
+		wantDisableRoot bool
+		wantEthernets   map[string]any
+	}{
+		{
+			name: "user with keys",
+			cfg: Config{
+				Hostname:          "web",
+				Username:          "ubuntu",
+				SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA user@host"},
+				Interfaces:        []Interface{{Mac: "02:AB:00:00:00:05", Addresses: []string{"10.0.0.5/24"}, Gateways: []string{"10.0.0.1"}}},
+			},
+			wantUser: map[string]any{
+				"name":                "ubuntu",
+				"lock_passwd":         false,
+				"groups":              []any{"sudo"},
+				"sudo":                "ALL=(ALL) NOPASSWD:ALL",
+				"shell":               "/bin/bash",
+				"ssh_authorized_keys": []any{"ssh-ed25519 AAAA user@host"},
+			},
+			wantDisableRoot: true,
+			wantEthernets: map[string]any{
+				"nic0": map[string]any{
+					"match":     map[string]any{"macaddress": "02:ab:00:00:00:05"},
+					"addresses": []any{"10.0.0.5/24"},
+					"routes":    []any{map[string]any{"to": "default", "via": "10.0.0.1"}},
+				},
+			},
+		},
+		{
+			name: "dual-stack",
+			cfg: Config{
+				Hostname: "app",
+				Username: "ubuntu",
+				Interfaces: []Interface{{Mac: "02:00:00:00:00:08", Addresses: []string{"10.0.0.8/24", "fd00::8/64"},
+					Gateways: []string{"10.0.0.1", "fd00::1"}}},
+			},
+			wantUser: map[string]any{
+				"name":        "ubuntu",
+				"lock_passwd": false,
+				"groups":      []any{"sudo"},
+				"sudo":        "ALL=(ALL) NOPASSWD:ALL",
+				"shell":       "/bin/bash",
+			},
+			wantDisableRoot: true,
+			wantEthernets: map[string]any{
+				"nic0": map[string]any{
+					"match":     map[string]any{"macaddress": "02:00:00:00:00:08"},
+					"addresses": []any{"10.0.0.8/24", "fd00::8/64"},
+					"routes": []any{
+						map[string]any{"to": "default", "via": "10.0.0.1"},
+						map[string]any{"to": "default", "via": "fd00::1"},
+					},
+				},
+			},
+		},
+		{
+			name: "root on an IPv6 network without a gateway",
+			cfg: Config{
+				Hostname:   "db",
+				Username:   "root",
+				Interfaces: []Interface{{Mac: "02:00:00:00:00:06", Addresses: []string{"fd00::6/64"}}},
+			},
+			wantUser: map[string]any{"name": "root", "lock_passwd": false},
+			wantEthernets: map[string]any{
+				"nic0": map[string]any{
+					"match":     map[string]any{"macaddress": "02:00:00:00:00:06"},
+					"addresses": []any{"fd00::6/64"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userData, networkData, err := CloudInit(tt.cfg)
+			if err != nil {
+				t.Fatalf("CloudInit: %v", err)
+			}
+			if !strings.HasPrefix(userData, "#cloud-config\n") {
+				t.Errorf("user-data does not start with #cloud-config: %q", userData)
+			}
+			var user struct {
+				Hostname    string           `json:"hostname"`
+				DisableRoot bool             `json:"disable_root"`
+				Users       []map[string]any `json:"users"`
+			}
+			if err := yaml.Unmarshal([]byte(userData), &user); err != nil {
+				t.Fatalf("user-data: %v", err)
+			}
+			if user.Hostname != tt.cfg.Hostname || user.DisableRoot != tt.wantDisableRoot {
+				t.Errorf("hostname %q, disable_root %t, want %q, %t", user.Hostname, user.DisableRoot, tt.cfg.Hostname, tt.wantDisableRoot)
+			}
+			if len(user.Users) != 1 || !reflect.DeepEqual(user.Users[0], tt.wantUser) {
+				t.Errorf("users = %v, want [%v]", user.Users, tt.wantUser)
+			}
+			var network struct {
+				Version   int            `json:"version"`
+				Ethernets map[string]any `json:"ethernets"`
+			}
+			if err := yaml.Unmarshal([]byte(networkData), &network); err != nil {
+				t.Fatalf("network-data: %v", err)
+			}
+			if network.Version != 2 || !reflect.DeepEqual(network.Ethernets, tt.wantEthernets) {
+				t.Errorf("network-data = %+v, want version 2 with %v", network, tt.wantEthernets)
+			}
+		})
+	}
+}
+
+func TestSysprep(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+		skip []string
+	}{
+		{
+			name: "IPv4",
+			cfg: Config{
+				Hostname:   "windows-server-2022",
+				Username:   "admin",
+				Interfaces: []Interface{{Mac: "02:ab:00:00:00:05", Addresses: []string{"10.0.0.5/24"}, Gateways: []string{"10.0.0.1"}}},
+			},
+			want: []string{
+				"<ComputerName>windows-server-</ComputerName>",
+				"<Identifier>02-AB-00-00-00-05</Identifier>",
+				"<Ipv4Settings>",
+				`<IpAddress wcm:action="add" wcm:keyValue="1">10.0.0.5/24</IpAddress>`,
+				"<Prefix>0.0.0.0/0</Prefix>",
+				"<NextHopAddress>10.0.0.1</NextHopAddress>",
+			},
+			skip: []string{"<Ipv6Settings>"},
+		},
+		{
+			name: "IPv6",
+			cfg: Config{
+				Hostname:   "win",
+				Username:   "admin",
+				Interfaces: []Interface{{Mac: "02:00:00:00:00:06", Addresses: []string{"fd00::6/64"}, Gateways: []string{"fd00::1"}}},
+			},
+			want: []string{"<Ipv6Settings>", "<Prefix>::/0</Prefix>", "<NextHopAddress>fd00::1</NextHopAddress>"},
+			skip: []string{"<Ipv4Settings>", "0.0.0.0/0"},
+		},
+		{
+			name: "dual-stack",
+			cfg: Config{
+				Hostname: "win",
+				Username: "admin",
+				Interfaces: []Interface{{Mac: "02:00:00:00:00:08", Addresses: []string{"10.0.0.8/24", "fd00::8/64"},
+					Gateways: []string{"10.0.0.1", "fd00::1"}}},
+			},
+			want: []string{
+				"<Ipv4Settings>",
+				"<Ipv6Settings>",
+				`<IpAddress wcm:action="add" wcm:keyValue="1">10.0.0.8/24</IpAddress>`,
+				`<IpAddress wcm:action="add" wcm:keyValue="2">fd00::8/64</IpAddress>`,
+				"<Identifier>0</Identifier>\n              <Prefix>0.0.0.0/0</Prefix>",
+				"<Identifier>1</Identifier>\n              <Prefix>::/0</Prefix>",
+			},
+		},
+		{
+			name: "no gateway",
+			cfg: Config{
+				Hostname:   "win",
+				Username:   "admin",
+				Interfaces: []Interface{{Mac: "02:00:00:00:00:07", Addresses: []string{"10.0.0.7/24"}}},
+			},
+			skip: []string{"<Routes>"},
+		},
+		{
+			name: "escaping",
+			cfg:  Config{Hostname: "a<b&c", Username: `o"brien&co`},
+			want: []string{
+				"<ComputerName>a&lt;b&amp;c</ComputerName>",
+				`net user "o&#34;brien&amp;co" /add`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unattend, err := Sysprep(tt.cfg)
+			if err != nil {
+				t.Fatalf("Sysprep: %v", err)
+			}
+			var doc struct{}
+			if err := xml.Unmarshal([]byte(unattend), &doc); err != nil {
+				t.Fatalf("the answer file is not well-formed: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(unattend, want) {
+					t.Errorf("answer file has no %s", want)
+				}
+			}
+			for _, skip := range tt.skip {
+				if strings.Contains(unattend, skip) {
+					t.Errorf("answer file has %s", skip)
+				}
+			}
+		})
+	}
+}
+
+func TestMikrotikScript(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{
+			name: "admin",
+			cfg: Config{
+				Hostname:   "router",
+				Username:   "admin",
+				Interfaces: []Interface{{Mac: "02:ab:00:00:00:05", Addresses: []string{"10.0.0.5/24"}, Gateways: []string{"10.0.0.1"}}},
+			},
+			want: `/system identity set name="router"
+:foreach i in=[/interface ethernet find where orig-mac-address="02:AB:00:00:00:05"] do={ /ip address add address="10.0.0.5/24" interface=$i }
+/ip route add dst-address=0.0.0.0/0 gateway="10.0.0.1"
+`,
+		},
+		{
+			name: "another user on IPv6",
+			cfg: Config{
+				Hostname:          "edge",
+				Username:          "ops",
+				SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA ops@host"},
+				Interfaces:        []Interface{{Mac: "02:00:00:00:00:06", Addresses: []string{"fd00::6/64"}, Gateways: []string{"fd00::1"}}},
+			},
+			want: `/system identity set name="edge"
+/user add name="ops" group=full
+/user ssh-keys add user="ops" key="ssh-ed25519 AAAA ops@host"
+:foreach i in=[/interface ethernet find where orig-mac-address="02:00:00:00:00:06"] do={ /ipv6 address add address="fd00::6/64" interface=$i }
+/ipv6 route add dst-address=::/0 gateway="fd00::1"
+`,
+		},
+		{
+			name: "dual-stack",
+			cfg: Config{
+				Hostname: "edge",
+				Username: "admin",
+				Interfaces: []Interface{{Mac: "02:00:00:00:00:08", Addresses: []string{"10.0.0.8/24", "fd00::8/64"},
+					Gateways: []string{"10.0.0.1", "fd00::1"}}},
+			},
+			want: `/system identity set name="edge"
+:foreach i in=[/interface ethernet find where orig-mac-address="02:00:00:00:00:08"] do={ /ip address add address="10.0.0.8/24" interface=$i }
+:foreach i in=[/interface ethernet find where orig-mac-address="02:00:00:00:00:08"] do={ /ipv6 address add address="fd00::8/64" interface=$i }
+/ip route add dst-address=0.0.0.0/0 gateway="10.0.0.1"
+/ipv6 route add dst-address=::/0 gateway="fd00::1"
+`,
+		},
+		{
+			name: "escaping",
+			cfg:  Config{Hostname: `r"1$x`, Username: "admin"},
+			want: `/system identity set name="r\"1\$x"
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MikrotikScript(tt.cfg); got != tt.want {
+				t.Errorf("MikrotikScript =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterOSString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"router", `"router"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\path`, `"C:\\path"`},
+		{"$name", `"\$name"`},
+		{"line\n/system reboot", `"line\n/system reboot"`},
+		{`\"`, `"\\\""`},
+	}
+	for _, tt := range tests {
+		if got := routerOSString(tt.in); got != tt.want {
+			t.Errorf("routerOSString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
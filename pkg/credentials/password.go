@@ -0,0 +1,74 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/hicompute/histack/api/v1alpha1"
+)
+
+const defaultPasswordLength = 16
+
+var characterClasses = map[v1alpha1.CharacterClass]string{
+	v1alpha1.CharacterClassLowercase: "abcdefghijkmnopqrstuvwxyz",
+	v1alpha1.CharacterClassUppercase: "ABCDEFGHJKLMNPQRSTUVWXYZ",
+	v1alpha1.CharacterClassDigits:    "23456789",
+	v1alpha1.CharacterClassSymbols:   "!#%+-.:=?@_~",
+}
+
+// GeneratePassword returns a random password shaped by the policy, with at
+// least one character of each of its classes. Look-alike characters are left out.
+func GeneratePassword(policy v1alpha1.PasswordPolicy) (string, error) {
+	length := int(policy.Length)
+	if length == 0 {
+		length = defaultPasswordLength
+	}
+	classes := policy.CharacterClasses
+	if len(classes) == 0 {
+		classes = []v1alpha1.CharacterClass{v1alpha1.CharacterClassLowercase, v1alpha1.CharacterClassUppercase, v1alpha1.CharacterClassDigits}
+	}
+	if length < len(classes) {
+		return "", fmt.Errorf("a password of %d characters cannot hold %d character classes", length, len(classes))
+	}
+
+	var alphabet string
+	password := make([]byte, 0, length)
+	for _, class := range classes {
+		chars, ok := characterClasses[class]
+		if !ok {
+			return "", fmt.Errorf("unknown character class %q", class)
+		}
+		alphabet += chars
+		c, err := pick(chars)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+	for len(password) < length {
+		c, err := pick(alphabet)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// the first characters are one of each class, shuffle them in.
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+func pick(chars string) (byte, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, err
+	}
+	return chars[i.Int64()], nil
+}
@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SecretStore keeps the credentials of a VM in the secret KubeVirt reads them
+// from, owned by the VM so it goes with it.
+type SecretStore struct {
+	Client client.Client
+	// Reader reads secrets past the cache, which does not hold them.
+	Reader client.Reader
+}
+
+var _ Store = &SecretStore{}
+
+func (s *SecretStore) Get(ctx context.Context, vm *kubevirtv1.VirtualMachine) (map[string]string, error) {
+	secret := &corev1.Secret{}
+	if err := s.Reader.Get(ctx, types.NamespacedName{Namespace: vm.Namespace, Name: SecretName(vm.Name)}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if owner := vmOwner(secret); owner != nil && owner.UID != vm.UID {
+		// left behind by a deleted VM with the same name, the garbage collector removes it.
+		return nil, nil
+	}
+	credentials := map[string]string{}
+	for username, password := range secret.Data {
+		credentials[username] = string(password)
+	}
+	return credentials, nil
+}
+
+func (s *SecretStore) Put(ctx context.Context, vm *kubevirtv1.VirtualMachine, credentials map[string]string) error {
+	return ProjectSecret(ctx, s.Client, s.Reader, vm, credentials)
+}
+
+func (s *SecretStore) Delete(ctx context.Context, namespace, name string, uid types.UID) error {
+	return DeleteSecret(ctx, s.Client, s.Reader, namespace, name, uid)
+}
+
+// ManagedByLabel marks the secrets written for VMs with ManagedBy. An existing
+// secret is only adopted or deleted when it carries it.
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedBy      = "histack"
+)
+
+// ProjectSecret writes credentials into the secret KubeVirt reads them from,
+// owned by the VM. A secret of another VM with the same name is replaced.
+func ProjectSecret(ctx context.Context, c client.Client, reader client.Reader, vm *kubevirtv1.VirtualMachine, credentials map[string]string) error {
+	data := map[string][]byte{}
+	for username, password := range credentials {
+		data[username] = []byte(password)
+	}
+	return WriteVMSecret(ctx, c, reader, vm, SecretName(vm.Name), data)
+}
+
+// WriteVMSecret creates or replaces the data of the secret with the name,
+// owned by the VM so it goes with it. An existing secret is only taken over
+// when it is managed: one a VM owns, or one no controller owns, must carry
+// ManagedByLabel. Any other secret with the name fails the write.
+func WriteVMSecret(ctx context.Context, c client.Client, reader client.Reader, vm *kubevirtv1.VirtualMachine, name string, data map[string][]byte) error {
+	ownerReferences := []metav1.OwnerReference{*metav1.NewControllerRef(vm, kubevirtv1.VirtualMachineGroupVersionKind)}
+
+	secret := &corev1.Secret{}
+	err := reader.Get(ctx, types.NamespacedName{Namespace: vm.Namespace, Name: name}, secret)
+	if errors.IsNotFound(err) {
+		secret.Name = name
+		secret.Namespace = vm.Namespace
+		secret.Labels = map[string]string{ManagedByLabel: ManagedBy}
+		secret.OwnerReferences = ownerReferences
+		secret.Data = data
+		return c.Create(ctx, secret)
+	}
+	if err != nil {
+		return err
+	}
+	if owner := vmOwner(secret); owner == nil || owner.UID != vm.UID {
+		if !managed(secret) {
+			return fmt.Errorf("secret %s/%s is not managed by %s, remove it or label it %s=%s",
+				secret.Namespace, secret.Name, ManagedBy, ManagedByLabel, ManagedBy)
+		}
+	}
+	if equality.Semantic.DeepEqual(secret.OwnerReferences, ownerReferences) && equality.Semantic.DeepEqual(secret.Data, data) &&
+		secret.Labels[ManagedByLabel] == ManagedBy {
+		return nil
+	}
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[ManagedByLabel] = ManagedBy
+	secret.OwnerReferences = ownerReferences
+	secret.Data = data
+	return c.Update(ctx, secret)
+}
+
+// DeleteSecret deletes the credentials secret of the VM with the uid, and a
+// managed one no controller owns. With an empty uid, the secret of a VM is left
+// to the garbage collector. Secrets of other owners are left alone.
+func DeleteSecret(ctx context.Context, c client.Client, reader client.Reader, namespace, name string, uid types.UID) error {
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: SecretName(name)}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if owner := vmOwner(secret); owner != nil {
+		if uid == "" || owner.UID != uid {
+			return nil
+		}
+	} else if !managed(secret) {
+		return nil
+	}
+	return client.IgnoreNotFound(c.Delete(ctx, secret, client.Preconditions{UID: &secret.UID, ResourceVersion: &secret.ResourceVersion}))
+}
+
+// managed reports whether the secret carries ManagedByLabel and no controller
+// other than a VM owns it.
+func managed(secret *corev1.Secret) bool {
+	if owner := metav1.GetControllerOf(secret); owner != nil && vmOwner(secret) == nil {
+		return false
+	}
+	return secret.Labels[ManagedByLabel] == ManagedBy
+}
+
+// vmOwner is the VirtualMachine controlling the secret, if any.
+func vmOwner(secret *corev1.Secret) *metav1.OwnerReference {
+	owner := metav1.GetControllerOf(secret)
+	if owner == nil || owner.Kind != kubevirtv1.VirtualMachineGroupVersionKind.Kind {
+		return nil
+	}
+	return owner
+}
@@ -0,0 +1,25 @@
+package credentials
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// Store keeps the credentials of VirtualMachines, usernames to passwords.
+type Store interface {
+	// Get returns the credentials of the VM, nil when it has none.
+	Get(ctx context.Context, vm *kubevirtv1.VirtualMachine) (map[string]string, error)
+	// Put stores the credentials of the VM, replacing any it had.
+	Put(ctx context.Context, vm *kubevirtv1.VirtualMachine, credentials map[string]string) error
+	// Delete forgets the credentials of the VM with the uid. An empty uid
+	// forgets those of any VM with the name the Store can tell apart from
+	// its successors.
+	Delete(ctx context.Context, namespace, name string, uid types.UID) error
+}
+
+// SecretName is the name of the secret KubeVirt reads the credentials of a VM from.
+func SecretName(vmName string) string {
+	return vmName + "-credentials"
+}
@@ -0,0 +1,130 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// VaultStore keeps the credentials of VMs in a HashiCorp Vault KV version 2
+// secrets engine, at <prefix>/<namespace>/<name>/<uid>, so a VM recreated
+// with the same name gets credentials of its own.
+type VaultStore struct {
+	// Address of Vault, e.g. http://127.0.0.1:8200.
+	Address string
+	// Token authenticates to Vault.
+	Token string
+	// Mount is the path the KV engine is mounted at, e.g. secret.
+	Mount string
+	// Prefix of the paths of the credentials in the engine.
+	Prefix string
+	// HTTPClient talks to Vault, http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+var _ Store = &VaultStore{}
+
+func (s *VaultStore) Get(ctx context.Context, vm *kubevirtv1.VirtualMachine) (map[string]string, error) {
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	found, err := s.do(ctx, http.MethodGet, "data", s.path(vm.Namespace, vm.Name, vm.UID), nil, &body)
+	if err != nil || !found {
+		return nil, err
+	}
+	return body.Data.Data, nil
+}
+
+func (s *VaultStore) Put(ctx context.Context, vm *kubevirtv1.VirtualMachine, credentials map[string]string) error {
+	_, err := s.do(ctx, http.MethodPost, "data", s.path(vm.Namespace, vm.Name, vm.UID), map[string]any{"data": credentials}, nil)
+	return err
+}
+
+func (s *VaultStore) Delete(ctx context.Context, namespace, name string, uid types.UID) error {
+	uids := []string{string(uid)}
+	if uid == "" {
+		var body struct {
+			Data struct {
+				Keys []string `json:"keys"`
+			} `json:"data"`
+		}
+		found, err := s.do(ctx, "LIST", "metadata", s.path(namespace, name, ""), nil, &body)
+		if err != nil || !found {
+			return err
+		}
+		uids = body.Data.Keys
+	}
+	for _, uid := range uids {
+		// the metadata goes with all versions of the credentials.
+		if _, err := s.do(ctx, http.MethodDelete, "metadata", s.path(namespace, name, types.UID(uid)), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *VaultStore) path(namespace, name string, uid types.UID) string {
+	return path.Join(s.Prefix, namespace, name, string(uid))
+}
+
+// do calls the KV API on the path of the credentials, decoding the response
+// into out. It reports false when Vault has nothing there.
+func (s *VaultStore) do(ctx context.Context, method, api, credentialsPath string, in, out any) (bool, error) {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return false, err
+		}
+		body = bytes.NewReader(raw)
+	}
+	endpoint, err := url.JoinPath(strings.TrimSuffix(s.Address, "/"), "v1", s.Mount, api, credentialsPath)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 300:
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&vaultErr)
+		return false, fmt.Errorf("vault %s %s: %s: %s", method, credentialsPath, resp.Status, strings.Join(vaultErr.Errors, "; "))
+	case out != nil && resp.StatusCode != http.StatusNoContent:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return false, fmt.Errorf("vault %s %s: %w", method, credentialsPath, err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// TestVaultStore runs against a dev-mode server, e.g.
+//
+//	vault server -dev -dev-root-token-id=root
+//	VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN=root go test ./pkg/credentials/
+func TestVaultStore(t *testing.T) {
+	address, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if address == "" || token == "" {
+		t.Skip("VAULT_ADDR and VAULT_TOKEN are not set")
+	}
+	ctx := context.Background()
+	store := &VaultStore{Address: address, Token: token, Mount: "secret", Prefix: "histack-test"}
+	vm := &kubevirtv1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vault-vm", UID: "vm-uid"}}
+	recreated := vm.DeepCopy()
+	recreated.UID = "new-vm-uid"
+
+	if err := store.Put(ctx, vm, map[string]string{"root": "first"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put(ctx, recreated, map[string]string{"root": "second"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := store.Get(ctx, vm)
+	if err != nil || got["root"] != "first" {
+		t.Fatalf("Get = %v, %v, want the credentials of the VM", got, err)
+	}
+
+	if err := store.Delete(ctx, vm.Namespace, vm.Name, vm.UID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, err := store.Get(ctx, vm); err != nil || got != nil {
+		t.Fatalf("Get after Delete = %v, %v, want nothing", got, err)
+	}
+	if got, err := store.Get(ctx, recreated); err != nil || got["root"] != "second" {
+		t.Fatalf("Get = %v, %v, want the credentials of the recreated VM", got, err)
+	}
+
+	if err := store.Delete(ctx, vm.Namespace, vm.Name, types.UID("")); err != nil {
+		t.Fatalf("Delete by name: %v", err)
+	}
+	if got, err := store.Get(ctx, recreated); err != nil || got != nil {
+		t.Fatalf("Get after Delete by name = %v, %v, want nothing", got, err)
+	}
+}
@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	helper "github.com/hicompute/histack/pkg/helpers"
+	netUtils "github.com/hicompute/histack/pkg/net_utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// watchHotplug periodically plugs the interfaces hotplugged into the running
+// VMIs of the node. Without a dynamic networks controller they get no CNI ADD.
+func (s *CNIServer) watchHotplug(nodeName string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.plugHotplugged(context.Background(), nodeName); err != nil {
+			klog.Errorf("Error on plugging hotplugged interfaces: %v", err)
+		}
+	}
+}
+
+// plugHotplugged runs add for every secondary interface declared in a running
+// VMI of the node that its launcher pod has no OVS port for.
+func (s *CNIServer) plugHotplugged(ctx context.Context, nodeName string) error {
+	var vmis kubevirtv1.VirtualMachineInstanceList
+	if err := s.k8sClient.List(ctx, &vmis, client.MatchingLabels{kubevirtv1.NodeNameLabel: nodeName}); err != nil {
+		return err
+	}
+	for i := range vmis.Items {
+		vmi := &vmis.Items[i]
+		if vmi.Status.Phase != kubevirtv1.Running {
+			continue
+		}
+		pod, err := s.launcherPod(ctx, vmi, nodeName)
+		if err != nil {
+			return err
+		}
+		if pod == nil {
+			continue
+		}
+		for _, podIface := range helper.DeclaredPodInterfaces(&vmi.Spec) {
+			if !podIface.Secondary() {
+				continue
+			}
+			plugged, err := s.hasPort(pod, podIface.Names())
+			if err != nil {
+				return err
+			}
+			if plugged {
+				continue
+			}
+			netns, err := netUtils.PodNetNSPath(string(pod.UID))
+			if err != nil {
+				klog.Errorf("Error on finding the network namespace of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+				break
+			}
+			if _, err := s.add(pod.Namespace, pod.Name, networkName(vmi.Namespace, podIface.Network), podIface.Name, netns); err != nil {
+				klog.Errorf("Error on plugging interface %s of VMI %s/%s: %v", podIface.Name, vmi.Namespace, vmi.Name, err)
+				continue
+			}
+			klog.Infof("Plugged hotplugged interface %s of VMI %s/%s", podIface.Name, vmi.Namespace, vmi.Name)
+		}
+	}
+	return nil
+}
+
+// hasPort reports whether OVS has a port for the pod interface under any of
+// its names, including those of ports named after the pod.
+func (s *CNIServer) hasPort(pod *corev1.Pod, names []string) (bool, error) {
+	for _, name := range names {
+		for _, ifaceId := range []string{
+			helper.LogicalPortName(pod.Namespace, pod.Name, name),
+			pod.Namespace + "_" + pod.Name + "_" + name,
+		} {
+			ok, err := s.ovsAgent.HasPort(ifaceId)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// launcherPod returns the running virt-launcher pod of a VMI on the node, nil if there is none.
+func (s *CNIServer) launcherPod(ctx context.Context, vmi *kubevirtv1.VirtualMachineInstance, nodeName string) (*corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := s.k8sClient.List(ctx, &pods, client.InNamespace(vmi.Namespace),
+		client.MatchingLabels{kubevirtv1.CreatedByLabel: string(vmi.UID)}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == nodeName && pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp.IsZero() {
+			return pod, nil
+		}
+	}
+	return nil, nil
+}
+
+// networkName is the name multus gives the network of a VMI.
+func networkName(namespace string, network kubevirtv1.Network) string {
+	if network.Multus == nil {
+		return network.Name
+	}
+	if strings.Contains(network.Multus.NetworkName, "/") {
+		return network.Multus.NetworkName
+	}
+	return namespace + "/" + network.Multus.NetworkName
+}
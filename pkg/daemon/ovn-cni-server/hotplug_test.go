@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/hicompute/histack/api/v1alpha1"
+	helper "github.com/hicompute/histack/pkg/helpers"
+	histack_ipam "github.com/hicompute/histack/pkg/ipam"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAllocateHotplugged(t *testing.T) {
+	vmi := &kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "vm1",
+			UID:       "vmi-uid",
+			Annotations: map[string]string{
+				v1alpha1.NetworkPoolsAnnotation: `{"public":{"poolSelector":{"matchLabels":{"network":"public"}}}}`,
+			},
+		},
+		Spec: kubevirtv1.VirtualMachineInstanceSpec{
+			Domain: kubevirtv1.DomainSpec{Devices: kubevirtv1.Devices{Interfaces: []kubevirtv1.Interface{
+				{Name: "default"},
+				{Name: "public"},
+			}}},
+			Networks: []kubevirtv1.Network{
+				{Name: "default", NetworkSource: kubevirtv1.NetworkSource{Pod: &kubevirtv1.PodNetwork{}}},
+				{Name: "public", NetworkSource: kubevirtv1.NetworkSource{Multus: &kubevirtv1.MultusNetwork{NetworkName: "public"}}},
+			},
+		},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "virt-launcher-vm1-abcde",
+		Labels:    map[string]string{"vm.kubevirt.io/name": "vm1", kubevirtv1.CreatedByLabel: "vmi-uid"},
+	}}
+	s := &CNIServer{ipam: *histack_ipam.NewWithClient(newFakeClient(t,
+		vmi, pod,
+		newPool("default-v4", "v4", "10.60.0.0/24", nil),
+		newPool("public-v4", "v4", "10.61.0.0/24", map[string]string{"network": "public"}),
+		newPool("public-v6", "v6", "fd00:61::/64", map[string]string{"network": "public"}),
+	))}
+
+	eth0, _, err := s.allocate(pod.Namespace, pod.Name, "eth0")
+	if err != nil {
+		t.Fatalf("allocate eth0: %v", err)
+	}
+	if len(eth0) != 1 || eth0[0].Spec.ClusterIPPool != "default-v4" {
+		t.Fatalf("eth0 got %d ClusterIPs, want one of default-v4", len(eth0))
+	}
+
+	// the network a hotplugged interface is plugged into is dual-stack.
+	iface := helper.HashedPodInterfaceName("public")
+	clusterIPs, pools, err := s.allocate(pod.Namespace, pod.Name, iface)
+	if err != nil {
+		t.Fatalf("allocate %s: %v", iface, err)
+	}
+	if len(clusterIPs) != 2 || pools[0].Name != "public-v4" || pools[1].Name != "public-v6" {
+		t.Fatalf("%s got %d ClusterIPs, want one of public-v4 and one of public-v6", iface, len(clusterIPs))
+	}
+	if clusterIPs[0].Spec.Family != "v4" || clusterIPs[1].Spec.Family != "v6" || clusterIPs[0].Name == clusterIPs[1].Name {
+		t.Errorf("ClusterIPs %s (%s) and %s (%s), want a v4 and a v6 one", clusterIPs[0].Name, clusterIPs[0].Spec.Family,
+			clusterIPs[1].Name, clusterIPs[1].Spec.Family)
+	}
+	if clusterIPs[0].Spec.Mac != clusterIPs[1].Spec.Mac {
+		t.Errorf("MACs %s and %s, want the interface to have one", clusterIPs[0].Spec.Mac, clusterIPs[1].Spec.Mac)
+	}
+	if clusterIPs[0].Spec.Mac == eth0[0].Spec.Mac {
+		t.Errorf("MAC %s is the MAC of eth0, want one seeded from the interface", clusterIPs[0].Spec.Mac)
+	}
+
+	// a second plug attempt finds the same addresses.
+	again, _, err := s.allocate(pod.Namespace, pod.Name, iface)
+	if err != nil {
+		t.Fatalf("allocate %s again: %v", iface, err)
+	}
+	for i := range again {
+		if again[i].Name != clusterIPs[i].Name {
+			t.Errorf("allocate again got %s, want %s", again[i].Name, clusterIPs[i].Name)
+		}
+	}
+}
+
+func newPool(name, family, cidr string, labels map[string]string) *v1alpha1.ClusterIPPool {
+	return &v1alpha1.ClusterIPPool{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       v1alpha1.ClusterIPPoolSpec{IPFamily: family, CIDR: cidr},
+		Status:     v1alpha1.ClusterIPPoolStatus{TotalIPs: "254", FreeIPs: "254", AllocatedIPs: "0", NextIndex: "0"},
+	}
+}
+
+// newFakeClient returns a client preloaded with the objects and the field
+// selectors the IPAM lists with.
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, v1alpha1.AddToScheme, kubevirtv1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clusterIPField := func(value func(*v1alpha1.ClusterIP) string) client.IndexerFunc {
+		return func(obj client.Object) []string { return []string{value(obj.(*v1alpha1.ClusterIP))} }
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithStatusSubresource(&v1alpha1.ClusterIP{}, &v1alpha1.ClusterIPPool{}, &v1alpha1.IPClaim{}).
+		WithIndex(&v1alpha1.ClusterIP{}, "spec.resource", clusterIPField(func(c *v1alpha1.ClusterIP) string { return c.Spec.Resource })).
+		WithIndex(&v1alpha1.ClusterIP{}, "spec.family", clusterIPField(func(c *v1alpha1.ClusterIP) string { return c.Spec.Family })).
+		WithIndex(&v1alpha1.ClusterIP{}, "spec.containerInterface", clusterIPField(func(c *v1alpha1.ClusterIP) string { return c.Spec.Interface })).
+		WithIndex(&v1alpha1.ClusterIP{}, "spec.mac", clusterIPField(func(c *v1alpha1.ClusterIP) string { return c.Spec.Mac })).
+		WithIndex(&v1alpha1.ClusterIPPool{}, "spec.ipFamily", func(obj client.Object) []string {
+			return []string{obj.(*v1alpha1.ClusterIPPool).Spec.IPFamily}
+		}).
+		Build()
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -12,24 +14,35 @@ import (
 	types100 "github.com/containernetworking/cni/pkg/types/100"
 
 	"github.com/containernetworking/cni/pkg/version"
+	"github.com/hicompute/histack/api/v1alpha1"
 	cniTypes "github.com/hicompute/histack/pkg/daemon/ovn-cni-server/types"
 	helper "github.com/hicompute/histack/pkg/helpers"
 	histack_ipam "github.com/hicompute/histack/pkg/ipam"
+	"github.com/hicompute/histack/pkg/k8s"
 	netUtils "github.com/hicompute/histack/pkg/net_utils"
 	"github.com/hicompute/histack/pkg/ovn"
 	"github.com/hicompute/histack/pkg/ovs"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// logicalSwitch is the OVN logical switch pod interfaces are attached to.
+const logicalSwitch = "public"
+
 type CNIServer struct {
 	socketPath string
 	listener   net.Listener
 	ovsAgent   ovs.OvsAgent
 	ovnAgent   ovn.OVNagent
 	ipam       histack_ipam.IPAM
+	k8sClient  client.Client
+	// chassis is the OVN chassis of the node, the system-id of its Open vSwitch.
+	chassis string
 }
 
-func Start(socketPath string) error {
+// Start serves CNI requests on the socket. With a node name, the interfaces
+// hotplugged into the running VMIs of the node are plugged as well.
+func Start(socketPath, nodeName string) error {
 	// Cleanup existing socket
 	os.RemoveAll(socketPath)
 
@@ -48,16 +61,29 @@ func Start(socketPath string) error {
 		return fmt.Errorf("failed to create ovs agent: %v", err)
 	}
 
-	ipam := histack_ipam.New()
+	k8sClient, err := k8s.NewClient()
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %v", err)
+	}
+
+	chassis, err := ovsAgent.SystemID()
+	if err != nil {
+		return fmt.Errorf("failed to get the OVN chassis: %v", err)
+	}
 
 	cniServer := &CNIServer{
 		socketPath: socketPath,
 		listener:   listener,
 		ovsAgent:   *ovsAgent,
 		ovnAgent:   *ovnAgent,
-		ipam:       *ipam,
+		ipam:       *histack_ipam.NewWithClient(k8sClient),
+		k8sClient:  k8sClient,
+		chassis:    chassis,
 	}
 
+	if nodeName != "" {
+		go cniServer.watchHotplug(nodeName, 10*time.Second)
+	}
 	cniServer.run()
 	return nil
 }
@@ -88,8 +114,8 @@ func (s *CNIServer) handleConnection(conn net.Conn) {
 		response = s.handleAdd(request.CmdArgs)
 	case "Del":
 		response = s.handleDel(request.CmdArgs)
-	// case "CHECK":
-	// 	response = s.handleCheck(request)
+	case "Check":
+		response = s.handleCheck(request.CmdArgs)
 	default:
 		response = cniTypes.CNIResponse{Error: "Unknown command"}
 	}
@@ -106,70 +132,147 @@ func (s *CNIServer) handleAdd(req skel.CmdArgs) cniTypes.CNIResponse {
 			Error: err.Error(),
 		}
 	}
-	K8S_POD_NAMESPACE := string(k8sArgs.K8S_POD_NAMESPACE)
-	K8S_POD_NAME := string(k8sArgs.K8S_POD_NAME)
-	clusterIP, clusterIPPool, err := s.ipam.FindOrCreateClusterIP(histack_ipam.IPAMRequest{
-		Interface: req.IfName,
-		Namespace: K8S_POD_NAMESPACE,
-		Name:      K8S_POD_NAME,
-		Family:    "v4",
-	})
-
-	if err != nil {
+	netConf := types.NetConf{}
+	if err := json.Unmarshal(req.StdinData, &netConf); err != nil {
+		klog.Infof("error loading network configuration: %v", err)
 		return cniTypes.CNIResponse{
 			Error: err.Error(),
 		}
 	}
-	_, ipNet, err := net.ParseCIDR(clusterIPPool.Spec.CIDR)
-	ipAddress := net.IPNet{IP: net.ParseIP(clusterIP.Spec.Address), Mask: net.IPMask(ipNet.Mask)}
-	gateway := net.ParseIP(clusterIPPool.Spec.Gateway)
-	hostIface, contIface, err := netUtils.SetupVeth(req.Netns, req.IfName, clusterIP.Spec.Mac, 1500, &ipAddress, &gateway)
+	result, err := s.add(string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME), netConf.Name, req.IfName, req.Netns)
 	if err != nil {
-		klog.Errorf("%v", err)
 		return cniTypes.CNIResponse{
 			Error: err.Error(),
 		}
 	}
+	return cniTypes.CNIResponse{
+		Result: *result,
+		Error:  "",
+	}
+}
+
+// add binds a ClusterIP of each family to the pod interface, plugs it into the
+// pod network namespace with all of its addresses, attaches it to OVS and OVN
+// and publishes it on the pod.
+func (s *CNIServer) add(namespace, podName, networkName, ifName, netns string) (*current.Result, error) {
+	clusterIPs, clusterIPPools, err := s.allocate(namespace, podName, ifName)
+	if err != nil {
+		return nil, err
+	}
+	ipAddresses, gateways, err := interfaceAddresses(ifName, clusterIPs, clusterIPPools)
+	if err != nil {
+		return nil, err
+	}
+	hostIface, contIface, err := netUtils.SetupVeth(netns, ifName, clusterIPs[0].Spec.Mac, 1500, ipAddresses, gateways)
+	if err != nil {
+		klog.Errorf("%v", err)
+		return nil, err
+	}
 	klog.Info(hostIface.Mac, ",", contIface.Mac)
 
-	ifaceId := K8S_POD_NAMESPACE + "_" + K8S_POD_NAME + "_" + req.IfName
+	// the port of a VM interface is shared by the launcher pods of a live migration.
+	ifaceId := helper.LogicalPortName(namespace, podName, ifName)
+	vmName := helper.ExtractVMName(podName)
 
-	if err = s.ovsAgent.AddPort("br-int", hostIface.Name, "system", ifaceId); err != nil {
-		return cniTypes.CNIResponse{
-			Error: err.Error(),
-		}
+	if err = s.ovsAgent.AddPort("br-int", hostIface.Name, "system", ifaceId, map[string]string{"vm": vmName, "pod": podName}); err != nil {
+		return nil, err
 	}
 
-	vmName := helper.ExtractVMName(K8S_POD_NAME)
-
-	if err := s.ovnAgent.CreateLogicalPort("public", ifaceId, contIface.Mac, map[string]string{
-		"namespace": K8S_POD_NAMESPACE,
-		"pod":       K8S_POD_NAME,
+	if err := s.ovnAgent.BindLogicalPort(logicalSwitch, ifaceId, contIface.Mac, s.chassis, podName, map[string]string{
+		"namespace": namespace,
 		"vmName":    vmName,
 	}); err != nil {
 		_ = s.ovsAgent.DelPort("br-int", ifaceId)
-		return cniTypes.CNIResponse{
-			Error: err.Error(),
+		return nil, err
+	}
+	var addresses, gatewayAddresses []string
+	for i := range clusterIPs {
+		addresses = append(addresses, clusterIPs[i].Spec.Address)
+		if clusterIPPools[i].Spec.Gateway != "" {
+			gatewayAddresses = append(gatewayAddresses, clusterIPPools[i].Spec.Gateway)
+		}
+	}
+	if err := s.publishNetworkStatus(namespace, podName, ifName, &helper.NetworkStatus{
+		Name:          networkName,
+		Interface:     ifName,
+		IPs:           addresses,
+		Mac:           clusterIPs[0].Spec.Mac,
+		Default:       ifName == "eth0",
+		Gateway:       gatewayAddresses,
+		ClusterIPPool: clusterIPPools[0].Name,
+		LogicalSwitch: logicalSwitch,
+	}); err != nil {
+		// the interface works without it.
+		klog.Errorf("Error on publishing the network status of pod %s/%s: %v", namespace, podName, err)
+	}
+	return addResult(ifName, contIface, ipAddresses, gateways), nil
+}
+
+// interfaceAddresses returns the addresses of the ClusterIPs of a pod
+// interface and the gateways of their pools. Only eth0 routes through a
+// gateway, the default routes of the pod stay on its default network.
+func interfaceAddresses(ifName string, clusterIPs []*v1alpha1.ClusterIP, clusterIPPools []*v1alpha1.ClusterIPPool) ([]net.IPNet, []net.IP, error) {
+	ipAddresses := make([]net.IPNet, len(clusterIPs))
+	gateways := make([]net.IP, len(clusterIPs))
+	for i := range clusterIPs {
+		_, ipNet, err := net.ParseCIDR(clusterIPPools[i].Spec.CIDR)
+		if err != nil {
+			return nil, nil, err
+		}
+		ipAddresses[i] = net.IPNet{IP: net.ParseIP(clusterIPs[i].Spec.Address), Mask: ipNet.Mask}
+		if ifName == "eth0" {
+			gateways[i] = net.ParseIP(clusterIPPools[i].Spec.Gateway)
 		}
 	}
+	return ipAddresses, gateways, nil
+}
+
+// addResult is the result of add for the container interface with the addresses.
+func addResult(ifName string, contIface *current.Interface, ipAddresses []net.IPNet, gateways []net.IP) *current.Result {
 	result := current.Result{
 		CNIVersion: version.Current(),
 		Interfaces: []*current.Interface{contIface},
 	}
 
-	if req.IfName == "eth0" {
-		result.IPs = []*current.IPConfig{
-			{
+	if ifName == "eth0" {
+		for i := range ipAddresses {
+			result.IPs = append(result.IPs, &current.IPConfig{
 				Interface: types100.Int(0),
-				Address:   ipAddress,
-				Gateway:   gateway,
-			},
+				Address:   ipAddresses[i],
+				Gateway:   gateways[i],
+			})
 		}
 	}
-	return cniTypes.CNIResponse{
-		Result: result,
-		Error:  "",
+	return &result
+}
+
+// allocate binds a ClusterIP of each family of the pools of the pod interface
+// to it, v4 first. The ClusterIPs of an interface share its MAC.
+func (s *CNIServer) allocate(namespace, podName, ifName string) ([]*v1alpha1.ClusterIP, []*v1alpha1.ClusterIPPool, error) {
+	request := histack_ipam.IPAMRequest{
+		Interface: ifName,
+		Namespace: namespace,
+		Name:      podName,
 	}
+	families, err := s.ipam.InterfaceFamilies(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	var clusterIPs []*v1alpha1.ClusterIP
+	var clusterIPPools []*v1alpha1.ClusterIPPool
+	for _, family := range families {
+		request.Family = family
+		if len(clusterIPs) > 0 {
+			request.Mac = &clusterIPs[0].Spec.Mac
+		}
+		clusterIP, clusterIPPool, err := s.ipam.FindOrCreateClusterIP(request)
+		if err != nil {
+			return nil, nil, err
+		}
+		clusterIPs = append(clusterIPs, clusterIP)
+		clusterIPPools = append(clusterIPPools, clusterIPPool)
+	}
+	return clusterIPs, clusterIPPools, nil
 }
 
 func (s *CNIServer) handleDel(req skel.CmdArgs) cniTypes.CNIResponse {
@@ -182,19 +285,163 @@ func (s *CNIServer) handleDel(req skel.CmdArgs) cniTypes.CNIResponse {
 	}
 	K8S_POD_NAMESPACE := string(k8sArgs.K8S_POD_NAMESPACE)
 	K8S_POD_NAME := string(k8sArgs.K8S_POD_NAME)
-	ifaceId := K8S_POD_NAMESPACE + "_" + K8S_POD_NAME + "_" + req.IfName
+	ifaceId := helper.LogicalPortName(K8S_POD_NAMESPACE, K8S_POD_NAME, req.IfName)
 
-	if err := s.ovnAgent.DeleteLogicalPort("public", ifaceId); err != nil {
+	// the port stays while the other launcher pod of a live migration uses it.
+	found, unbound, err := s.ovnAgent.UnbindLogicalPort(logicalSwitch, ifaceId, s.chassis, K8S_POD_NAME)
+	if err != nil {
 		klog.Errorf("%v", err)
 		return cniTypes.CNIResponse{
 			Error: err.Error(),
 		}
 	}
+	if found && !unbound {
+		// another pod of the VM on the node shares the iface-id, only the
+		// OVS port of this pod goes.
+		if err := s.ovsAgent.DelPodPort("br-int", ifaceId, K8S_POD_NAME); err != nil {
+			klog.Errorf("%v", err)
+			return cniTypes.CNIResponse{
+				Error: err.Error(),
+			}
+		}
+		return cniTypes.CNIResponse{}
+	}
+	if podIfaceId := K8S_POD_NAMESPACE + "_" + K8S_POD_NAME + "_" + req.IfName; !found && podIfaceId != ifaceId {
+		// plugged before VM ports were named after their VM.
+		ifaceId = podIfaceId
+		if err := s.ovnAgent.DeleteLogicalPort(logicalSwitch, ifaceId); err != nil {
+			klog.Errorf("%v", err)
+			return cniTypes.CNIResponse{
+				Error: err.Error(),
+			}
+		}
+	}
 	if err := s.ovsAgent.DelPort("br-int", ifaceId); err != nil {
 		klog.Errorf("%v", err)
 		return cniTypes.CNIResponse{
 			Error: err.Error(),
 		}
 	}
+	if err := s.publishNetworkStatus(K8S_POD_NAMESPACE, K8S_POD_NAME, req.IfName, nil); err != nil {
+		klog.Errorf("Error on removing the network status of pod %s/%s: %v", K8S_POD_NAMESPACE, K8S_POD_NAME, err)
+	}
 	return cniTypes.CNIResponse{}
 }
+
+func (s *CNIServer) handleCheck(req skel.CmdArgs) cniTypes.CNIResponse {
+	k8sArgs := cniTypes.CniKubeArgs{}
+	if err := types.LoadArgs(req.Args, &k8sArgs); err != nil {
+		klog.Infof("error loading args: %v", err)
+		return cniTypes.CNIResponse{
+			Error: err.Error(),
+		}
+	}
+	netConf := types.NetConf{}
+	if err := json.Unmarshal(req.StdinData, &netConf); err != nil {
+		klog.Infof("error loading network configuration: %v", err)
+		return cniTypes.CNIResponse{
+			Error: err.Error(),
+		}
+	}
+	if err := s.check(string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME), req.IfName, req.Netns, &netConf); err != nil {
+		klog.Errorf("Check of %s of pod %s/%s failed: %v", req.IfName, k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, err)
+		return cniTypes.CNIResponse{
+			Error: err.Error(),
+		}
+	}
+	return cniTypes.CNIResponse{}
+}
+
+// check verifies that the pod interface is still plugged the way add left it:
+// its ClusterIPs are bound to the pod, the veth in the pod network namespace
+// has their MAC, the host side is attached to OVS with the iface-id of its
+// logical port and the logical port is on the switch with the MAC.
+func (s *CNIServer) check(namespace, podName, ifName, netns string, netConf *types.NetConf) error {
+	clusterIPs, err := s.boundClusterIPs(namespace, podName, ifName)
+	if err != nil {
+		return err
+	}
+	addresses := make([]string, len(clusterIPs))
+	for i := range clusterIPs {
+		addresses[i] = clusterIPs[i].Spec.Address
+	}
+	if err := checkPrevResult(netConf, ifName, addresses); err != nil {
+		return err
+	}
+	mac := clusterIPs[0].Spec.Mac
+	hostIfName, err := netUtils.CheckVeth(netns, ifName, mac)
+	if err != nil {
+		return err
+	}
+
+	ifaceId := helper.LogicalPortName(namespace, podName, ifName)
+	if podIfaceId := namespace + "_" + podName + "_" + ifName; podIfaceId != ifaceId {
+		if found, err := s.ovsAgent.HasPort(ifaceId); err != nil {
+			return err
+		} else if !found {
+			// plugged before VM ports were named after their VM.
+			ifaceId = podIfaceId
+		}
+	}
+	if err := s.ovsAgent.CheckPort("br-int", hostIfName, ifaceId); err != nil {
+		return err
+	}
+	return s.ovnAgent.CheckLogicalPort(logicalSwitch, ifaceId, mac)
+}
+
+// boundClusterIPs returns the ClusterIP of each family of the pools of the
+// pod interface, v4 first, without allocating any. It fails when one of them
+// is not bound.
+func (s *CNIServer) boundClusterIPs(namespace, podName, ifName string) ([]*v1alpha1.ClusterIP, error) {
+	request := histack_ipam.IPAMRequest{
+		Interface: ifName,
+		Namespace: namespace,
+		Name:      podName,
+	}
+	families, err := s.ipam.InterfaceFamilies(request)
+	if err != nil {
+		return nil, err
+	}
+	var clusterIPs []*v1alpha1.ClusterIP
+	for _, family := range families {
+		request.Family = family
+		clusterIP, _, err := s.ipam.FindClusterIP(request)
+		if err != nil {
+			return nil, err
+		}
+		clusterIPs = append(clusterIPs, clusterIP)
+	}
+	return clusterIPs, nil
+}
+
+// checkPrevResult verifies that the result add returned for the interface, as
+// passed back by the runtime, still has the addresses of its ClusterIPs.
+func checkPrevResult(netConf *types.NetConf, ifName string, addresses []string) error {
+	if netConf.RawPrevResult == nil {
+		return nil
+	}
+	if err := version.ParsePrevResult(netConf); err != nil {
+		return err
+	}
+	prevResult, err := current.NewResultFromResult(netConf.PrevResult)
+	if err != nil {
+		return err
+	}
+	if len(prevResult.IPs) == 0 {
+		// add reports the addresses of eth0 only.
+		return nil
+	}
+	configured := make([]string, len(prevResult.IPs))
+	for i, ipConfig := range prevResult.IPs {
+		configured[i] = ipConfig.Address.IP.String()
+		if !slices.ContainsFunc(addresses, func(address string) bool { return net.ParseIP(address).Equal(ipConfig.Address.IP) }) {
+			return fmt.Errorf("interface %s was configured with %s, its ClusterIPs are %v", ifName, ipConfig.Address.IP, addresses)
+		}
+	}
+	for _, address := range addresses {
+		if !slices.ContainsFunc(prevResult.IPs, func(ipConfig *current.IPConfig) bool { return net.ParseIP(address).Equal(ipConfig.Address.IP) }) {
+			return fmt.Errorf("interface %s was configured with %v, its ClusterIP %s is missing", ifName, configured, address)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+	"github.com/hicompute/histack/api/v1alpha1"
+	histack_ipam "github.com/hicompute/histack/pkg/ipam"
+	netUtils "github.com/hicompute/histack/pkg/net_utils"
+	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+func TestCheckPrevResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		prevResult []string
+		addresses  []string
+		wantErr    string
+	}{
+		{
+			name:      "no previous result",
+			addresses: []string{"10.0.0.5"},
+		},
+		{
+			name:       "secondary interface",
+			prevResult: []string{},
+			addresses:  []string{"10.0.0.5"},
+		},
+		{
+			name:       "v4",
+			prevResult: []string{"10.0.0.5/24"},
+			addresses:  []string{"10.0.0.5"},
+		},
+		{
+			name:       "v6",
+			prevResult: []string{"fd00::5/64"},
+			addresses:  []string{"fd00:0:0:0::5"},
+		},
+		{
+			name:       "dual-stack",
+			prevResult: []string{"10.0.0.5/24", "fd00::5/64"},
+			addresses:  []string{"10.0.0.5", "fd00::5"},
+		},
+		{
+			name:       "another address",
+			prevResult: []string{"10.0.0.6/24"},
+			addresses:  []string{"10.0.0.5"},
+			wantErr:    "configured with 10.0.0.6",
+		},
+		{
+			name:       "missing v6 address",
+			prevResult: []string{"10.0.0.5/24"},
+			addresses:  []string{"10.0.0.5", "fd00::5"},
+			wantErr:    "fd00::5 is missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netConf := &types.NetConf{CNIVersion: "1.0.0"}
+			if tt.prevResult != nil {
+				netConf.RawPrevResult = prevResult(t, tt.prevResult...)
+			}
+			err := checkPrevResult(netConf, "eth0", tt.addresses)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("checkPrevResult: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("checkPrevResult = %v, want an error with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBoundClusterIPs(t *testing.T) {
+	vmi := &kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "vm2",
+			UID:       "vm2-uid",
+			Annotations: map[string]string{
+				v1alpha1.NetworkPoolsAnnotation: `{"default":{"poolSelector":{"matchLabels":{"network":"default"}}}}`,
+			},
+		},
+		Spec: kubevirtv1.VirtualMachineInstanceSpec{
+			Domain: kubevirtv1.DomainSpec{Devices: kubevirtv1.Devices{Interfaces: []kubevirtv1.Interface{{Name: "default"}}}},
+			Networks: []kubevirtv1.Network{
+				{Name: "default", NetworkSource: kubevirtv1.NetworkSource{Pod: &kubevirtv1.PodNetwork{}}},
+			},
+		},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "virt-launcher-vm2-abcde",
+		Labels:    map[string]string{"vm.kubevirt.io/name": "vm2"},
+	}}
+	s := &CNIServer{ipam: *histack_ipam.NewWithClient(newFakeClient(t,
+		vmi, pod,
+		newPool("default-v4", "v4", "10.62.0.0/24", map[string]string{"network": "default"}),
+		newPool("default-v6", "v6", "fd00:62::/64", map[string]string{"network": "default"}),
+	))}
+
+	if _, err := s.boundClusterIPs(pod.Namespace, pod.Name, "eth0"); err == nil || !strings.Contains(err.Error(), "no v4 ClusterIP") {
+		t.Fatalf("boundClusterIPs before add = %v, want no v4 ClusterIP", err)
+	}
+	allocated, _, err := s.allocate(pod.Namespace, pod.Name, "eth0")
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	clusterIPs, err := s.boundClusterIPs(pod.Namespace, pod.Name, "eth0")
+	if err != nil {
+		t.Fatalf("boundClusterIPs: %v", err)
+	}
+	if len(clusterIPs) != 2 {
+		t.Fatalf("boundClusterIPs got %d ClusterIPs, want a v4 and a v6 one", len(clusterIPs))
+	}
+	for i := range clusterIPs {
+		if clusterIPs[i].Name != allocated[i].Name {
+			t.Errorf("boundClusterIPs got %s, want %s", clusterIPs[i].Name, allocated[i].Name)
+		}
+	}
+	netConf := &types.NetConf{CNIVersion: "1.0.0", RawPrevResult: prevResult(t,
+		clusterIPs[0].Spec.Address+"/24", clusterIPs[1].Spec.Address+"/64")}
+	if err := checkPrevResult(netConf, "eth0", []string{clusterIPs[0].Spec.Address, clusterIPs[1].Spec.Address}); err != nil {
+		t.Errorf("checkPrevResult of the dual-stack result: %v", err)
+	}
+}
+
+func TestAddDualStack(t *testing.T) {
+	vmi := &kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "vm3",
+			UID:       "vm3-uid",
+			Annotations: map[string]string{
+				v1alpha1.NetworkPoolsAnnotation: `{"default":{"poolSelector":{"matchLabels":{"network":"default"}}}}`,
+			},
+		},
+		Spec: kubevirtv1.VirtualMachineInstanceSpec{
+			Domain: kubevirtv1.DomainSpec{Devices: kubevirtv1.Devices{Interfaces: []kubevirtv1.Interface{{Name: "default"}}}},
+			Networks: []kubevirtv1.Network{
+				{Name: "default", NetworkSource: kubevirtv1.NetworkSource{Pod: &kubevirtv1.PodNetwork{}}},
+			},
+		},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "virt-launcher-vm3-abcde",
+		Labels:    map[string]string{"vm.kubevirt.io/name": "vm3"},
+	}}
+	v4 := newPool("default-v4", "v4", "10.63.0.0/24", map[string]string{"network": "default"})
+	v4.Spec.Gateway = "10.63.0.1"
+	v6 := newPool("default-v6", "v6", "fd00:63::/64", map[string]string{"network": "default"})
+	v6.Spec.Gateway = "fd00:63::1"
+	s := &CNIServer{ipam: *histack_ipam.NewWithClient(newFakeClient(t, vmi, pod, v4, v6))}
+
+	clusterIPs, pools, err := s.allocate(pod.Namespace, pod.Name, "eth0")
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	ipAddresses, gateways, err := interfaceAddresses("eth0", clusterIPs, pools)
+	if err != nil {
+		t.Fatalf("interfaceAddresses: %v", err)
+	}
+	if len(ipAddresses) != 2 || ipAddresses[1].IP.To4() != nil || !gateways[1].Equal(net.ParseIP("fd00:63::1")) {
+		t.Fatalf("interfaceAddresses = %v via %v, want a v4 and a v6 address with their gateways", ipAddresses, gateways)
+	}
+	result := addResult("eth0", &current.Interface{Name: "eth0"}, ipAddresses, gateways)
+	if len(result.IPs) != 2 || result.IPs[1].Address.String() != ipAddresses[1].String() || !result.IPs[1].Gateway.Equal(gateways[1]) {
+		t.Errorf("result IPs = %v, want both addresses with their gateways", result.IPs)
+	}
+	if _, secondary, _ := interfaceAddresses("net1", clusterIPs, pools); secondary[0] != nil || secondary[1] != nil {
+		t.Errorf("gateways of net1 = %v, want the default routes left to eth0", secondary)
+	}
+
+	if os.Geteuid() != 0 {
+		t.Skip("configuring a network namespace needs root")
+	}
+	hostNS, err := testutils.NewNS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testutils.UnmountNS(hostNS)
+	contNS, err := testutils.NewNS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testutils.UnmountNS(contNS)
+	if err := hostNS.Do(func(ns.NetNS) error {
+		_, _, err := netUtils.SetupVeth(contNS.Path(), "eth0", clusterIPs[0].Spec.Mac, 1500, ipAddresses, gateways)
+		return err
+	}); err != nil {
+		t.Fatalf("SetupVeth: %v", err)
+	}
+	if err := contNS.Do(func(ns.NetNS) error {
+		link, err := netlink.LinkByName("eth0")
+		if err != nil {
+			return err
+		}
+		for i, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+			addrs, err := netlink.AddrList(link, family)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(addrs, func(addr netlink.Addr) bool { return addr.IPNet.String() == ipAddresses[i].String() }) {
+				t.Errorf("eth0 has %v, want %s", addrs, &ipAddresses[i])
+			}
+			routes, err := netlink.RouteList(link, family)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(routes, func(route netlink.Route) bool {
+				ones, _ := route.Dst.Mask.Size()
+				return ones == 0 && route.Gw.Equal(gateways[i])
+			}) {
+				t.Errorf("eth0 has routes %v, want a default route through %s", routes, gateways[i])
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// prevResult is the raw result of add with the addresses on eth0.
+func prevResult(t *testing.T, addresses ...string) map[string]interface{} {
+	t.Helper()
+	result := current.Result{CNIVersion: "1.0.0", Interfaces: []*current.Interface{{Name: "eth0"}}}
+	for _, address := range addresses {
+		ip, ipNet, err := net.ParseCIDR(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		result.IPs = append(result.IPs, &current.IPConfig{Interface: current.Int(0), Address: *ipNet})
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
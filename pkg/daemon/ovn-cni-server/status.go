@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"context"
+
+	helper "github.com/hicompute/histack/pkg/helpers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// publishNetworkStatus sets the network-status entry of a pod interface, or
+// removes it when status is nil. Interfaces of a pod are added concurrently,
+// so conflicting updates are retried.
+func (s *CNIServer) publishNetworkStatus(namespace, podName, ifName string, status *helper.NetworkStatus) error {
+	ctx := context.Background()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var pod corev1.Pod
+		if err := s.k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: podName}, &pod); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		patch := client.MergeFromWithOptions(pod.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		annotations, err := helper.SetNetworkStatus(pod.Annotations, ifName, status)
+		if err != nil {
+			return err
+		}
+		pod.Annotations = annotations
+		return s.k8sClient.Patch(ctx, &pod, patch)
+	})
+}
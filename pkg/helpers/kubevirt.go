@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// PodInterface is a network declared in a VMI spec and the pod interface it
+// is plugged into.
+type PodInterface struct {
+	// Name is the pod interface of the network, the one a hotplugged network gets.
+	Name string
+	// Aliases are the ordinal net<N> names pods of older KubeVirt releases use.
+	Aliases   []string
+	Network   kubevirtv1.Network
+	Interface kubevirtv1.Interface
+}
+
+// Secondary reports whether the network is plugged in beside the pod network.
+func (p PodInterface) Secondary() bool {
+	return p.Name != "eth0"
+}
+
+// Names returns the name and the aliases of the pod interface.
+func (p PodInterface) Names() []string {
+	return append([]string{p.Name}, p.Aliases...)
+}
+
+// DeclaredPodInterfaces returns the pod interfaces of the networks declared in
+// a VMI spec, or the template of a VM. The pod network and the default Multus
+// network are eth0.
+func DeclaredPodInterfaces(spec *kubevirtv1.VirtualMachineInstanceSpec) []PodInterface {
+	var declared []PodInterface
+	ordinal := 0
+	for _, network := range spec.Networks {
+		var iface *kubevirtv1.Interface
+		for i := range spec.Domain.Devices.Interfaces {
+			if spec.Domain.Devices.Interfaces[i].Name == network.Name {
+				iface = &spec.Domain.Devices.Interfaces[i]
+			}
+		}
+		if iface == nil {
+			continue
+		}
+		if network.Pod != nil || (network.Multus != nil && network.Multus.Default) {
+			declared = append(declared, PodInterface{Name: "eth0", Network: network, Interface: *iface})
+			continue
+		}
+		ordinal++
+		declared = append(declared, PodInterface{
+			Name:      HashedPodInterfaceName(network.Name),
+			Aliases:   []string{fmt.Sprintf("net%d", ordinal)},
+			Network:   network,
+			Interface: *iface,
+		})
+	}
+	return declared
+}
+
+// HashedPodInterfaceName is the pod interface KubeVirt names after a network.
+func HashedPodInterfaceName(networkName string) string {
+	return fmt.Sprintf("pod%x", sha256.Sum256([]byte(networkName)))[:14]
+}
+
+// LogicalPortName is the OVN logical switch port, and OVS iface-id, of a pod
+// interface. The ports of virt-launcher pods are named after their VM, so the
+// port of a VM interface stays the same across live migrations.
+func LogicalPortName(namespace, podName, ifName string) string {
+	if vmName := ExtractVMName(podName); vmName != "" {
+		return namespace + "_" + vmName + "_" + ifName
+	}
+	return namespace + "_" + podName + "_" + ifName
+}
@@ -0,0 +1,72 @@
+package helper
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// NetworkStatusAnnotation is the standard annotation listing the networks of a pod.
+const NetworkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+
+// NetworkStatus is an entry of the network-status annotation. Besides the
+// standard fields it names the pool and the logical switch of the address.
+type NetworkStatus struct {
+	Name          string   `json:"name"`
+	Interface     string   `json:"interface,omitempty"`
+	IPs           []string `json:"ips,omitempty"`
+	Mac           string   `json:"mac,omitempty"`
+	Default       bool     `json:"default,omitempty"`
+	Gateway       []string `json:"gateway,omitempty"`
+	ClusterIPPool string   `json:"clusterIPPool,omitempty"`
+	LogicalSwitch string   `json:"logicalSwitch,omitempty"`
+}
+
+// ParseNetworkStatus returns the entries of a network-status annotation.
+func ParseNetworkStatus(annotations map[string]string) ([]NetworkStatus, error) {
+	var statuses []NetworkStatus
+	if value := annotations[NetworkStatusAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &statuses); err != nil {
+			return nil, err
+		}
+	}
+	return statuses, nil
+}
+
+// SetNetworkStatus replaces the entry of the interface in the network-status
+// annotation, or adds it. The entry of a nil status is removed.
+func SetNetworkStatus(annotations map[string]string, iface string, status *NetworkStatus) (map[string]string, error) {
+	statuses, err := ParseNetworkStatus(annotations)
+	if err != nil {
+		return nil, err
+	}
+	statuses = slices.DeleteFunc(statuses, func(s NetworkStatus) bool {
+		return s.Interface == iface
+	})
+	if status != nil {
+		statuses = append(statuses, *status)
+	}
+	slices.SortStableFunc(statuses, func(a, b NetworkStatus) int {
+		// the default network first, as multus lists it.
+		switch {
+		case a.Default == b.Default:
+			return 0
+		case a.Default:
+			return -1
+		}
+		return 1
+	})
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if len(statuses) == 0 {
+		delete(annotations, NetworkStatusAnnotation)
+		return annotations, nil
+	}
+	value, err := json.Marshal(statuses)
+	if err != nil {
+		return nil, err
+	}
+	annotations[NetworkStatusAnnotation] = string(value)
+	return annotations, nil
+}
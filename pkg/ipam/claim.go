@@ -0,0 +1,179 @@
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hicompute/histack/api/v1alpha1"
+	netutils "github.com/hicompute/histack/pkg/net_utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// BindIPClaim returns the ClusterIP bound to the claim, allocating one from a
+// matching pool when the claim has none yet.
+func (ipam *IPAM) BindIPClaim(ctx context.Context, claim *v1alpha1.IPClaim) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	match, err := claimPoolMatcher(claim)
+	if err != nil {
+		return nil, nil, err
+	}
+	owner := &workloadOwner{
+		Kind:      v1alpha1.IPClaimKind,
+		Namespace: claim.Namespace,
+		Name:      claim.Name,
+		UID:       claim.UID,
+		Retention: v1alpha1.ClusterIPRetentionEphemeral,
+	}
+	return ipam.bindOwnedClusterIP(ctx, owner, ClaimFamily(claim), match)
+}
+
+// bindOwnedClusterIP returns the ClusterIP held by an API object such as an
+// IPClaim, allocating one from a pool accepted by match when it has none yet.
+func (ipam *IPAM) bindOwnedClusterIP(ctx context.Context, owner *workloadOwner, family string, match func(*v1alpha1.ClusterIPPool) bool) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	resource := owner.Namespace + "/" + owner.Name
+
+	var list v1alpha1.ClusterIPList
+	if err := ipam.k8sClient.List(ctx, &list, client.MatchingFields{"spec.resource": resource}); err != nil {
+		return nil, nil, err
+	}
+	for i := range list.Items {
+		clusterIP := &list.Items[i]
+		if clusterIP.Spec.ResourceKind != owner.Kind || clusterIP.Spec.ResourceUID != owner.UID {
+			continue
+		}
+		var pool v1alpha1.ClusterIPPool
+		if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Name: clusterIP.Spec.ClusterIPPool}, &pool); err != nil {
+			return nil, nil, err
+		}
+		return clusterIP, &pool, nil
+	}
+
+	// the seed keeps these MACs apart from workloads with the same name.
+	mac := netutils.GenerateVethMAC(strings.ToLower(owner.Kind)+":"+resource, macPrefix())
+	name := strings.Replace(resource, "/", "-", -1) + "-" + strings.ToLower(owner.Kind) + "-" + shortUID(owner.UID)
+	return ipam.createClusterIP(name, "", &mac, family, owner, match)
+}
+
+// claimedClusterIP returns the ClusterIP of the owner's IPClaim for the family.
+// found is false when none of the owner's claims is of that family. The claim
+// is refused while another workload uses it, and consume records the owner as
+// its consumer.
+func (ipam *IPAM) claimedClusterIP(ctx context.Context, owner *workloadOwner, family string, consume bool) (clusterIP *v1alpha1.ClusterIP, pool *v1alpha1.ClusterIPPool, found bool, err error) {
+	for _, name := range owner.Claims {
+		var claim v1alpha1.IPClaim
+		if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Namespace: owner.Namespace, Name: name}, &claim); err != nil {
+			return nil, nil, false, fmt.Errorf("IPClaim %s/%s of %s %s: %w", owner.Namespace, name, owner.Kind, owner.Name, err)
+		}
+		if ClaimFamily(&claim) != family {
+			continue
+		}
+		if claim.Status.Phase != v1alpha1.IPClaimBound || claim.Status.ClusterIP == "" {
+			return nil, nil, false, fmt.Errorf("IPClaim %s/%s is not bound", claim.Namespace, claim.Name)
+		}
+		if err := ipam.consumeClaim(ctx, &claim, owner, consume); err != nil {
+			return nil, nil, false, err
+		}
+
+		clusterIP = &v1alpha1.ClusterIP{}
+		if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Name: claim.Status.ClusterIP}, clusterIP); err != nil {
+			return nil, nil, false, err
+		}
+		if clusterIP.Spec.ResourceKind != v1alpha1.IPClaimKind || clusterIP.Spec.ResourceUID != claim.UID {
+			return nil, nil, false, fmt.Errorf("ClusterIP %s is no longer bound to IPClaim %s/%s", clusterIP.Name, claim.Namespace, claim.Name)
+		}
+		pool = &v1alpha1.ClusterIPPool{}
+		if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Name: clusterIP.Spec.ClusterIPPool}, pool); err != nil {
+			return nil, nil, false, err
+		}
+		return clusterIP, pool, true, nil
+	}
+	return nil, nil, false, nil
+}
+
+// consumeClaim fails when another workload that still exists uses the claim,
+// and records the owner as the consumer when record is set.
+func (ipam *IPAM) consumeClaim(ctx context.Context, claim *v1alpha1.IPClaim, owner *workloadOwner, record bool) error {
+	consumer := claim.Status.Consumer
+	if consumer != nil && consumer.Kind == owner.Kind && consumer.UID == owner.UID {
+		return nil
+	}
+	if consumer != nil {
+		exists, err := ConsumerExists(ctx, ipam.k8sClient, claim.Namespace, consumer)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("IPClaim %s/%s is used by %s %s", claim.Namespace, claim.Name, consumer.Kind, consumer.Name)
+		}
+	}
+	if !record {
+		return nil
+	}
+	// a conflict with another workload recording itself is retried.
+	claim.Status.Consumer = &v1alpha1.IPClaimConsumer{Kind: owner.Kind, Name: owner.Name, UID: owner.UID}
+	return ipam.k8sClient.Status().Update(ctx, claim)
+}
+
+// ConsumerExists reports whether the workload recorded as the consumer of a
+// claim in the namespace still exists.
+func ConsumerExists(ctx context.Context, c client.Reader, namespace string, consumer *v1alpha1.IPClaimConsumer) (bool, error) {
+	var obj client.Object
+	switch consumer.Kind {
+	case "Pod":
+		obj = &corev1.Pod{}
+	case "VirtualMachine":
+		obj = &kubevirtv1.VirtualMachine{}
+	case "VirtualMachineInstance":
+		obj = &kubevirtv1.VirtualMachineInstance{}
+	default:
+		return false, nil
+	}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: consumer.Name}, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return obj.GetUID() == consumer.UID, nil
+}
+
+// claimPoolMatcher accepts the pools a claim may take an address from.
+func claimPoolMatcher(claim *v1alpha1.IPClaim) (func(*v1alpha1.ClusterIPPool) bool, error) {
+	match, err := poolMatcher(claim.Spec.ClusterIPPool, claim.Spec.PoolSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid poolSelector of IPClaim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+	return match, nil
+}
+
+// poolMatcher accepts the pool with the name, when it is set, and the pools
+// matching the selector.
+func poolMatcher(name string, poolSelector *v1.LabelSelector) (func(*v1alpha1.ClusterIPPool) bool, error) {
+	selector := labels.Everything()
+	if poolSelector != nil {
+		var err error
+		if selector, err = v1.LabelSelectorAsSelector(poolSelector); err != nil {
+			return nil, err
+		}
+	}
+	return func(pool *v1alpha1.ClusterIPPool) bool {
+		if name != "" && pool.Name != name {
+			return false
+		}
+		return selector.Matches(labels.Set(pool.Labels))
+	}, nil
+}
+
+// ClaimFamily is the family of a claim, v4 unless set.
+func ClaimFamily(claim *v1alpha1.IPClaim) string {
+	if claim.Spec.Family == "" {
+		return "v4"
+	}
+	return claim.Spec.Family
+}
@@ -0,0 +1,57 @@
+package ipam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hicompute/histack/api/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrPoolNotPublic is returned for a FloatingIP naming a pool that is not public.
+var ErrPoolNotPublic = errors.New("ClusterIPPool is not public")
+
+// BindFloatingIP returns the ClusterIP holding the public address of a
+// FloatingIP, allocating one from its pool when it has none yet. The pool
+// must be public.
+func (ipam *IPAM) BindFloatingIP(ctx context.Context, fip *v1alpha1.FloatingIP) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	var pool v1alpha1.ClusterIPPool
+	if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Name: fip.Spec.ClusterIPPool}, &pool); err != nil {
+		return nil, nil, err
+	}
+	if !pool.Spec.Public {
+		return nil, nil, fmt.Errorf("%w: %s", ErrPoolNotPublic, pool.Name)
+	}
+	owner := &workloadOwner{
+		Kind:      v1alpha1.FloatingIPKind,
+		Namespace: fip.Namespace,
+		Name:      fip.Name,
+		UID:       fip.UID,
+		Retention: v1alpha1.ClusterIPRetentionEphemeral,
+	}
+	return ipam.bindOwnedClusterIP(ctx, owner, pool.Spec.IPFamily, func(p *v1alpha1.ClusterIPPool) bool {
+		return p.Name == pool.Name
+	})
+}
+
+// RecordAssociation appends an association of a floating ClusterIP with a
+// workload, which ended at endedAt, to its history. An association already in
+// the history, e.g. from a reconcile whose FloatingIP update failed, is not
+// appended again.
+func RecordAssociation(ctx context.Context, c client.Client, clusterIP *v1alpha1.ClusterIP, resource string, associatedAt, endedAt v1.Time) error {
+	for _, entry := range clusterIP.Status.History {
+		if entry.Resource == resource && entry.AllocatedAt.Equal(&associatedAt) {
+			return nil
+		}
+	}
+	clusterIP.Status.History = append(clusterIP.Status.History, v1alpha1.ClusterIPHistory{
+		Mac:         clusterIP.Spec.Mac,
+		Resource:    resource,
+		AllocatedAt: associatedAt,
+		ReleasedAt:  endedAt,
+	})
+	return c.Status().Update(ctx, clusterIP)
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"net"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/hicompute/histack/api/v1alpha1"
 	helper "github.com/hicompute/histack/pkg/helpers"
 	"github.com/hicompute/histack/pkg/k8s"
+	"github.com/hicompute/histack/pkg/metrics"
 	netutils "github.com/hicompute/histack/pkg/net_utils"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -18,7 +21,9 @@ import (
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	kubevirtv1 "kubevirt.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -36,22 +41,158 @@ func New() *IPAM {
 	}
 }
 
+// NewWithClient returns an IPAM using the given client, such as the cached client of a manager.
+func NewWithClient(c client.Client) *IPAM {
+	return &IPAM{k8sClient: c}
+}
+
+// FindOrCreateClusterIP returns the ClusterIP of a pod interface, allocating
+// one when it has none. Conflicting updates, e.g. two pods taking the next
+// index of a pool at once, are retried.
 func (ipam *IPAM) FindOrCreateClusterIP(r IPAMRequest) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	return retryFindOrCreate(func() (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+		return ipam.findOrCreateClusterIP(r)
+	})
+}
+
+// FindOrCreateVMClusterIP returns the ClusterIP of an interface of a
+// VirtualMachine, allocating one before its launcher pod exists. The CNI ADD
+// of the pod then finds it. mac is used for a new ClusterIP when it is set.
+func (ipam *IPAM) FindOrCreateVMClusterIP(ctx context.Context, vm *kubevirtv1.VirtualMachine, iface, family, mac string) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	return retryFindOrCreate(func() (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+		return ipam.findOrCreateForOwner(ctx, vmOwner(vm), IPAMRequest{
+			Namespace: vm.Namespace,
+			Name:      vm.Name,
+			Interface: iface,
+			Mac:       &mac,
+			Family:    family,
+		})
+	})
+}
+
+// retryFindOrCreate retries find on conflicts and observes its latency.
+func retryFindOrCreate(find func() (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error)) (clusterIP *v1alpha1.ClusterIP, pool *v1alpha1.ClusterIPPool, err error) {
+	start := time.Now()
+	retries := -1
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		retries++
+		var err error
+		clusterIP, pool, err = find()
+		return err
+	})
+
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metrics.FindOrCreateConflictRetries.Observe(float64(retries))
+	metrics.FindOrCreateDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	return clusterIP, pool, err
+}
+
+func (ipam *IPAM) findOrCreateClusterIP(r IPAMRequest) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
 	ctx := context.Background()
 	var pod corev1.Pod
 
 	if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: r.Name}, &pod); err != nil {
 		return nil, nil, err
 	}
-	kubevirtVM := pod.Labels["vm.kubevirt.io/name"]
-	resource := r.Namespace + "/"
-	// var vmIface kubevirtv1.VirtualMachineInstanceNetworkInterface
-	if kubevirtVM != "" {
-		resource += kubevirtVM
-	} else {
-		resource += r.Name
+	owner, err := ipam.resolveOwner(ctx, &pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ipam.findOrCreateForOwner(ctx, owner, r)
+}
+
+// findOrCreateForOwner returns the ClusterIP of an interface of the owner,
+// allocating one when it has none.
+func (ipam *IPAM) findOrCreateForOwner(ctx context.Context, owner *workloadOwner, r IPAMRequest) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	clusterIP, pool, err := ipam.findForOwner(ctx, owner, r, true)
+	if err != nil || clusterIP != nil {
+		return clusterIP, pool, err
 	}
 
+	resource := owner.Namespace + "/" + owner.Name
+	list, err := ipam.interfaceClusterIPs(ctx, resource, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the interface keeps the MACs of the NICs of a VM apart.
+	mac := netutils.GenerateVethMAC(resource+"/"+r.Interface, macPrefix())
+	if r.Mac != nil && *r.Mac != "" {
+		mac = *r.Mac
+	}
+	name := strings.Replace(resource, "/", "-", -1) + "-" + r.Interface
+	if r.Family != "v4" {
+		// the addresses of a dual-stack interface.
+		name += "-" + r.Family
+	}
+	match, err := owner.poolMatcher(r.Interface)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(list) < 1 {
+		return ipam.createClusterIP(name, r.Interface, &mac, r.Family, owner, match)
+	}
+	clusterIP = &list[0]
+	if clusterIP.Spec.ResourceUID != "" && clusterIP.Spec.Retention != v1alpha1.ClusterIPRetentionSticky {
+		// the address belongs to a previous workload with the same name.
+		klog.Infof("releasing clusterIP %s of a previous %s %s", clusterIP.Name, clusterIP.Spec.ResourceKind, resource)
+		if err := ReleaseClusterIP(ctx, ipam.k8sClient, clusterIP, v1.Now()); err != nil {
+			return nil, nil, err
+		}
+		return ipam.createClusterIP(name+"-"+shortUID(owner.UID), r.Interface, &mac, r.Family, owner, match)
+	}
+	owner.bind(clusterIP)
+	if err := ipam.k8sClient.Update(ctx, clusterIP); err != nil {
+		return nil, nil, err
+	}
+	if clusterIP.Status.RetainedUntil != nil {
+		// a retained address is claimed by a workload with the same name.
+		clusterIP.Status.RetainedUntil = nil
+		if err := ipam.k8sClient.Status().Update(ctx, clusterIP); err != nil {
+			return nil, nil, err
+		}
+	}
+	var ipPool v1alpha1.ClusterIPPool
+	if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Name: clusterIP.Spec.ClusterIPPool}, &ipPool); err != nil {
+		return nil, nil, err
+	}
+	return clusterIP, &ipPool, nil
+}
+
+// findForOwner returns the ClusterIP bound to an interface of the owner, the
+// one of its IPClaim for eth0, or nil when it has none. consume records the
+// owner as the consumer of the claim.
+func (ipam *IPAM) findForOwner(ctx context.Context, owner *workloadOwner, r IPAMRequest, consume bool) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	if r.Interface == "eth0" && len(owner.Claims) > 0 {
+		clusterIP, pool, found, err := ipam.claimedClusterIP(ctx, owner, r.Family, consume)
+		if err != nil || found {
+			return clusterIP, pool, err
+		}
+	}
+
+	list, err := ipam.interfaceClusterIPs(ctx, owner.Namespace+"/"+owner.Name, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range list {
+		clusterIP := &list[i]
+		if clusterIP.Spec.ResourceUID != owner.UID {
+			continue
+		}
+		var ipPool v1alpha1.ClusterIPPool
+		if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Name: clusterIP.Spec.ClusterIPPool}, &ipPool); err != nil {
+			return nil, nil, err
+		}
+		return clusterIP, &ipPool, nil
+	}
+	return nil, nil, nil
+}
+
+// interfaceClusterIPs lists the ClusterIPs of the family of an interface of
+// the resource, those of previous workloads with the same name included.
+func (ipam *IPAM) interfaceClusterIPs(ctx context.Context, resource string, r IPAMRequest) ([]v1alpha1.ClusterIP, error) {
 	var list v1alpha1.ClusterIPList
 	if err := ipam.k8sClient.List(ctx, &list, &client.ListOptions{
 		FieldSelector: fields.AndSelectors(
@@ -61,36 +202,115 @@ func (ipam *IPAM) FindOrCreateClusterIP(r IPAMRequest) (*v1alpha1.ClusterIP, *v1
 		),
 		Limit: 1000,
 	}); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	macPrefix := os.Getenv("MAC_PREFIX")
-	if macPrefix == "" {
-		macPrefix = "02"
+	return list.Items, nil
+}
+
+// InterfaceFamilies returns the families of the pools a pod interface takes
+// its addresses from, v4 when the network of the interface has no pools.
+func (ipam *IPAM) InterfaceFamilies(r IPAMRequest) ([]string, error) {
+	ctx := context.Background()
+	var pod corev1.Pod
+
+	if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: r.Name}, &pod); err != nil {
+		return nil, err
 	}
+	owner, err := ipam.resolveOwner(ctx, &pod)
+	if err != nil {
+		return nil, err
+	}
+	return ipam.ownerFamilies(ctx, owner, r.Interface)
+}
+
+// VMInterfaceFamilies returns the families of the pools a pod interface of a
+// VirtualMachine takes its addresses from, v4 when its network has no pools.
+func (ipam *IPAM) VMInterfaceFamilies(ctx context.Context, vm *kubevirtv1.VirtualMachine, iface string) ([]string, error) {
+	return ipam.ownerFamilies(ctx, vmOwner(vm), iface)
+}
 
-	mac := netutils.GenerateVethMAC(resource, macPrefix)
-	if len(list.Items) < 1 {
-		return ipam.createClusterIP(r.Interface, &mac, r.Family, resource)
+// ownerFamilies returns the families of the pools an interface of the owner
+// takes its addresses from, v4 first. Public pools are left to FloatingIPs.
+func (ipam *IPAM) ownerFamilies(ctx context.Context, owner *workloadOwner, iface string) ([]string, error) {
+	match, err := owner.poolMatcher(iface)
+	if err != nil {
+		return nil, err
 	}
-	var ipPool v1alpha1.ClusterIPPool
-	if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Name: list.Items[0].Spec.ClusterIPPool}, &ipPool); err != nil {
-		return nil, nil, err
+	if match == nil {
+		return []string{"v4"}, nil
 	}
-	return &list.Items[0], &ipPool, nil
+	var list v1alpha1.ClusterIPPoolList
+	if err := ipam.k8sClient.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	var families []string
+	for i := range list.Items {
+		if !list.Items[i].Spec.Public && match(&list.Items[i]) && !slices.Contains(families, list.Items[i].Spec.IPFamily) {
+			families = append(families, list.Items[i].Spec.IPFamily)
+		}
+	}
+	if len(families) == 0 {
+		return nil, fmt.Errorf("no ClusterIPPool serves interface %s of %s %s/%s", iface, owner.Kind, owner.Namespace, owner.Name)
+	}
+	// v4 first, the address of a dual-stack interface reported first.
+	slices.Sort(families)
+	return families, nil
 }
 
-func (ipam *IPAM) createClusterIP(iface string, mac *string, ipFamily, resource string) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+// FindClusterIP returns the ClusterIP bound to a pod interface without
+// allocating or rebinding one. It fails when the interface has none.
+func (ipam *IPAM) FindClusterIP(r IPAMRequest) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
 	ctx := context.Background()
+	var pod corev1.Pod
+
+	if err := ipam.k8sClient.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: r.Name}, &pod); err != nil {
+		return nil, nil, err
+	}
+	owner, err := ipam.resolveOwner(ctx, &pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	clusterIP, pool, err := ipam.findForOwner(ctx, owner, r, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if clusterIP == nil {
+		return nil, nil, fmt.Errorf("no %s ClusterIP is bound to interface %s of %s %s/%s", r.Family, r.Interface, owner.Kind, owner.Namespace, owner.Name)
+	}
+	return clusterIP, pool, nil
+}
 
-	ipPool, err := ipam.findEmptyClusterIPPool(ipFamily)
+// createClusterIP allocates an address from the first pool with free addresses
+// accepted by match, any pool of the family when match is nil. FloatingIPs
+// take theirs from public pools, everything else from the other ones. A pool
+// found to be exhausted after all is skipped for the next one.
+func (ipam *IPAM) createClusterIP(name, iface string, mac *string, ipFamily string, owner *workloadOwner, match func(*v1alpha1.ClusterIPPool) bool) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	pools, err := ipam.findEmptyClusterIPPools(ipFamily, owner.Kind == v1alpha1.FloatingIPKind, match)
 	if err != nil {
 		return nil, nil, err
 	}
+	for i := range pools {
+		clusterIP, ipPool, err := ipam.allocateFromPool(&pools[i], name, iface, mac, ipFamily, owner)
+		if errors.IsNotFound(err) {
+			klog.Infof("skipping clusterIP pool %s: %v", pools[i].Name, err)
+			continue
+		}
+		return clusterIP, ipPool, err
+	}
+	return nil, nil, errors.NewNotFound(schema.GroupResource{Group: v1alpha1.GroupVersion.Group, Resource: "clusterippools"}, fmt.Sprintf("no free %s pool", ipFamily))
+}
+
+// allocateFromPool allocates the next index of a pool or, once they are all
+// handed out, its first released ClusterIP. It returns a NotFound error when
+// the pool has neither.
+func (ipam *IPAM) allocateFromPool(ipPool *v1alpha1.ClusterIPPool, name, iface string, mac *string, ipFamily string, owner *workloadOwner) (*v1alpha1.ClusterIP, *v1alpha1.ClusterIPPool, error) {
+	ctx := context.Background()
 
 	var idx *big.Int
 
 	var clusterIP v1alpha1.ClusterIP
 	ipPool = ipPool.DeepCopy()
+	previousIndex := ipPool.Status.NextIndex
 
 	allocatedIps := helper.StringToBigInt(ipPool.Status.AllocatedIPs)
 	freeIps := helper.StringToBigInt(ipPool.Status.FreeIPs)
@@ -105,26 +325,59 @@ func (ipam *IPAM) createClusterIP(iface string, mac *string, ipFamily, resource
 
 	if idx.Cmp(totalIps.Sub(totalIps, big.NewInt(1))) == 0 || idx.Cmp(totalIps.Sub(totalIps, big.NewInt(1))) == 1 {
 		// use a released ip
+		if len(ipPool.Status.ReleasedClusterIPs) == 0 {
+			return nil, nil, errors.NewNotFound(schema.GroupResource{Group: v1alpha1.GroupVersion.Group, Resource: "clusterips"},
+				fmt.Sprintf("released clusterIP of exhausted pool %s", ipPool.Name))
+		}
 		firstReleasedIPName := ipPool.Status.ReleasedClusterIPs[0]
-		if err = ipam.k8sClient.Get(ctx, client.ObjectKey{Name: firstReleasedIPName}, &clusterIP); err != nil {
-			klog.Errorf("the release cluster ip %s not found in pool %s!", firstReleasedIPName, ipPool.GetName())
+		ipPool.Status.ReleasedClusterIPs = ipPool.Status.ReleasedClusterIPs[1:]
+		if err := ipam.k8sClient.Get(ctx, client.ObjectKey{Name: firstReleasedIPName}, &clusterIP); err != nil {
+			if errors.IsNotFound(err) {
+				// drop the name of a deleted ClusterIP, a conflict is retried.
+				klog.Errorf("the released cluster ip %s not found in pool %s!", firstReleasedIPName, ipPool.GetName())
+				if updateErr := ipam.k8sClient.Status().Update(ctx, ipPool); updateErr != nil {
+					return nil, nil, updateErr
+				}
+			}
 			return nil, nil, err
 		}
-
-		ipPool.Status.ReleasedClusterIPs = ipPool.Status.ReleasedClusterIPs[1:]
 		if err := ipam.k8sClient.Status().Update(ctx, ipPool); err != nil {
 			return nil, nil, err
 		}
-		return &clusterIP, nil, nil
+		clusterIP.Spec.Mac = *mac
+		clusterIP.Spec.Interface = iface
+		owner.bind(&clusterIP)
+		if err := ipam.k8sClient.Update(ctx, &clusterIP); err != nil {
+			if rollbackErr := ipam.returnReleased(ctx, ipPool.Name, firstReleasedIPName); rollbackErr != nil {
+				klog.Errorf("failed to return released clusterIP %s to pool %s: %v", firstReleasedIPName, ipPool.Name, rollbackErr)
+			}
+			return nil, nil, err
+		}
+		clusterIP.Status.History = append(clusterIP.Status.History, v1alpha1.ClusterIPHistory{
+			AllocatedAt: v1.NewTime(time.Now()),
+		})
+		if err := ipam.k8sClient.Status().Update(ctx, &clusterIP); err != nil {
+			return nil, nil, err
+		}
+		metrics.Reuses.WithLabelValues(ipPool.Name).Inc()
+		return &clusterIP, ipPool, nil
 	}
 	ipAddress, err := netutils.PickUsableIPFromCIDRIndex(ipPool.Spec.CIDR, idx)
 	if err != nil {
 		return nil, nil, err
 	}
+	if net.ParseIP(ipAddress).Equal(net.ParseIP(ipPool.Spec.Gateway)) {
+		// never hand out the gateway of the pool.
+		idx.Add(idx, big.NewInt(1))
+		nextIndex.Add(nextIndex, big.NewInt(1))
+		if ipAddress, err = netutils.PickUsableIPFromCIDRIndex(ipPool.Spec.CIDR, idx); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	clusterIP = v1alpha1.ClusterIP{
 		ObjectMeta: v1.ObjectMeta{
-			Name: strings.Replace(resource, "/", "-", -1) + "-" + iface,
+			Name: name,
 		},
 		Spec: v1alpha1.ClusterIPSpec{
 			ClusterIPPool: ipPool.GetName(),
@@ -132,7 +385,6 @@ func (ipam *IPAM) createClusterIP(iface string, mac *string, ipFamily, resource
 			Interface:     iface,
 			Address:       ipAddress,
 			Family:        ipFamily,
-			Resource:      resource,
 		},
 		Status: v1alpha1.ClusterIPStatus{
 			History: []v1alpha1.ClusterIPHistory{{
@@ -141,11 +393,6 @@ func (ipam *IPAM) createClusterIP(iface string, mac *string, ipFamily, resource
 		},
 	}
 
-	if err := ipam.k8sClient.Create(ctx, &clusterIP); err != nil {
-		klog.Errorf("the error on create clusterIP: %v", err)
-		return nil, nil, err
-	}
-
 	if idx.Cmp(totalIps.Sub(totalIps, big.NewInt(1))) == -1 {
 		nextIndex.Add(nextIndex, big.NewInt(1))
 	}
@@ -156,14 +403,84 @@ func (ipam *IPAM) createClusterIP(iface string, mac *string, ipFamily, resource
 	ipPool.Status.NextIndex = nextIndex.String()
 	ipPool.Status.FreeIPs = freeIps.String()
 
+	// Reserve the index before creating the ClusterIP. A concurrent allocation
+	// conflicts here, before anything is created, and is retried.
 	if err := ipam.k8sClient.Status().Update(ctx, ipPool); err != nil {
 		return nil, nil, err
 	}
 
+	owner.bind(&clusterIP)
+	if err := ipam.k8sClient.Create(ctx, &clusterIP); err != nil {
+		klog.Errorf("the error on create clusterIP: %v", err)
+		if rollbackErr := ipam.unreserve(ctx, ipPool.Name, ipPool.Status.NextIndex, previousIndex, ipAddress, ipFamily); rollbackErr != nil {
+			klog.Errorf("failed to return address %s to pool %s: %v", ipAddress, ipPool.Name, rollbackErr)
+		}
+		return nil, nil, err
+	}
+	metrics.Allocations.WithLabelValues(ipPool.Name).Inc()
+
 	return &clusterIP, ipPool, nil
 }
 
-func (ipam *IPAM) findEmptyClusterIPPool(ipFamily string) (*v1alpha1.ClusterIPPool, error) {
+// unreserve returns the index reserved for a ClusterIP that could not be
+// created to the pool. When another allocation has moved past the index in the
+// meantime, the address is handed back as a released ClusterIP instead.
+func (ipam *IPAM) unreserve(ctx context.Context, poolName, reservedIndex, previousIndex, address, ipFamily string) error {
+	moved := false
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var pool v1alpha1.ClusterIPPool
+		if err := ipam.k8sClient.Get(ctx, client.ObjectKey{Name: poolName}, &pool); err != nil {
+			return err
+		}
+		moved = pool.Status.NextIndex != reservedIndex
+		if !moved {
+			pool.Status.NextIndex = previousIndex
+		}
+		allocatedIps := helper.StringToBigInt(pool.Status.AllocatedIPs)
+		freeIps := helper.StringToBigInt(pool.Status.FreeIPs)
+		pool.Status.AllocatedIPs = allocatedIps.Sub(allocatedIps, big.NewInt(1)).String()
+		pool.Status.FreeIPs = freeIps.Add(freeIps, big.NewInt(1)).String()
+		return ipam.k8sClient.Status().Update(ctx, &pool)
+	}); err != nil || !moved {
+		return err
+	}
+
+	// the ClusterIP controller adds the released address to the pool.
+	released := &v1alpha1.ClusterIP{
+		ObjectMeta: v1.ObjectMeta{
+			Name: poolName + "-" + strings.NewReplacer(".", "-", ":", "-").Replace(address),
+		},
+		Spec: v1alpha1.ClusterIPSpec{
+			ClusterIPPool: poolName,
+			Address:       address,
+			Family:        ipFamily,
+		},
+	}
+	if err := ipam.k8sClient.Create(ctx, released); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// returnReleased puts a released ClusterIP that could not be bound back at the
+// head of the released addresses of its pool.
+func (ipam *IPAM) returnReleased(ctx context.Context, poolName, clusterIPName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var pool v1alpha1.ClusterIPPool
+		if err := ipam.k8sClient.Get(ctx, client.ObjectKey{Name: poolName}, &pool); err != nil {
+			return err
+		}
+		if slices.Contains(pool.Status.ReleasedClusterIPs, clusterIPName) {
+			return nil
+		}
+		pool.Status.ReleasedClusterIPs = append([]string{clusterIPName}, pool.Status.ReleasedClusterIPs...)
+		return ipam.k8sClient.Status().Update(ctx, &pool)
+	})
+}
+
+// findEmptyClusterIPPools returns the public or the other pools of the family
+// accepted by match that have free addresses.
+func (ipam *IPAM) findEmptyClusterIPPools(ipFamily string, public bool, match func(*v1alpha1.ClusterIPPool) bool) ([]v1alpha1.ClusterIPPool, error) {
 	ctx := context.Background()
 	var list v1alpha1.ClusterIPPoolList
 
@@ -174,12 +491,19 @@ func (ipam *IPAM) findEmptyClusterIPPool(ipFamily string) (*v1alpha1.ClusterIPPo
 	if err != nil {
 		return nil, err
 	}
+	var pools []v1alpha1.ClusterIPPool
 	for _, pool := range list.Items {
+		if !pool.DeletionTimestamp.IsZero() || pool.Spec.Public != public || (match != nil && !match(&pool)) {
+			continue
+		}
 		if helper.StringToBigInt(pool.Status.FreeIPs).Cmp(big.NewInt(0)) == 1 {
-			return &pool, nil
+			pools = append(pools, pool)
 		}
 	}
-	return nil, errors.NewNotFound(schema.GroupResource{Group: v1alpha1.GroupVersion.Group, Resource: "clusterippools"}, fmt.Sprintf("no free %s pool", ipFamily))
+	if len(pools) == 0 {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: v1alpha1.GroupVersion.Group, Resource: "clusterippools"}, fmt.Sprintf("no free %s pool", ipFamily))
+	}
+	return pools, nil
 }
 
 func (ipam *IPAM) FindClusterIPbyFamilyandMAC(mac, family string) (*v1alpha1.ClusterIP, error) {
@@ -223,3 +547,11 @@ func (ipam *IPAM) FindReleasedClusterIP(family string) (*v1alpha1.ClusterIP, err
 	}
 	return nil, fmt.Errorf("No released ClusterIP %s found.", family)
 }
+
+// macPrefix is the first octet of generated MAC addresses.
+func macPrefix() string {
+	if prefix := os.Getenv("MAC_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return "02"
+}
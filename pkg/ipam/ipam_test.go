@@ -0,0 +1,109 @@
+package ipam
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hicompute/histack/api/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateClusterIPSkipsExhaustedPools(t *testing.T) {
+	exhausted := func(name, cidr string, released ...string) *v1alpha1.ClusterIPPool {
+		return &v1alpha1.ClusterIPPool{
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Spec:       v1alpha1.ClusterIPPoolSpec{IPFamily: "v4", CIDR: cidr},
+			// a FreeIPs counted before the last index was handed out.
+			Status: v1alpha1.ClusterIPPoolStatus{TotalIPs: "254", FreeIPs: "1", AllocatedIPs: "253", NextIndex: "253", ReleasedClusterIPs: released},
+		}
+	}
+	c := newFakeClient(t,
+		exhausted("a-no-released", "10.70.0.0/24"),
+		exhausted("b-deleted-released", "10.71.0.0/24", "deleted"),
+		&v1alpha1.ClusterIPPool{
+			ObjectMeta: v1.ObjectMeta{Name: "c-free"},
+			Spec:       v1alpha1.ClusterIPPoolSpec{IPFamily: "v4", CIDR: "10.72.0.0/24"},
+			Status:     v1alpha1.ClusterIPPoolStatus{TotalIPs: "254", FreeIPs: "254", AllocatedIPs: "0", NextIndex: "0"},
+		},
+	)
+	ipam := NewWithClient(c)
+	mac := "02:00:00:00:70:01"
+	owner := &workloadOwner{Kind: "Pod", Namespace: "default", Name: "web", UID: "web-uid"}
+
+	clusterIP, pool, err := ipam.createClusterIP("default-web-eth0", "eth0", &mac, "v4", owner, nil)
+	if err != nil {
+		t.Fatalf("createClusterIP: %v", err)
+	}
+	if pool.Name != "c-free" || clusterIP.Spec.Address != "10.72.0.1" {
+		t.Errorf("createClusterIP got %s of %s, want 10.72.0.1 of c-free", clusterIP.Spec.Address, pool.Name)
+	}
+
+	var stale v1alpha1.ClusterIPPool
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "b-deleted-released"}, &stale); err != nil {
+		t.Fatal(err)
+	}
+	if len(stale.Status.ReleasedClusterIPs) != 0 {
+		t.Errorf("released ClusterIPs of b-deleted-released = %v, want the deleted one dropped", stale.Status.ReleasedClusterIPs)
+	}
+}
+
+func TestPublicPoolsAreLeftToFloatingIPs(t *testing.T) {
+	pool := func(name, cidr string, public bool) *v1alpha1.ClusterIPPool {
+		return &v1alpha1.ClusterIPPool{
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Spec:       v1alpha1.ClusterIPPoolSpec{IPFamily: "v4", CIDR: cidr, Public: public},
+			Status:     v1alpha1.ClusterIPPoolStatus{TotalIPs: "254", FreeIPs: "254", AllocatedIPs: "0", NextIndex: "0"},
+		}
+	}
+	c := newFakeClient(t, pool("a-public", "10.80.0.0/24", true), pool("b-private", "10.81.0.0/24", false))
+	ipam := NewWithClient(c)
+	mac := "02:00:00:00:80:01"
+	owner := &workloadOwner{Kind: "Pod", Namespace: "default", Name: "web", UID: "web-uid"}
+
+	_, got, err := ipam.createClusterIP("default-web-eth0", "eth0", &mac, "v4", owner, nil)
+	if err != nil {
+		t.Fatalf("createClusterIP: %v", err)
+	}
+	if got.Name != "b-private" {
+		t.Errorf("pod got an address of %s, want b-private", got.Name)
+	}
+
+	fip := &v1alpha1.FloatingIP{
+		ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "fip", UID: "fip-uid"},
+		Spec:       v1alpha1.FloatingIPSpec{ClusterIPPool: "b-private"},
+	}
+	if _, _, err := ipam.BindFloatingIP(context.Background(), fip); !errors.Is(err, ErrPoolNotPublic) {
+		t.Errorf("BindFloatingIP from b-private = %v, want ErrPoolNotPublic", err)
+	}
+	fip.Spec.ClusterIPPool = "a-public"
+	clusterIP, got, err := ipam.BindFloatingIP(context.Background(), fip)
+	if err != nil {
+		t.Fatalf("BindFloatingIP: %v", err)
+	}
+	if got.Name != "a-public" || clusterIP.Spec.Address != "10.80.0.1" {
+		t.Errorf("BindFloatingIP got %s of %s, want 10.80.0.1 of a-public", clusterIP.Spec.Address, got.Name)
+	}
+}
+
+// newFakeClient returns a client preloaded with the objects and the field
+// selectors the IPAM lists with.
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithStatusSubresource(&v1alpha1.ClusterIP{}, &v1alpha1.ClusterIPPool{}).
+		WithIndex(&v1alpha1.ClusterIPPool{}, "spec.ipFamily", func(obj client.Object) []string {
+			return []string{obj.(*v1alpha1.ClusterIPPool).Spec.IPFamily}
+		}).
+		WithIndex(&v1alpha1.ClusterIP{}, "spec.resource", func(obj client.Object) []string {
+			return []string{obj.(*v1alpha1.ClusterIP).Spec.Resource}
+		}).
+		Build()
+}
@@ -0,0 +1,163 @@
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hicompute/histack/api/v1alpha1"
+	helper "github.com/hicompute/histack/pkg/helpers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// workloadOwner is the workload a ClusterIP is bound to.
+type workloadOwner struct {
+	Kind      string
+	Namespace string
+	Name      string
+	UID       types.UID
+	Retention v1alpha1.ClusterIPRetention
+
+	// ReleasePolicy and RetainFor override the release policy of the pool.
+	ReleasePolicy v1alpha1.ReleasePolicy
+	RetainFor     *v1.Duration
+
+	// Claims are the IPClaims in the owner's namespace its eth0 uses.
+	Claims []string
+
+	// Networks maps the pod interfaces of a VM to the names of their networks.
+	Networks map[string]string
+	// NetworkPools is the network-pools annotation of the owner.
+	NetworkPools string
+}
+
+// resolveOwner returns the VirtualMachine behind a virt-launcher pod, or the pod itself.
+func (ipam *IPAM) resolveOwner(ctx context.Context, pod *corev1.Pod) (*workloadOwner, error) {
+	owner := &workloadOwner{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}
+	annotations := pod.Annotations
+
+	if vmName := pod.Labels["vm.kubevirt.io/name"]; vmName != "" {
+		key := types.NamespacedName{Namespace: pod.Namespace, Name: vmName}
+		var vm kubevirtv1.VirtualMachine
+		var vmi kubevirtv1.VirtualMachineInstance
+		if err := ipam.k8sClient.Get(ctx, key, &vm); err == nil {
+			owner.Kind, owner.Name, owner.UID = "VirtualMachine", vm.Name, vm.UID
+			annotations = vm.Annotations
+			if vm.Spec.Template != nil {
+				owner.Networks = podNetworks(&vm.Spec.Template.Spec)
+			}
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		} else if err := ipam.k8sClient.Get(ctx, key, &vmi); err != nil {
+			return nil, err
+		} else {
+			// a VirtualMachineInstance started without a VirtualMachine.
+			owner.Kind, owner.Name, owner.UID = "VirtualMachineInstance", vmi.Name, vmi.UID
+			annotations = vmi.Annotations
+			owner.Networks = podNetworks(&vmi.Spec)
+		}
+	}
+
+	owner.applyAnnotations(annotations)
+	return owner, nil
+}
+
+// vmOwner returns a VirtualMachine as the owner of its ClusterIPs.
+func vmOwner(vm *kubevirtv1.VirtualMachine) *workloadOwner {
+	owner := &workloadOwner{Kind: "VirtualMachine", Namespace: vm.Namespace, Name: vm.Name, UID: vm.UID}
+	owner.applyAnnotations(vm.Annotations)
+	if vm.Spec.Template != nil {
+		owner.Networks = podNetworks(&vm.Spec.Template.Spec)
+	}
+	return owner
+}
+
+// applyAnnotations reads the retention, release policy and claims of the
+// owner from the annotations of its workload.
+func (owner *workloadOwner) applyAnnotations(annotations map[string]string) {
+	owner.Retention = v1alpha1.ClusterIPRetentionEphemeral
+	if v1alpha1.ClusterIPRetention(annotations[v1alpha1.RetentionAnnotation]) == v1alpha1.ClusterIPRetentionSticky {
+		owner.Retention = v1alpha1.ClusterIPRetentionSticky
+	}
+
+	switch policy := v1alpha1.ReleasePolicy(annotations[v1alpha1.ReleasePolicyAnnotation]); policy {
+	case "":
+	case v1alpha1.ReleasePolicyDelete, v1alpha1.ReleasePolicyRetain, v1alpha1.ReleasePolicyRetainFor:
+		owner.ReleasePolicy = policy
+	default:
+		klog.Warningf("ignoring unknown %s %q on %s %s/%s", v1alpha1.ReleasePolicyAnnotation, policy, owner.Kind, owner.Namespace, owner.Name)
+	}
+	if value := annotations[v1alpha1.RetainForAnnotation]; value != "" {
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			klog.Warningf("ignoring invalid %s %q on %s %s/%s", v1alpha1.RetainForAnnotation, value, owner.Kind, owner.Namespace, owner.Name)
+		} else {
+			owner.RetainFor = &v1.Duration{Duration: d}
+		}
+	}
+	for _, claim := range strings.Split(annotations[v1alpha1.IPClaimAnnotation], ",") {
+		if claim = strings.TrimSpace(claim); claim != "" {
+			owner.Claims = append(owner.Claims, claim)
+		}
+	}
+	owner.NetworkPools = annotations[v1alpha1.NetworkPoolsAnnotation]
+}
+
+// podNetworks maps the pod interfaces of a VMI spec to the names of their networks.
+func podNetworks(spec *kubevirtv1.VirtualMachineInstanceSpec) map[string]string {
+	networks := map[string]string{}
+	for _, podIface := range helper.DeclaredPodInterfaces(spec) {
+		for _, name := range podIface.Names() {
+			networks[name] = podIface.Network.Name
+		}
+	}
+	return networks
+}
+
+// poolMatcher accepts the pools the interface may take an address from, any
+// pool when the network-pools annotation does not name its network. A broken
+// annotation fails the allocation rather than take an address from the wrong pool.
+func (owner *workloadOwner) poolMatcher(iface string) (func(*v1alpha1.ClusterIPPool) bool, error) {
+	network, ok := owner.Networks[iface]
+	if !ok || owner.NetworkPools == "" {
+		return nil, nil
+	}
+	var networkPools map[string]v1alpha1.NetworkPool
+	if err := json.Unmarshal([]byte(owner.NetworkPools), &networkPools); err != nil {
+		return nil, fmt.Errorf("invalid %s on %s %s/%s: %w", v1alpha1.NetworkPoolsAnnotation, owner.Kind, owner.Namespace, owner.Name, err)
+	}
+	networkPool, ok := networkPools[network]
+	if !ok {
+		return nil, nil
+	}
+	match, err := poolMatcher(networkPool.ClusterIPPool, networkPool.PoolSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid poolSelector of network %s in %s on %s %s/%s: %w",
+			network, v1alpha1.NetworkPoolsAnnotation, owner.Kind, owner.Namespace, owner.Name, err)
+	}
+	return match, nil
+}
+
+// bind records the owner on the ClusterIP.
+func (owner *workloadOwner) bind(clusterIP *v1alpha1.ClusterIP) {
+	clusterIP.Spec.Resource = owner.Namespace + "/" + owner.Name
+	clusterIP.Spec.ResourceKind = owner.Kind
+	clusterIP.Spec.ResourceUID = owner.UID
+	clusterIP.Spec.Retention = owner.Retention
+	clusterIP.Spec.ReleasePolicy = owner.ReleasePolicy
+	clusterIP.Spec.RetainFor = owner.RetainFor
+}
+
+// shortUID keeps ClusterIP names of successive workload instances apart.
+func shortUID(uid types.UID) string {
+	if len(uid) > 8 {
+		return string(uid[:8])
+	}
+	return string(uid)
+}
@@ -0,0 +1,85 @@
+package ipam
+
+import (
+	"context"
+	"time"
+
+	"github.com/hicompute/histack/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReleaseClusterIP unbinds the ClusterIP from its workload and records the
+// binding in its history. The ClusterIP controller then returns the address to its pool.
+func ReleaseClusterIP(ctx context.Context, c client.Client, clusterIP *v1alpha1.ClusterIP, releasedAt v1.Time) error {
+	history := v1alpha1.ClusterIPHistory{
+		Mac:        clusterIP.Spec.Mac,
+		Interface:  clusterIP.Spec.Interface,
+		Resource:   clusterIP.Spec.Resource,
+		ReleasedAt: releasedAt,
+	}
+	if n := len(clusterIP.Status.History); n > 0 {
+		history.AllocatedAt = *clusterIP.Status.History[n-1].AllocatedAt.DeepCopy()
+	}
+
+	clusterIP.Spec.Mac = ""
+	clusterIP.Spec.Interface = ""
+	clusterIP.Spec.Resource = ""
+	clusterIP.Spec.ResourceKind = ""
+	clusterIP.Spec.ResourceUID = ""
+	if err := c.Update(ctx, clusterIP); err != nil {
+		return err
+	}
+	clusterIP.Status.History = append(clusterIP.Status.History, history)
+	clusterIP.Status.RetainedUntil = nil
+	return c.Status().Update(ctx, clusterIP)
+}
+
+// ReleaseOrRetain applies the release policy of a ClusterIP whose workload was deleted.
+// Retained addresses keep their resource, so a workload recreated with the same
+// name binds them again.
+func ReleaseOrRetain(ctx context.Context, c client.Client, clusterIP *v1alpha1.ClusterIP, deletedAt v1.Time) error {
+	var pool v1alpha1.ClusterIPPool
+	if err := c.Get(ctx, client.ObjectKey{Name: clusterIP.Spec.ClusterIPPool}, &pool); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	policy, retainFor := EffectiveReleasePolicy(clusterIP, &pool)
+	if policy == v1alpha1.ReleasePolicyDelete || (policy == v1alpha1.ReleasePolicyRetainFor && retainFor <= 0) {
+		return ReleaseClusterIP(ctx, c, clusterIP, deletedAt)
+	}
+
+	if clusterIP.Spec.ResourceUID != "" {
+		clusterIP.Spec.ResourceUID = ""
+		if err := c.Update(ctx, clusterIP); err != nil {
+			return err
+		}
+	}
+	clusterIP.Status.RetainedUntil = nil
+	if policy == v1alpha1.ReleasePolicyRetainFor {
+		until := v1.NewTime(deletedAt.Add(retainFor))
+		clusterIP.Status.RetainedUntil = &until
+	}
+	return c.Status().Update(ctx, clusterIP)
+}
+
+// EffectiveReleasePolicy returns the release policy of a ClusterIP and how long
+// RetainFor keeps it. The ClusterIP's own policy wins over the pool's.
+func EffectiveReleasePolicy(clusterIP *v1alpha1.ClusterIP, pool *v1alpha1.ClusterIPPool) (v1alpha1.ReleasePolicy, time.Duration) {
+	policy := clusterIP.Spec.ReleasePolicy
+	if policy == "" {
+		policy = pool.Spec.ReleasePolicy
+	}
+	if policy == "" {
+		policy = v1alpha1.ReleasePolicyDelete
+	}
+
+	var retainFor time.Duration
+	if clusterIP.Spec.RetainFor != nil {
+		retainFor = clusterIP.Spec.RetainFor.Duration
+	} else if pool.Spec.RetainFor != nil {
+		retainFor = pool.Spec.RetainFor.Duration
+	}
+	return policy, retainFor
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	PoolTotalAddresses = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "histack_clusterippool_total_addresses",
+			Help: "Usable addresses of a ClusterIPPool",
+		},
+		[]string{"pool"},
+	)
+	PoolAllocatedAddresses = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "histack_clusterippool_allocated_addresses",
+			Help: "Addresses of a ClusterIPPool bound to a workload",
+		},
+		[]string{"pool"},
+	)
+	PoolFreeAddresses = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "histack_clusterippool_free_addresses",
+			Help: "Addresses of a ClusterIPPool that are neither bound nor quarantined",
+		},
+		[]string{"pool"},
+	)
+	PoolReleasedAddresses = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "histack_clusterippool_released_addresses",
+			Help: "Released ClusterIPs of a ClusterIPPool waiting to be reused",
+		},
+		[]string{"pool"},
+	)
+	PoolQuarantinedAddresses = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "histack_clusterippool_quarantined_addresses",
+			Help: "Addresses of a ClusterIPPool held for a deleted workload by the Retain or RetainFor release policy",
+		},
+		[]string{"pool"},
+	)
+
+	Allocations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "histack_ipam_allocations_total",
+			Help: "New addresses handed out from a ClusterIPPool",
+		},
+		[]string{"pool"},
+	)
+	Reuses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "histack_ipam_reuses_total",
+			Help: "Released addresses of a ClusterIPPool handed out again",
+		},
+		[]string{"pool"},
+	)
+	Releases = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "histack_ipam_releases_total",
+			Help: "Addresses returned to a ClusterIPPool",
+		},
+		[]string{"pool"},
+	)
+
+	FindOrCreateDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "histack_ipam_find_or_create_duration_seconds",
+			Help:    "Latency of FindOrCreateClusterIP",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"result"},
+	)
+	FindOrCreateConflictRetries = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "histack_ipam_find_or_create_conflict_retries",
+			Help:    "Retries of FindOrCreateClusterIP after a conflicting update",
+			Buckets: []float64{0, 1, 2, 3, 5},
+		},
+	)
+)
+
+// RegisterIPAMMetrics registers the IPAM metrics on the controller-runtime
+// registry, which the manager serves on its metrics endpoint.
+func RegisterIPAMMetrics() {
+	ctrlmetrics.Registry.MustRegister(
+		PoolTotalAddresses, PoolAllocatedAddresses, PoolFreeAddresses, PoolReleasedAddresses, PoolQuarantinedAddresses,
+		Allocations, Reuses, Releases,
+		FindOrCreateDuration, FindOrCreateConflictRetries,
+	)
+}
+
+// SetPoolAddresses sets the address gauges of a ClusterIPPool.
+func SetPoolAddresses(pool string, total, allocated, free, released, quarantined float64) {
+	PoolTotalAddresses.WithLabelValues(pool).Set(total)
+	PoolAllocatedAddresses.WithLabelValues(pool).Set(allocated)
+	PoolFreeAddresses.WithLabelValues(pool).Set(free)
+	PoolReleasedAddresses.WithLabelValues(pool).Set(released)
+	PoolQuarantinedAddresses.WithLabelValues(pool).Set(quarantined)
+}
+
+// DeletePoolAddresses drops the address gauges of a deleted ClusterIPPool.
+func DeletePoolAddresses(pool string) {
+	for _, gauge := range []*prometheus.GaugeVec{
+		PoolTotalAddresses, PoolAllocatedAddresses, PoolFreeAddresses, PoolReleasedAddresses, PoolQuarantinedAddresses,
+	} {
+		gauge.DeleteLabelValues(pool)
+	}
+}
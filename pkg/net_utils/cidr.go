@@ -0,0 +1,58 @@
+package netutils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseCIDRList parses a comma separated list of CIDRs, ignoring empty entries.
+func ParseCIDRList(list string) ([]*net.IPNet, error) {
+	var cidrs []*net.IPNet
+	for _, c := range strings.Split(list, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", c, err)
+		}
+		cidrs = append(cidrs, ipNet)
+	}
+	return cidrs, nil
+}
+
+// CIDRsOverlap reports whether two networks share at least one address.
+// CIDR blocks are either disjoint or nested, so checking both network
+// addresses is enough.
+func CIDRsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// IPFamily returns "v4" or "v6" for the given address.
+func IPFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "v4"
+	}
+	return "v6"
+}
+
+// IsNetworkOrBroadcast reports whether ip is the network or broadcast address
+// of an IPv4 subnet that reserves them (prefixes shorter than /31).
+func IsNetworkOrBroadcast(ip net.IP, ipNet *net.IPNet) bool {
+	ip4 := ip.To4()
+	if ip4 == nil || ipNet.IP.To4() == nil {
+		return false
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones < 2 {
+		return false
+	}
+	network := ipNet.IP.To4().Mask(ipNet.Mask)
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range broadcast {
+		broadcast[i] = network[i] | ^ipNet.Mask[len(ipNet.Mask)-net.IPv4len+i]
+	}
+	return ip4.Equal(network) || ip4.Equal(broadcast)
+}
@@ -0,0 +1,35 @@
+package netutils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PodNetNSPath returns the network namespace of a running pod, found through
+// the cgroup of one of its processes. It needs the host PID namespace.
+func PodNetNSPath(podUID string) (string, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return "", err
+	}
+	// the systemd cgroup driver writes the uid with underscores.
+	uids := [][]byte{[]byte(podUID), []byte(strings.ReplaceAll(podUID, "-", "_"))}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		cgroup, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cgroup"))
+		if err != nil {
+			continue
+		}
+		if bytes.Contains(cgroup, uids[0]) || bytes.Contains(cgroup, uids[1]) {
+			return fmt.Sprintf("/proc/%d/ns/net", pid), nil
+		}
+	}
+	return "", fmt.Errorf("no process of pod %s found", podUID)
+}
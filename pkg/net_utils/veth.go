@@ -1,16 +1,22 @@
 package netutils
 
 import (
+	"bytes"
+	"fmt"
 	"net"
 
 	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/utils/sysctl"
 	"github.com/vishvananda/netlink"
 	"k8s.io/klog/v2"
 )
 
-func SetupVeth(contNetnsPath, contIfaceName, requestedMac string, mtu int, ipAddress *net.IPNet, gatewayAddress *net.IP) (*current.Interface, *current.Interface, error) {
+// SetupVeth creates the veth pair of a container interface and configures its
+// addresses on it. A gateway, nil when there is none, is the default route of
+// the family of the address at the same index.
+func SetupVeth(contNetnsPath, contIfaceName, requestedMac string, mtu int, ipAddresses []net.IPNet, gatewayAddresses []net.IP) (*current.Interface, *current.Interface, error) {
 	hostIface := &current.Interface{}
 	contIface := &current.Interface{}
 	contNetns, err := ns.GetNS(contNetnsPath)
@@ -27,31 +33,11 @@ func SetupVeth(contNetnsPath, contIfaceName, requestedMac string, mtu int, ipAdd
 		if err := setInterfaceUp(contIfaceName); err != nil {
 			return err
 		}
-		klog.Infof("ip address: %v, gateway: %v", ipAddress, *gatewayAddress)
-		// if ipAddress != nil {
-		// 	link, err := AddInterfaceIPAddress(contIfaceName, &netlink.Addr{
-		// 		IPNet:     ipAddress,
-		// 		LinkIndex: containerVeth.Index,
-		// 	})
-		// 	if err != nil {
-		// 		return err
-		// 	}
-		// 	klog.Infof("ip address: %v", ipAddress)
-		// 	if gatewayAddress != nil {
-		// 		klog.Infof("gateay ip address: %v", *gatewayAddress)
-		// 		dr := netlink.Route{
-		// 			Dst:       nil,
-		// 			Gw:        *gatewayAddress,
-		// 			Flags:     int(netlink.FLAG_ONLINK),
-		// 			LinkIndex: link.Attrs().Index,
-		// 			// Scope:     netlink.SCOPE_NOWHERE,
-		// 		}
-		// 		if err := netlink.RouteReplace(&dr); err != nil {
-		// 			klog.Errorf("error on route add: %v", err)
-		// 			return err
-		// 		}
-		// 	}
-		// }
+		for i := range ipAddresses {
+			if err := configureAddress(contIfaceName, &ipAddresses[i], gatewayAddresses[i]); err != nil {
+				return err
+			}
+		}
 
 		contIface.Name = containerVeth.Name
 		contIface.Mac = containerVeth.HardwareAddr.String()
@@ -71,6 +57,36 @@ func SetupVeth(contNetnsPath, contIfaceName, requestedMac string, mtu int, ipAdd
 	return hostIface, contIface, nil
 }
 
+// configureAddress adds the address to the interface and, with a gateway, a
+// default route of its family through it.
+func configureAddress(ifName string, ipAddress *net.IPNet, gatewayAddress net.IP) error {
+	defaultDst := &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	if ipAddress.IP.To4() == nil {
+		// container runtimes may create the namespace with IPv6 disabled.
+		if _, err := sysctl.Sysctl(fmt.Sprintf("net/ipv6/conf/%s/disable_ipv6", ifName), "0"); err != nil {
+			return fmt.Errorf("failed to enable IPv6 on %s: %v", ifName, err)
+		}
+		defaultDst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+	link, err := AddInterfaceIPAddress(ifName, &netlink.Addr{IPNet: ipAddress})
+	if err != nil {
+		return fmt.Errorf("failed to add address %s to %s: %v", ipAddress, ifName, err)
+	}
+	klog.Infof("ip address: %v, gateway: %v", ipAddress, gatewayAddress)
+	if gatewayAddress == nil {
+		return nil
+	}
+	if err := netlink.RouteReplace(&netlink.Route{
+		Dst:       defaultDst,
+		Gw:        gatewayAddress,
+		Flags:     int(netlink.FLAG_ONLINK),
+		LinkIndex: link.Attrs().Index,
+	}); err != nil {
+		return fmt.Errorf("failed to route %s through %s: %v", defaultDst, gatewayAddress, err)
+	}
+	return nil
+}
+
 func setInterfaceUp(name string) error {
 	link, err := netlink.LinkByName(name)
 	if err != nil {
@@ -123,3 +139,44 @@ func AddInterfaceIPAddress(ifName string, ipAddress *netlink.Addr) (netlink.Link
 	}
 	return ifLink, nil
 }
+
+// CheckVeth verifies that the container interface is a veth with the MAC and
+// returns the name of its host peer.
+func CheckVeth(contNetnsPath, contIfaceName, mac string) (string, error) {
+	contNetns, err := ns.GetNS(contNetnsPath)
+	if err != nil {
+		return "", err
+	}
+	defer contNetns.Close()
+
+	var peerIndex int
+	err = contNetns.Do(func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(contIfaceName)
+		if err != nil {
+			return fmt.Errorf("failed to find interface %s: %v", contIfaceName, err)
+		}
+		veth, ok := link.(*netlink.Veth)
+		if !ok {
+			return fmt.Errorf("interface %s is a %s, not a veth", contIfaceName, link.Type())
+		}
+		expected, err := net.ParseMAC(mac)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(veth.HardwareAddr, expected) {
+			return fmt.Errorf("interface %s has MAC %s, expected %s", contIfaceName, veth.HardwareAddr, mac)
+		}
+		if peerIndex, err = netlink.VethPeerIndex(veth); err != nil {
+			return fmt.Errorf("failed to find the peer of interface %s: %v", contIfaceName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	peer, err := netlink.LinkByIndex(peerIndex)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the host peer of interface %s: %v", contIfaceName, err)
+	}
+	return peer.Attrs().Name, nil
+}
@@ -17,6 +17,8 @@ func CreateOVNagent(nbEndpoint string) (*OVNagent, error) {
 	dbModel, err := model.NewClientDBModel("OVN_Northbound", map[string]model.Model{
 		models.LogicalSwitchTable:     &models.LogicalSwitch{},
 		models.LogicalSwitchPortTable: &models.LogicalSwitchPort{},
+		models.LogicalRouterTable:     &models.LogicalRouter{},
+		models.NATTable:               &models.NAT{},
 		// Add other table mappings
 	})
 	if err != nil {
@@ -26,6 +28,9 @@ func CreateOVNagent(nbEndpoint string) (*OVNagent, error) {
 		models.LogicalSwitchTable: {
 			{Columns: []model.ColumnKey{{Column: "name"}}},
 		},
+		models.LogicalRouterTable: {
+			{Columns: []model.ColumnKey{{Column: "name"}}},
+		},
 	})
 
 	// Create client with connection options
@@ -0,0 +1,191 @@
+package ovn
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	models "github.com/hicompute/histack/pkg/ovn/models"
+	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// podExternalIDPrefix keys the pod a chassis binds a logical port for.
+	podExternalIDPrefix = "pod:"
+
+	requestedChassisOption   = "requested-chassis"
+	activationStrategyOption = "activation-strategy"
+)
+
+// BindLogicalPort attaches the pod on chassis to a logical port, creating it
+// when missing. A VM interface port the pod finds bound to another chassis is
+// being live migrated: it is requested on both chassis, and OVN activates it
+// on the new one only once QEMU announces the VM there with a RARP, so the MAC
+// never answers on two chassis at once.
+func (oa *OVNagent) BindLogicalPort(lsName, lspName, mac, chassis, pod string, externalIDs map[string]string) error {
+	ctx := context.Background()
+	lsp, err := oa.findLogicalPort(ctx, lspName)
+	if err != nil {
+		return err
+	}
+	if lsp == nil {
+		lsp = &models.LogicalSwitchPort{
+			UUID:        uuid.New().String(),
+			Name:        lspName,
+			Addresses:   []string{mac},
+			ExternalIDs: maps.Clone(externalIDs),
+		}
+		if lsp.ExternalIDs == nil {
+			lsp.ExternalIDs = map[string]string{}
+		}
+		lsp.ExternalIDs[podExternalIDPrefix+chassis] = pod
+		return oa.createLogicalPort(ctx, lsName, lsp)
+	}
+
+	lsp.ExternalIDs = maps.Clone(lsp.ExternalIDs)
+	if lsp.ExternalIDs == nil {
+		lsp.ExternalIDs = map[string]string{}
+	}
+	maps.Copy(lsp.ExternalIDs, externalIDs)
+	lsp.ExternalIDs[podExternalIDPrefix+chassis] = pod
+	lsp.Addresses = []string{mac}
+	setRequestedChassis(lsp, chassis)
+	if err := oa.updateLogicalPort(ctx, lsp); err != nil {
+		return err
+	}
+	klog.Infof("Logical port %s bound on chassis %s", lspName, strings.Join(boundChassis(lsp), ","))
+	return nil
+}
+
+// UnbindLogicalPort detaches the pod on chassis from a logical port. A port
+// still bound on the other chassis of a live migration stays, switched over
+// to that chassis alone; the last pod takes the port with it. The DEL of a pod
+// the port does not record on the chassis, e.g. one replaced by a pod of the
+// same VM on the node, leaves it alone. It reports whether the port exists and
+// whether the pod was unbound from it.
+func (oa *OVNagent) UnbindLogicalPort(lsName, lspName, chassis, pod string) (found, unbound bool, err error) {
+	ctx := context.Background()
+	lsp, err := oa.findLogicalPort(ctx, lspName)
+	if err != nil || lsp == nil {
+		return false, false, err
+	}
+	if bound, ok := lsp.ExternalIDs[podExternalIDPrefix+chassis]; ok && bound != pod {
+		klog.Infof("Logical port %s is bound for pod %s on chassis %s, not %s", lspName, bound, chassis, pod)
+		return true, false, nil
+	}
+
+	lsp.ExternalIDs = maps.Clone(lsp.ExternalIDs)
+	delete(lsp.ExternalIDs, podExternalIDPrefix+chassis)
+	if len(boundChassis(lsp)) == 0 {
+		return true, true, oa.DeleteLogicalPort(lsName, lspName)
+	}
+	setRequestedChassis(lsp, "")
+	if err := oa.updateLogicalPort(ctx, lsp); err != nil {
+		return true, true, err
+	}
+	klog.Infof("Logical port %s switched over to chassis %s", lspName, strings.Join(boundChassis(lsp), ","))
+	return true, true, nil
+}
+
+// boundChassis are the chassis pods are bound to the port on.
+func boundChassis(lsp *models.LogicalSwitchPort) []string {
+	var chassis []string
+	for key := range lsp.ExternalIDs {
+		if name, ok := strings.CutPrefix(key, podExternalIDPrefix); ok {
+			chassis = append(chassis, name)
+		}
+	}
+	slices.Sort(chassis)
+	return chassis
+}
+
+// setRequestedChassis requests a port bound on several chassis on all of them,
+// activated by RARP on the additional ones. OVN takes the first requested
+// chassis as the main one, so the chassis keep the order they bound the port
+// in and newChassis, the one binding it now, joins them last. A port on a
+// single chassis is left to whichever chassis claims it, as ports always were.
+func setRequestedChassis(lsp *models.LogicalSwitchPort, newChassis string) {
+	lsp.Options = maps.Clone(lsp.Options)
+	if lsp.Options == nil {
+		lsp.Options = map[string]string{}
+	}
+	bound := boundChassis(lsp)
+	var chassis []string
+	if requested := lsp.Options[requestedChassisOption]; requested != "" {
+		for _, name := range strings.Split(requested, ",") {
+			if slices.Contains(bound, name) {
+				chassis = append(chassis, name)
+			}
+		}
+	}
+	for _, name := range bound {
+		if !slices.Contains(chassis, name) && name != newChassis {
+			chassis = append(chassis, name)
+		}
+	}
+	if slices.Contains(bound, newChassis) && !slices.Contains(chassis, newChassis) {
+		chassis = append(chassis, newChassis)
+	}
+	if len(chassis) > 1 {
+		lsp.Options[requestedChassisOption] = strings.Join(chassis, ",")
+		lsp.Options[activationStrategyOption] = "rarp"
+		return
+	}
+	delete(lsp.Options, requestedChassisOption)
+	delete(lsp.Options, activationStrategyOption)
+}
+
+// findLogicalPort returns the logical switch port with the name, nil if there is none.
+func (oa *OVNagent) findLogicalPort(ctx context.Context, lspName string) (*models.LogicalSwitchPort, error) {
+	lspResults := []models.LogicalSwitchPort{}
+	if err := oa.nbClient.WhereCache(func(lsp *models.LogicalSwitchPort) bool {
+		return lsp.Name == lspName
+	}).List(ctx, &lspResults); err != nil {
+		return nil, fmt.Errorf("failed to query logical switch port cache: %v", err)
+	}
+	if len(lspResults) == 0 {
+		return nil, nil
+	}
+	return &lspResults[0], nil
+}
+
+func (oa *OVNagent) createLogicalPort(ctx context.Context, lsName string, lsp *models.LogicalSwitchPort) error {
+	lsResults := []models.LogicalSwitch{}
+	if err := oa.nbClient.WhereCache(func(ls *models.LogicalSwitch) bool {
+		return ls.Name == lsName
+	}).List(ctx, &lsResults); err != nil || len(lsResults) == 0 {
+		return fmt.Errorf("failed to find logical switch %s: %v", lsName, err)
+	}
+	ls := &lsResults[0]
+
+	lspOps, err := oa.nbClient.Create(lsp)
+	if err != nil {
+		return fmt.Errorf("failed to create logical port %s: %v", lsp.Name, err)
+	}
+	mutateOps, err := oa.nbClient.Where(ls).Mutate(ls, model.Mutation{
+		Field:   &ls.Ports,
+		Mutator: ovsdb.MutateOperationInsert,
+		Value:   []string{lsp.UUID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prepare logical switch mutation: %v", err)
+	}
+	if err := oa.transact(ctx, append(lspOps, mutateOps...)...); err != nil {
+		return err
+	}
+	klog.Infof("Logical port %s added to logical switch %s", lsp.Name, lsName)
+	return nil
+}
+
+func (oa *OVNagent) updateLogicalPort(ctx context.Context, lsp *models.LogicalSwitchPort) error {
+	ops, err := oa.nbClient.Where(lsp).Update(lsp, &lsp.Addresses, &lsp.Options, &lsp.ExternalIDs)
+	if err != nil {
+		return fmt.Errorf("failed to prepare logical switch port update: %v", err)
+	}
+	return oa.transact(ctx, ops...)
+}
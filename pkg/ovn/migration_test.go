@@ -0,0 +1,268 @@
+package ovn
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	models "github.com/hicompute/histack/pkg/ovn/models"
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/ovn-kubernetes/libovsdb/database/inmemory"
+	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"github.com/ovn-kubernetes/libovsdb/ovsdb/serverdb"
+	"github.com/ovn-kubernetes/libovsdb/server"
+)
+
+func TestSetRequestedChassis(t *testing.T) {
+	tests := []struct {
+		name        string
+		externalIDs map[string]string
+		options     map[string]string
+		newChassis  string
+		want        map[string]string
+	}{
+		{
+			name:        "single chassis",
+			externalIDs: map[string]string{"pod:node-a": "virt-launcher-vm-abcde"},
+			want:        map[string]string{},
+		},
+		{
+			name: "live migration",
+			externalIDs: map[string]string{
+				"pod:node-b": "virt-launcher-vm-fghij",
+				"pod:node-a": "virt-launcher-vm-abcde",
+				"namespace":  "default",
+			},
+			newChassis: "node-b",
+			want:       map[string]string{"requested-chassis": "node-a,node-b", "activation-strategy": "rarp"},
+		},
+		{
+			name: "live migration to a chassis sorting first",
+			externalIDs: map[string]string{
+				"pod:node-a": "virt-launcher-vm-fghij",
+				"pod:node-b": "virt-launcher-vm-abcde",
+			},
+			newChassis: "node-a",
+			want:       map[string]string{"requested-chassis": "node-b,node-a", "activation-strategy": "rarp"},
+		},
+		{
+			name: "a third chassis",
+			externalIDs: map[string]string{
+				"pod:node-a": "virt-launcher-vm-fghij",
+				"pod:node-b": "virt-launcher-vm-abcde",
+				"pod:node-c": "virt-launcher-vm-klmno",
+			},
+			options:    map[string]string{"requested-chassis": "node-b,node-a", "activation-strategy": "rarp"},
+			newChassis: "node-c",
+			want:       map[string]string{"requested-chassis": "node-b,node-a,node-c", "activation-strategy": "rarp"},
+		},
+		{
+			name:        "migration finished",
+			externalIDs: map[string]string{"pod:node-b": "virt-launcher-vm-fghij"},
+			options:     map[string]string{"requested-chassis": "node-a,node-b", "activation-strategy": "rarp", "mcast_flood": "true"},
+			want:        map[string]string{"mcast_flood": "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lsp := &models.LogicalSwitchPort{ExternalIDs: tt.externalIDs, Options: tt.options}
+			setRequestedChassis(lsp, tt.newChassis)
+			if !reflect.DeepEqual(lsp.Options, tt.want) {
+				t.Errorf("options = %v, want %v", lsp.Options, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindAndUnbindLogicalPort(t *testing.T) {
+	oa := newTestAgent(t, "public")
+	const port = "default_vm_eth0"
+	mac := "0a:58:0a:00:00:05"
+
+	if err := oa.BindLogicalPort("public", port, mac, "node-a", "virt-launcher-vm-abcde", map[string]string{"vmName": "vm"}); err != nil {
+		t.Fatalf("BindLogicalPort: %v", err)
+	}
+	lsp := waitForPort(t, oa, port, func(lsp *models.LogicalSwitchPort) bool { return lsp != nil })
+	if lsp.ExternalIDs["pod:node-a"] != "virt-launcher-vm-abcde" || lsp.ExternalIDs["vmName"] != "vm" {
+		t.Fatalf("external_ids = %v, want the pod on node-a and the VM", lsp.ExternalIDs)
+	}
+	if _, ok := lsp.Options[requestedChassisOption]; ok {
+		t.Fatalf("options = %v, want no requested-chassis on a single chassis", lsp.Options)
+	}
+
+	// the target pod of a live migration.
+	if err := oa.BindLogicalPort("public", port, mac, "node-b", "virt-launcher-vm-fghij", nil); err != nil {
+		t.Fatalf("BindLogicalPort: %v", err)
+	}
+	waitForPort(t, oa, port, func(lsp *models.LogicalSwitchPort) bool {
+		return lsp != nil && lsp.Options[requestedChassisOption] == "node-a,node-b" && lsp.Options[activationStrategyOption] == "rarp"
+	})
+
+	// a pod the port does not record on the chassis.
+	found, unbound, err := oa.UnbindLogicalPort("public", port, "node-b", "virt-launcher-vm-zzzzz")
+	if err != nil || !found || unbound {
+		t.Fatalf("UnbindLogicalPort of a replaced pod = %t, %t, %v, want found and not unbound", found, unbound, err)
+	}
+
+	// the source pod after the migration.
+	found, unbound, err = oa.UnbindLogicalPort("public", port, "node-a", "virt-launcher-vm-abcde")
+	if err != nil || !found || !unbound {
+		t.Fatalf("UnbindLogicalPort of the source pod = %t, %t, %v, want unbound", found, unbound, err)
+	}
+	waitForPort(t, oa, port, func(lsp *models.LogicalSwitchPort) bool {
+		if lsp == nil {
+			return false
+		}
+		_, requested := lsp.Options[requestedChassisOption]
+		_, source := lsp.ExternalIDs["pod:node-a"]
+		return !requested && !source && lsp.ExternalIDs["pod:node-b"] == "virt-launcher-vm-fghij"
+	})
+
+	// the last pod takes the port with it.
+	if _, _, err := oa.UnbindLogicalPort("public", port, "node-b", "virt-launcher-vm-fghij"); err != nil {
+		t.Fatalf("UnbindLogicalPort: %v", err)
+	}
+	waitForPort(t, oa, port, func(lsp *models.LogicalSwitchPort) bool { return lsp == nil })
+	if found, _, err := oa.UnbindLogicalPort("public", port, "node-b", "virt-launcher-vm-fghij"); err != nil || found {
+		t.Fatalf("UnbindLogicalPort of a deleted port = %t, %v, want not found", found, err)
+	}
+}
+
+func TestBindLogicalPortKeepsTheSourceMain(t *testing.T) {
+	oa := newTestAgent(t, "public")
+	const port = "default_vm_eth0"
+	mac := "0a:58:0a:00:00:06"
+
+	// the VM runs on node-b and migrates to node-a, whose name sorts first.
+	if err := oa.BindLogicalPort("public", port, mac, "node-b", "virt-launcher-vm-abcde", nil); err != nil {
+		t.Fatalf("BindLogicalPort: %v", err)
+	}
+	waitForPort(t, oa, port, func(lsp *models.LogicalSwitchPort) bool { return lsp != nil })
+	if err := oa.BindLogicalPort("public", port, mac, "node-a", "virt-launcher-vm-fghij", nil); err != nil {
+		t.Fatalf("BindLogicalPort: %v", err)
+	}
+	waitForPort(t, oa, port, func(lsp *models.LogicalSwitchPort) bool {
+		return lsp != nil && lsp.Options[requestedChassisOption] == "node-b,node-a"
+	})
+
+	// a repeated ADD of the source pod keeps it main.
+	if err := oa.BindLogicalPort("public", port, mac, "node-b", "virt-launcher-vm-abcde", nil); err != nil {
+		t.Fatalf("BindLogicalPort: %v", err)
+	}
+	lsp := waitForPort(t, oa, port, func(lsp *models.LogicalSwitchPort) bool { return lsp != nil })
+	if lsp.Options[requestedChassisOption] != "node-b,node-a" {
+		t.Errorf("requested-chassis = %q, want node-b,node-a", lsp.Options[requestedChassisOption])
+	}
+}
+
+// newTestAgent returns an agent connected to an in-memory northbound database
+// with the logical switches.
+func newTestAgent(t *testing.T, switches ...string) *OVNagent {
+	t.Helper()
+	ctx := context.Background()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "ovn-nb.ovsschema"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema ovsdb.DatabaseSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	clientModel, err := model.NewClientDBModel("OVN_Northbound", map[string]model.Model{
+		models.LogicalSwitchTable:     &models.LogicalSwitch{},
+		models.LogicalSwitchPortTable: &models.LogicalSwitchPort{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverModel, err := serverdb.FullDatabaseModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSchema := serverdb.Schema()
+	dbModel, errs := model.NewDatabaseModel(schema, clientModel)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	serverDBModel, errs := model.NewDatabaseModel(serverSchema, serverModel)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	logger := logr.Discard()
+	db := inmemory.NewDatabase(map[string]model.ClientDBModel{
+		schema.Name:       clientModel,
+		serverSchema.Name: serverModel,
+	}, &logger)
+	srv, err := server.NewOvsdbServer(db, &logger, dbModel, serverDBModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(t.TempDir(), "nb.sock")
+	go func() {
+		if err := srv.Serve("unix", socket); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(srv.Close)
+	for deadline := time.Now().Add(5 * time.Second); !srv.Ready(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("northbound database did not start")
+		}
+	}
+
+	nbClient, err := client.NewOVSDBClient(clientModel, client.WithEndpoint("unix:"+socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nbClient.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nbClient.Disconnect)
+	if _, err := nbClient.MonitorAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	oa := &OVNagent{nbClient: nbClient}
+
+	for _, name := range switches {
+		ops, err := nbClient.Create(&models.LogicalSwitch{UUID: "ls" + name, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := oa.transact(ctx, ops...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var ls []models.LogicalSwitch
+		if err := nbClient.List(ctx, &ls); err == nil && len(ls) == len(switches) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("logical switches did not reach the cache")
+		}
+	}
+	return oa
+}
+
+// waitForPort waits until the cached logical switch port, nil when there is
+// none, satisfies cond and returns it.
+func waitForPort(t *testing.T, oa *OVNagent, name string, cond func(*models.LogicalSwitchPort) bool) *models.LogicalSwitchPort {
+	t.Helper()
+	var lsp *models.LogicalSwitchPort
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if lsp, err = oa.findLogicalPort(context.Background(), name); err == nil && cond(lsp) {
+			return lsp
+		}
+	}
+	t.Fatalf("logical switch port %s = %+v, %v", name, lsp, err)
+	return nil
+}
@@ -0,0 +1,136 @@
+package ovn
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+	models "github.com/hicompute/histack/pkg/ovn/models"
+	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"k8s.io/klog/v2"
+)
+
+// SetDNATAndSNAT points the dnat_and_snat NAT of externalIP on a logical router
+// at logicalIP. An existing NAT is updated in place, so traffic moves to the new
+// logical IP in a single transaction.
+func (oa *OVNagent) SetDNATAndSNAT(routerName, externalIP, logicalIP string, externalIDs map[string]string) error {
+	ctx := context.Background()
+	lr, err := oa.findLogicalRouter(ctx, routerName)
+	if err != nil {
+		return err
+	}
+	nat, err := oa.findDNATAndSNAT(ctx, lr, externalIP)
+	if err != nil {
+		return err
+	}
+
+	var ops []ovsdb.Operation
+	if nat != nil {
+		if nat.LogicalIP == logicalIP && maps.Equal(nat.ExternalIDs, externalIDs) {
+			return nil
+		}
+		nat.LogicalIP = logicalIP
+		nat.ExternalIDs = externalIDs
+		if ops, err = oa.nbClient.Where(nat).Update(nat, &nat.LogicalIP, &nat.ExternalIDs); err != nil {
+			return fmt.Errorf("failed to prepare NAT update: %v", err)
+		}
+	} else {
+		nat = &models.NAT{
+			UUID:        uuid.New().String(),
+			Type:        models.NATTypeDNATAndSNAT,
+			ExternalIP:  externalIP,
+			LogicalIP:   logicalIP,
+			ExternalIDs: externalIDs,
+		}
+		createOps, err := oa.nbClient.Create(nat)
+		if err != nil {
+			return fmt.Errorf("failed to prepare NAT create: %v", err)
+		}
+		mutateOps, err := oa.nbClient.Where(lr).Mutate(lr, model.Mutation{
+			Field:   &lr.Nat,
+			Mutator: ovsdb.MutateOperationInsert,
+			Value:   []string{nat.UUID},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to prepare logical router mutation: %v", err)
+		}
+		ops = append(createOps, mutateOps...)
+	}
+	if err := oa.transact(ctx, ops...); err != nil {
+		return err
+	}
+	klog.Infof("NAT %s -> %s set on logical router %s", externalIP, logicalIP, routerName)
+	return nil
+}
+
+// DeleteDNATAndSNAT removes the dnat_and_snat NAT of externalIP from a logical router.
+func (oa *OVNagent) DeleteDNATAndSNAT(routerName, externalIP string) error {
+	ctx := context.Background()
+	lr, err := oa.findLogicalRouter(ctx, routerName)
+	if err != nil {
+		return err
+	}
+	nat, err := oa.findDNATAndSNAT(ctx, lr, externalIP)
+	if err != nil || nat == nil {
+		return err
+	}
+
+	mutateOps, err := oa.nbClient.Where(lr).Mutate(lr, model.Mutation{
+		Field:   &lr.Nat,
+		Mutator: ovsdb.MutateOperationDelete,
+		Value:   []string{nat.UUID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prepare logical router mutation: %v", err)
+	}
+	delOps, err := oa.nbClient.Where(nat).Delete()
+	if err != nil {
+		return fmt.Errorf("failed to prepare NAT delete: %v", err)
+	}
+	if err := oa.transact(ctx, append(mutateOps, delOps...)...); err != nil {
+		return err
+	}
+	klog.Infof("NAT %s deleted from logical router %s", externalIP, routerName)
+	return nil
+}
+
+func (oa *OVNagent) findLogicalRouter(ctx context.Context, routerName string) (*models.LogicalRouter, error) {
+	routers := []models.LogicalRouter{}
+	if err := oa.nbClient.WhereCache(func(lr *models.LogicalRouter) bool {
+		return lr.Name == routerName
+	}).List(ctx, &routers); err != nil {
+		return nil, fmt.Errorf("failed to query logical router cache: %v", err)
+	}
+	if len(routers) == 0 {
+		return nil, fmt.Errorf("logical router %q not found", routerName)
+	}
+	return &routers[0], nil
+}
+
+// findDNATAndSNAT returns the dnat_and_snat NAT of externalIP on the router, nil if there is none.
+func (oa *OVNagent) findDNATAndSNAT(ctx context.Context, lr *models.LogicalRouter, externalIP string) (*models.NAT, error) {
+	nats := []models.NAT{}
+	if err := oa.nbClient.WhereCache(func(nat *models.NAT) bool {
+		return nat.Type == models.NATTypeDNATAndSNAT && nat.ExternalIP == externalIP && slices.Contains(lr.Nat, nat.UUID)
+	}).List(ctx, &nats); err != nil {
+		return nil, fmt.Errorf("failed to query NAT cache: %v", err)
+	}
+	if len(nats) == 0 {
+		return nil, nil
+	}
+	return &nats[0], nil
+}
+
+func (oa *OVNagent) transact(ctx context.Context, ops ...ovsdb.Operation) error {
+	reply, err := oa.nbClient.Transact(ctx, ops...)
+	if err != nil {
+		return fmt.Errorf("transaction failed: %v", err)
+	}
+	if _, err := ovsdb.CheckOperationResults(reply, ops); err != nil {
+		return fmt.Errorf("transaction failed: %v", err)
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"maps"
+	"slices"
+	"strings"
 
 	"github.com/google/uuid"
 	models "github.com/hicompute/histack/pkg/ovn/models"
@@ -163,3 +165,58 @@ func (oa *OVNagent) ListLogicalPorts(ctx context.Context, lsName string) ([]stri
 
 	return lsObj[0].Ports, nil
 }
+
+// SetLogicalPortEnabled enables or disables a logical switch port. A disabled
+// port drops all traffic of its interface.
+func (oa *OVNagent) SetLogicalPortEnabled(lspName string, enabled bool) error {
+	ctx := context.Background()
+	lsp, err := oa.findLogicalPort(ctx, lspName)
+	if err != nil {
+		return err
+	}
+	if lsp == nil {
+		return fmt.Errorf("logical switch port %q not found", lspName)
+	}
+	lsp.Enabled = &enabled
+	ops, err := oa.nbClient.Where(lsp).Update(lsp, &lsp.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to prepare logical switch port update: %v", err)
+	}
+	if err := oa.transact(ctx, ops...); err != nil {
+		return err
+	}
+	klog.Infof("Logical port %s enabled=%t", lspName, enabled)
+	return nil
+}
+
+// CheckLogicalPort verifies that the logical switch port is on the logical
+// switch and addressed with the MAC.
+func (oa *OVNagent) CheckLogicalPort(lsName, lspName, mac string) error {
+	ctx := context.Background()
+	lsp, err := oa.findLogicalPort(ctx, lspName)
+	if err != nil {
+		return err
+	}
+	if lsp == nil {
+		return fmt.Errorf("logical switch port %q not found", lspName)
+	}
+	lsResults := []models.LogicalSwitch{}
+	if err := oa.nbClient.WhereCache(func(ls *models.LogicalSwitch) bool {
+		return ls.Name == lsName
+	}).List(ctx, &lsResults); err != nil {
+		return fmt.Errorf("failed to query logical switch cache: %v", err)
+	}
+	if len(lsResults) == 0 {
+		return fmt.Errorf("logical switch %s not found", lsName)
+	}
+	if !slices.Contains(lsResults[0].Ports, lsp.UUID) {
+		return fmt.Errorf("logical switch port %s is not on logical switch %s", lspName, lsName)
+	}
+	// an address is the MAC, optionally followed by IPs.
+	for _, address := range lsp.Addresses {
+		if fields := strings.Fields(address); len(fields) > 0 && strings.EqualFold(fields[0], mac) {
+			return nil
+		}
+	}
+	return fmt.Errorf("logical switch port %s has addresses %v, expected %s", lspName, lsp.Addresses, mac)
+}
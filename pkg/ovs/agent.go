@@ -2,6 +2,7 @@ package ovs
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"strings"
 
@@ -18,9 +19,10 @@ type OvsAgent struct {
 
 func CreateOVSagent() (*OvsAgent, error) {
 	dbModel, err := model.NewClientDBModel("Open_vSwitch", map[string]model.Model{
-		ovsModels.BridgeTable:    &ovsModels.Bridge{},
-		ovsModels.PortTable:      &ovsModels.Port{},
-		ovsModels.InterfaceTable: &ovsModels.Interface{},
+		ovsModels.BridgeTable:      &ovsModels.Bridge{},
+		ovsModels.PortTable:        &ovsModels.Port{},
+		ovsModels.InterfaceTable:   &ovsModels.Interface{},
+		ovsModels.OpenvSwitchTable: &ovsModels.OpenvSwitch{},
 	})
 	dbModel.SetIndexes(map[string][]model.ClientIndex{
 		ovsModels.PortTable: {{Columns: []model.ColumnKey{
@@ -56,6 +58,19 @@ func CreateOVSagent() (*OvsAgent, error) {
 	}, nil
 }
 
+// SystemID returns the external_ids:system-id of Open vSwitch, the name
+// ovn-controller registers the chassis of the node under.
+func (oa *OvsAgent) SystemID() (string, error) {
+	rows := []ovsModels.OpenvSwitch{}
+	if err := oa.ovsClient.List(context.Background(), &rows); err != nil {
+		return "", fmt.Errorf("failed to list Open_vSwitch: %v", err)
+	}
+	if len(rows) == 0 || rows[0].ExternalIDs["system-id"] == "" {
+		return "", fmt.Errorf("external_ids:system-id of Open_vSwitch is not set")
+	}
+	return rows[0].ExternalIDs["system-id"], nil
+}
+
 func (oa *OvsAgent) Close() {
 	oa.ovsClient.Disconnect()
 }
@@ -86,9 +101,14 @@ func (oa *OvsAgent) updateInterfaceStats(iface *ovsModels.Interface) {
 		return
 	}
 
+	vmName := iface.ExternalIDs["vm"]
+	if vmName == "" {
+		// ports named after their pod.
+		vmName = helper.ExtractVMName(parts[1])
+	}
 	labels := map[string]string{
 		"vm_namespace": parts[0],
-		"vm":           helper.ExtractVMName(parts[1]),
+		"vm":           vmName,
 		"iface":        parts[2],
 	}
 
@@ -0,0 +1,9 @@
+package ovs
+
+const OpenvSwitchTable = "Open_vSwitch"
+
+// OpenvSwitch holds the columns of the Open_vSwitch table the agent reads.
+type OpenvSwitch struct {
+	UUID        string            `ovsdb:"_uuid"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+}
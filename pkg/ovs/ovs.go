@@ -3,6 +3,8 @@ package ovs
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/google/uuid"
 	ovsModel "github.com/hicompute/histack/pkg/ovs/models"
@@ -11,7 +13,7 @@ import (
 	"k8s.io/klog/v2"
 )
 
-func (oa *OvsAgent) AddPort(bridgeName, portName, ifaceType, ifaceId string) error {
+func (oa *OvsAgent) AddPort(bridgeName, portName, ifaceType, ifaceId string, externalIDs ...map[string]string) error {
 	ctx := context.Background()
 	ifaceUUID := uuid.New().String()
 	portUUID := uuid.New().String()
@@ -29,6 +31,9 @@ func (oa *OvsAgent) AddPort(bridgeName, portName, ifaceType, ifaceId string) err
 			"iface-id": ifaceId,
 		},
 	}
+	for _, ids := range externalIDs {
+		maps.Copy(iface.ExternalIDs, ids)
+	}
 
 	ifaceOp, err := oa.ovsClient.Create(iface)
 	if err != nil {
@@ -80,11 +85,6 @@ func (oa *OvsAgent) DelPort(bridgeName, ifaceId string) error {
 	externalIds := map[string]string{
 		"iface-id": ifaceId,
 	}
-	// 1. Get port and bridge objects
-	bridge := &ovsModel.Bridge{Name: bridgeName}
-	if err := oa.ovsClient.Get(ctx, bridge); err != nil {
-		return fmt.Errorf("failed to find bridge %s: %v", bridgeName, err)
-	}
 	ports := []ovsModel.Port{}
 	if err := oa.ovsClient.Where(&ovsModel.Port{ExternalIDs: externalIds}).List(ctx, &ports); err != nil {
 		return fmt.Errorf("failed to find port with iface-id %s: %v", ifaceId, err)
@@ -93,8 +93,48 @@ func (oa *OvsAgent) DelPort(bridgeName, ifaceId string) error {
 	if len(ports) == 0 {
 		return fmt.Errorf("port not found with iface-id %s", ifaceId)
 	}
-	port := ports[0]
-	// 2. Mutate the bridge to remove the port UUID from its Ports set
+	if err := oa.delPort(ctx, bridgeName, &ports[0]); err != nil {
+		return err
+	}
+	klog.Infof("🧹 Deleted port %v from bridge %s", externalIds, bridgeName)
+	return nil
+}
+
+// DelPodPort deletes the port with the iface-id whose interface was added for
+// the pod. Ports of other pods sharing the iface-id are left alone.
+func (oa *OvsAgent) DelPodPort(bridgeName, ifaceId, pod string) error {
+	ctx := context.Background()
+	ports := []ovsModel.Port{}
+	if err := oa.ovsClient.Where(&ovsModel.Port{ExternalIDs: map[string]string{"iface-id": ifaceId}}).List(ctx, &ports); err != nil {
+		return fmt.Errorf("failed to find port with iface-id %s: %v", ifaceId, err)
+	}
+	for i := range ports {
+		for _, ifaceUUID := range ports[i].Interfaces {
+			iface := &ovsModel.Interface{UUID: ifaceUUID}
+			if err := oa.ovsClient.Get(ctx, iface); err != nil {
+				return fmt.Errorf("failed to get interface of port %s: %v", ports[i].Name, err)
+			}
+			if iface.ExternalIDs["pod"] != pod {
+				continue
+			}
+			if err := oa.delPort(ctx, bridgeName, &ports[i]); err != nil {
+				return err
+			}
+			klog.Infof("🧹 Deleted port %s of pod %s from bridge %s", ports[i].Name, pod, bridgeName)
+			return nil
+		}
+	}
+	klog.Infof("No port with iface-id %s of pod %s on bridge %s", ifaceId, pod, bridgeName)
+	return nil
+}
+
+// delPort removes the port and its interfaces from the bridge.
+func (oa *OvsAgent) delPort(ctx context.Context, bridgeName string, port *ovsModel.Port) error {
+	bridge := &ovsModel.Bridge{Name: bridgeName}
+	if err := oa.ovsClient.Get(ctx, bridge); err != nil {
+		return fmt.Errorf("failed to find bridge %s: %v", bridgeName, err)
+	}
+	// Mutate the bridge to remove the port UUID from its Ports set
 	mutations := []model.Mutation{
 		{
 			Field:   &bridge.Ports,
@@ -107,12 +147,12 @@ func (oa *OvsAgent) DelPort(bridgeName, ifaceId string) error {
 	if err != nil {
 		return fmt.Errorf("failed to prepare bridge mutation: %v", err)
 	}
-	// 3. Delete the port itself (and the interface)
-	portOp, err := oa.ovsClient.Where(&port).Delete()
+	// Delete the port itself (and the interface)
+	portOp, err := oa.ovsClient.Where(port).Delete()
 	if err != nil {
 		return fmt.Errorf("failed to prepare port delete: %v", err)
 	}
-	// 4. Also delete the Interface row(s) belonging to the port
+	// Also delete the Interface row(s) belonging to the port
 	for _, ifaceUUID := range port.Interfaces {
 		iface := &ovsModel.Interface{UUID: ifaceUUID}
 		ifaceOp, err := oa.ovsClient.Where(iface).Delete()
@@ -122,7 +162,7 @@ func (oa *OvsAgent) DelPort(bridgeName, ifaceId string) error {
 		portOp = append(portOp, ifaceOp...)
 	}
 
-	// 5. Run all operations in one transaction
+	// Run all operations in one transaction
 	ops := append(bridgeOps, portOp...)
 	reply, err := oa.ovsClient.Transact(ctx, ops...)
 	if err != nil {
@@ -134,7 +174,48 @@ func (oa *OvsAgent) DelPort(bridgeName, ifaceId string) error {
 			klog.Infof("OVSDB error: %d %s (%s), rows: %v", i, r.Error, r.Details, r.Rows)
 		}
 	}
-
-	klog.Infof("🧹 Deleted port %v from bridge %s", externalIds, bridgeName)
 	return nil
 }
+
+// CheckPort verifies that a port with the iface-id is attached to the bridge
+// through the interface with the name. The launcher pods of a live migration
+// on one node have a port each with the iface-id.
+func (oa *OvsAgent) CheckPort(bridgeName, portName, ifaceId string) error {
+	ctx := context.Background()
+	bridge := &ovsModel.Bridge{Name: bridgeName}
+	if err := oa.ovsClient.Get(ctx, bridge); err != nil {
+		return fmt.Errorf("failed to get bridge %q: %v", bridgeName, err)
+	}
+	ports := []ovsModel.Port{}
+	if err := oa.ovsClient.Where(&ovsModel.Port{ExternalIDs: map[string]string{"iface-id": ifaceId}}).List(ctx, &ports); err != nil {
+		return fmt.Errorf("failed to find port with iface-id %s: %v", ifaceId, err)
+	}
+	if len(ports) == 0 {
+		return fmt.Errorf("port not found with iface-id %s", ifaceId)
+	}
+	for _, port := range ports {
+		for _, ifaceUUID := range port.Interfaces {
+			iface := &ovsModel.Interface{UUID: ifaceUUID}
+			if err := oa.ovsClient.Get(ctx, iface); err != nil {
+				return fmt.Errorf("failed to get interface of port %s: %v", port.Name, err)
+			}
+			if iface.Name != portName || iface.ExternalIDs["iface-id"] != ifaceId {
+				continue
+			}
+			if !slices.Contains(bridge.Ports, port.UUID) {
+				return fmt.Errorf("port %s with iface-id %s is not attached to bridge %s", port.Name, ifaceId, bridgeName)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("port with iface-id %s has no interface %s", ifaceId, portName)
+}
+
+// HasPort reports whether a port with the iface-id is attached to OVS.
+func (oa *OvsAgent) HasPort(ifaceId string) (bool, error) {
+	ports := []ovsModel.Port{}
+	if err := oa.ovsClient.Where(&ovsModel.Port{ExternalIDs: map[string]string{"iface-id": ifaceId}}).List(context.Background(), &ports); err != nil {
+		return false, fmt.Errorf("failed to find port with iface-id %s: %v", ifaceId, err)
+	}
+	return len(ports) > 0, nil
+}